@@ -63,13 +63,7 @@ type APIResponse struct {
 
 func (s *Sender) SendMetrics(ctx context.Context, metric *models.Metric) (time.Duration, error) {
 
-	if len(metric.Logs.System) > s.maxLogSize {
-		metric.Logs.System = metric.Logs.System[:s.maxLogSize] + "\n[TRUNCATED]"
-	}
-
-	if len(metric.Logs.Security) > s.maxLogSize {
-		metric.Logs.Security = metric.Logs.Security[:s.maxLogSize] + "\n[TRUNCATED]"
-	}
+	truncateLogs(&metric.Logs, s.maxLogSize)
 
 	payload := metric.ToPayload(s.agentVersion)
 
@@ -104,6 +98,62 @@ func (s *Sender) SendMetrics(ctx context.Context, metric *models.Metric) (time.D
 	return 0, fmt.Errorf("all %d retries exhausted: %w", s.retryMax, lastErr)
 }
 
+// truncateLogs drops whole records once maxSize is reached, counting what
+// was dropped instead of cutting a record in half. The inputs take turns,
+// one record each, so the ones collected last (syslog, OTLP) still get
+// their share; each keeps its oldest records, in order.
+func truncateLogs(logs *models.LogsInfo, maxSize int) {
+	sizes := make([]int, len(logs.Records))
+	total := 0
+	for i, rec := range logs.Records {
+		sizes[i] = rec.Size()
+		total += sizes[i]
+	}
+	if total <= maxSize {
+		return
+	}
+
+	var inputs []string
+	queued := map[string][]int{} // record indexes per input, oldest first
+	for i, rec := range logs.Records {
+		if _, ok := queued[rec.Input]; !ok {
+			inputs = append(inputs, rec.Input)
+		}
+		queued[rec.Input] = append(queued[rec.Input], i)
+	}
+
+	keep := make([]bool, len(logs.Records))
+	size := 0
+	for taken := true; taken; {
+		taken = false
+		for _, input := range inputs {
+			q := queued[input]
+			if len(q) == 0 {
+				continue
+			}
+			if size+sizes[q[0]] > maxSize {
+				// Out of room for this input; later records would be out
+				// of order.
+				queued[input] = nil
+				continue
+			}
+			size += sizes[q[0]]
+			keep[q[0]] = true
+			queued[input] = q[1:]
+			taken = true
+		}
+	}
+
+	kept := logs.Records[:0]
+	for i, rec := range logs.Records {
+		if keep[i] {
+			kept = append(kept, rec)
+		}
+	}
+	logs.Dropped += len(logs.Records) - len(kept)
+	logs.Records = kept
+}
+
 func isRetryable(err error) bool {
 	errStr := err.Error()
 	for _, code := range []string{"400", "401", "403", "404", "422"} {
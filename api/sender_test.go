@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/uptime-id/agent/models"
+)
+
+func TestLogRecordSize(t *testing.T) {
+	records := []models.LogRecord{
+		{Timestamp: 1, Source: "system", Input: "journal", Message: "hello"},
+		{Timestamp: 2, Source: "app", Input: "file", Message: "quotes \" and \\ and <tags> and \x01", Fields: map[string]string{"k": "v"}},
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 1 // the closing bracket; each record pays for its separator
+	for _, rec := range records {
+		total += rec.Size()
+	}
+	if total != len(data) {
+		t.Errorf("sizes add up to %d, encoded %d bytes", total, len(data))
+	}
+}
+
+func TestTruncateLogs(t *testing.T) {
+	rec := func(input string, i int) models.LogRecord {
+		// Padded so that all records are the same size.
+		pad := strings.Repeat(" ", 2*(len("journal")-len(input)))
+		return models.LogRecord{Input: input, Message: fmt.Sprintf("%s%d%s", input, i, pad)}
+	}
+	var records []models.LogRecord
+	for i := range 5 {
+		records = append(records, rec("journal", i))
+	}
+	for i := range 2 {
+		records = append(records, rec("docker", i))
+	}
+	for i := range 5 {
+		records = append(records, rec("syslog", i))
+	}
+	size := records[0].Size()
+	messages := func(logs models.LogsInfo) string {
+		var m []string
+		for _, r := range logs.Records {
+			m = append(m, strings.TrimSpace(r.Message))
+		}
+		return strings.Join(m, ",")
+	}
+
+	tests := []struct {
+		name    string
+		maxSize int
+		want    string
+		dropped int
+	}{
+		{"fits", 12 * size, "journal0,journal1,journal2,journal3,journal4,docker0,docker1,syslog0,syslog1,syslog2,syslog3,syslog4", 0},
+		{"shared between inputs", 6 * size, "journal0,journal1,docker0,docker1,syslog0,syslog1", 6},
+		{"short input leaves room for the others", 10 * size, "journal0,journal1,journal2,journal3,docker0,docker1,syslog0,syslog1,syslog2,syslog3", 2},
+		{"partial round", 4*size + size/2, "journal0,journal1,docker0,syslog0", 8},
+		{"nothing fits", size - 1, "", 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := models.LogsInfo{Records: append([]models.LogRecord(nil), records...), Dropped: 1}
+			truncateLogs(&logs, tt.maxSize)
+			if got := messages(logs); got != tt.want || logs.Dropped != 1+tt.dropped {
+				t.Errorf("kept %s, dropped %d", got, logs.Dropped)
+			}
+		})
+	}
+
+	// An oversized record doesn't block smaller ones of other inputs.
+	logs := models.LogsInfo{Records: []models.LogRecord{
+		{Input: "file", Message: strings.Repeat("x", 1000)},
+		rec("otlp", 0),
+		rec("otlp", 1),
+	}}
+	truncateLogs(&logs, 2*size+10)
+	if got := messages(logs); got != "otlp0,otlp1" || logs.Dropped != 1 {
+		t.Errorf("kept %s, dropped %d", got, logs.Dropped)
+	}
+}
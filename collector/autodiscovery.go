@@ -0,0 +1,230 @@
+package collector
+
+import (
+	"log"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// Container labels understood by the agent, e.g.
+//
+//	uptimeid.check.http=http://:8080/health
+//	uptimeid.check.tcp.db=:5432
+//	uptimeid.check.tls=:8443
+//	uptimeid.check.interval=15s
+//	uptimeid.logs.exclude=true
+//	uptimeid.logs.format=json
+//	uptimeid.logs.regex=^(?P<level>\w+) (?P<message>.*)$
+//	uptimeid.logs.multiline=java
+//	uptimeid.logs.multiline.start=^\d{4}-\d{2}-\d{2}
+//	uptimeid.logs.multiline.continuation=^\s
+//
+// An empty host in a check target is resolved to the container's address.
+const (
+	labelCheckPrefix   = "uptimeid.check."
+	labelCheckInterval = "uptimeid.check.interval"
+	labelCheckTimeout  = "uptimeid.check.timeout"
+	labelLogsExclude   = "uptimeid.logs.exclude"
+	labelLogsFormat    = "uptimeid.logs.format"
+	labelLogsRegex     = "uptimeid.logs.regex"
+	labelLogsMultiline = "uptimeid.logs.multiline"
+	labelLogsStart     = "uptimeid.logs.multiline.start"
+	labelLogsCont      = "uptimeid.logs.multiline.continuation"
+)
+
+var unresolvedChecks sync.Map
+
+func logsExcluded(c container.Summary) bool {
+	v, err := strconv.ParseBool(c.Labels[labelLogsExclude])
+	return err == nil && v
+}
+
+func containerLogFormat(c container.Summary) *logParser {
+	if c.Labels[labelLogsFormat] == "" {
+		return nil
+	}
+	return containerLogParser(c.Labels[labelLogsFormat], c.Labels[labelLogsRegex])
+}
+
+// containerMultiline selects a multiline preset (java, python, go) or a
+// custom start or continuation pattern by label.
+func containerMultiline(c container.Summary) *multilineRule {
+	mc := config.MultilineConfig{
+		Preset:       c.Labels[labelLogsMultiline],
+		Start:        c.Labels[labelLogsStart],
+		Continuation: c.Labels[labelLogsCont],
+	}
+	if mc == (config.MultilineConfig{}) {
+		return nil
+	}
+	return containerMultilineRule(mc)
+}
+
+func discoverProbes(containerList []container.Summary) []probeSpec {
+	var specs []probeSpec
+
+	for _, c := range containerList {
+		if c.State != "running" {
+			continue
+		}
+
+		name := containerName(c)
+		interval := labelDuration(c.Labels, labelCheckInterval, defaultProbeInterval)
+		timeout := labelDuration(c.Labels, labelCheckTimeout, defaultProbeTimeout)
+
+		for key, value := range c.Labels {
+			if !strings.HasPrefix(key, labelCheckPrefix) || key == labelCheckInterval || key == labelCheckTimeout {
+				continue
+			}
+
+			checkName := strings.TrimPrefix(key, labelCheckPrefix)
+			checkType, _, _ := strings.Cut(checkName, ".")
+
+			var target string
+			switch checkType {
+			case "http":
+				target = resolveHTTPTarget(c, value)
+			case "tcp", "tls":
+				target = resolveTCPTarget(c, value)
+			default:
+				continue
+			}
+
+			specKey := c.ID[:12] + "/" + checkName
+			if target == "" {
+				if _, loaded := unresolvedChecks.LoadOrStore(specKey, true); !loaded {
+					log.Printf("Check %s on %s: cannot resolve target %q", checkName, name, value)
+				}
+				continue
+			}
+			unresolvedChecks.Delete(specKey)
+
+			specs = append(specs, probeSpec{
+				Key:       specKey,
+				Container: name,
+				Probe: config.ProbeConfig{
+					Name:     checkName,
+					Type:     checkType,
+					Target:   target,
+					Interval: config.Duration(interval),
+					Timeout:  config.Duration(timeout),
+				},
+			})
+		}
+	}
+
+	return specs
+}
+
+func resolveHTTPTarget(c container.Summary, raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	addr := resolveContainerAddr(c, u.Hostname(), port)
+	if addr == "" {
+		return ""
+	}
+	u.Host = addr
+	return u.String()
+}
+
+func resolveTCPTarget(c container.Summary, raw string) string {
+	host, port, err := net.SplitHostPort(raw)
+	if err != nil {
+		return ""
+	}
+	return resolveContainerAddr(c, host, port)
+}
+
+// resolveContainerAddr fills in an empty host: containers on the host network
+// are reached via loopback, others via their network IP, falling back to a
+// published port on the host.
+func resolveContainerAddr(c container.Summary, host, port string) string {
+	if host != "" {
+		return net.JoinHostPort(host, port)
+	}
+
+	if c.HostConfig.NetworkMode == "host" {
+		return net.JoinHostPort("127.0.0.1", port)
+	}
+
+	if ip := containerIP(c); ip != "" {
+		return net.JoinHostPort(ip, port)
+	}
+
+	privatePort, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return ""
+	}
+	for _, p := range c.Ports {
+		if p.PrivatePort != uint16(privatePort) || p.PublicPort == 0 || p.Type != "tcp" {
+			continue
+		}
+		hostIP := p.IP
+		if hostIP == "" || hostIP == "0.0.0.0" || hostIP == "::" {
+			hostIP = "127.0.0.1"
+		}
+		return net.JoinHostPort(hostIP, strconv.Itoa(int(p.PublicPort)))
+	}
+
+	return ""
+}
+
+func containerIP(c container.Summary) string {
+	if c.NetworkSettings == nil {
+		return ""
+	}
+
+	names := make([]string, 0, len(c.NetworkSettings.Networks))
+	for name := range c.NetworkSettings.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if ep := c.NetworkSettings.Networks[name]; ep != nil && ep.IPAddress != "" {
+			return ep.IPAddress
+		}
+	}
+	for _, name := range names {
+		if ep := c.NetworkSettings.Networks[name]; ep != nil && ep.GlobalIPv6Address != "" {
+			return ep.GlobalIPv6Address
+		}
+	}
+	return ""
+}
+
+func containerName(c container.Summary) string {
+	if len(c.Names) > 0 {
+		return strings.TrimPrefix(c.Names[0], "/")
+	}
+	return ""
+}
+
+func labelDuration(labels map[string]string, key string, def time.Duration) time.Duration {
+	if v, ok := labels[key]; ok {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return def
+}
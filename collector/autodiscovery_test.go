@@ -0,0 +1,72 @@
+package collector
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+)
+
+func TestDiscoverProbes(t *testing.T) {
+	bridge := &container.NetworkSettingsSummary{Networks: map[string]*network.EndpointSettings{
+		"bridge": {IPAddress: "172.17.0.2"},
+	}}
+	containers := []container.Summary{
+		{
+			ID: "aaaaaaaaaaaa1111", Names: []string{"/web"}, State: "running", NetworkSettings: bridge,
+			Labels: map[string]string{
+				"uptimeid.check.http":     "http://:8080/health",
+				"uptimeid.check.http.tls": "https://example.com/",
+				"uptimeid.check.interval": "15s",
+				"uptimeid.check.timeout":  "nonsense",
+				"uptimeid.check.grpc":     ":9000",
+				"uptimeid.logs.format":    "json",
+			},
+		},
+		{
+			ID: "bbbbbbbbbbbb2222", Names: []string{"/db"}, State: "running",
+			Labels: map[string]string{"uptimeid.check.tcp.db": ":5432"},
+		},
+		{
+			ID: "cccccccccccc3333", Names: []string{"/proxy"}, State: "running",
+			Ports: []container.Port{{PrivatePort: 8443, PublicPort: 18443, Type: "tcp", IP: "0.0.0.0"}},
+			Labels: map[string]string{
+				"uptimeid.check.tls":    ":8443",
+				"uptimeid.check.tcp.no": ":9999",      // not published, no address
+				"uptimeid.check.http.x": "ftp://:21/", // not HTTP
+			},
+		},
+		{
+			ID: "dddddddddddd4444", Names: []string{"/stopped"}, State: "exited", NetworkSettings: bridge,
+			Labels: map[string]string{"uptimeid.check.http": "http://:80/"},
+		},
+	}
+
+	containers[1].HostConfig.NetworkMode = "host"
+
+	specs := discoverProbes(containers)
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Key < specs[j].Key })
+	want := []probeSpec{
+		{Key: "aaaaaaaaaaaa/http", Container: "web", Probe: config.ProbeConfig{Name: "http", Type: "http",
+			Target: "http://172.17.0.2:8080/health", Interval: config.Duration(15 * time.Second), Timeout: config.Duration(defaultProbeTimeout)}},
+		{Key: "aaaaaaaaaaaa/http.tls", Container: "web", Probe: config.ProbeConfig{Name: "http.tls", Type: "http",
+			Target: "https://example.com:443/", Interval: config.Duration(15 * time.Second), Timeout: config.Duration(defaultProbeTimeout)}},
+		{Key: "bbbbbbbbbbbb/tcp.db", Container: "db", Probe: config.ProbeConfig{Name: "tcp.db", Type: "tcp",
+			Target: "127.0.0.1:5432", Interval: config.Duration(defaultProbeInterval), Timeout: config.Duration(defaultProbeTimeout)}},
+		{Key: "cccccccccccc/tls", Container: "proxy", Probe: config.ProbeConfig{Name: "tls", Type: "tls",
+			Target: "127.0.0.1:18443", Interval: config.Duration(defaultProbeInterval), Timeout: config.Duration(defaultProbeTimeout)}},
+	}
+	if len(specs) != len(want) {
+		t.Fatalf("specs = %+v", specs)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(specs[i], want[i]) {
+			t.Errorf("spec %d = %+v, want %+v", i, specs[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+)
+
+const (
+	defaultCertificateInterval = 1 * time.Hour
+	defaultCertificateTimeout  = 5 * time.Second
+	maxCertificateFiles        = 500
+)
+
+// certificateChecker checks the configured endpoints and files in the
+// background and keeps the latest results, so a slow or unreachable
+// endpoint never holds up a collection.
+type certificateChecker struct {
+	config   config.CertificatesConfig
+	interval time.Duration
+
+	mu    sync.Mutex
+	certs []models.CertificateInfo
+}
+
+var certificates *certificateChecker
+
+func startCertificateChecker(c config.CertificatesConfig) *certificateChecker {
+	if len(c.Endpoints) == 0 && len(c.Paths) == 0 {
+		return nil
+	}
+	r := &certificateChecker{config: c, interval: c.Interval.Or(defaultCertificateInterval)}
+	log.Printf("Certificate check scheduled: %d endpoints, %d paths every %v", len(c.Endpoints), len(c.Paths), r.interval)
+	go r.loop()
+	return r
+}
+
+func (r *certificateChecker) loop() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		certs := checkCertificates(r.config)
+		r.mu.Lock()
+		r.certs = certs
+		r.mu.Unlock()
+		<-ticker.C
+	}
+}
+
+// latest returns the results of the last check, nothing before the first
+// one completed.
+func (r *certificateChecker) latest() []models.CertificateInfo {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Expiry moves even when the certificates don't.
+	now := time.Now()
+	certs := make([]models.CertificateInfo, len(r.certs))
+	for i, c := range r.certs {
+		if c.NotAfter != 0 {
+			days := daysUntil(now, time.UnixMilli(c.NotAfter))
+			c.DaysRemaining = &days
+		}
+		certs[i] = c
+	}
+	return certs
+}
+
+func checkCertificates(cc config.CertificatesConfig) []models.CertificateInfo {
+	timeout := cc.Timeout.Or(defaultCertificateTimeout)
+
+	results := make([]models.CertificateInfo, len(cc.Endpoints))
+	var wg sync.WaitGroup
+	for i, e := range cc.Endpoints {
+		wg.Add(1)
+		go func(i int, e config.CertificateEndpoint) {
+			defer wg.Done()
+			results[i] = checkEndpointCertificate(e, timeout)
+		}(i, e)
+	}
+	wg.Wait()
+
+	for _, path := range certificateFiles(cc.Paths) {
+		if info, ok := checkFileCertificate(path); ok {
+			results = append(results, info)
+		}
+	}
+
+	return results
+}
+
+func checkEndpointCertificate(e config.CertificateEndpoint, timeout time.Duration) models.CertificateInfo {
+	info := models.CertificateInfo{
+		Source:    e.Target,
+		Type:      "endpoint",
+		CheckedAt: time.Now().UnixMilli(),
+	}
+
+	host, _, err := net.SplitHostPort(e.Target)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	serverName := e.ServerName
+	if serverName == "" {
+		serverName = host
+	}
+	info.ServerName = serverName
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Verification is done separately so an invalid chain still reports
+	// the expiry of what the server presented.
+	dialer := &tls.Dialer{Config: &tls.Config{ServerName: serverName, InsecureSkipVerify: true}}
+	conn, err := dialer.DialContext(ctx, "tcp", e.Target)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	defer conn.Close()
+
+	chain := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(chain) == 0 {
+		info.Error = "no certificate presented"
+		return info
+	}
+
+	fillCertificateInfo(&info, chain, serverName)
+	return info
+}
+
+func checkFileCertificate(path string) (models.CertificateInfo, bool) {
+	info := models.CertificateInfo{
+		Source:    path,
+		Type:      "file",
+		CheckedAt: time.Now().UnixMilli(),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		info.Error = err.Error()
+		return info, true
+	}
+
+	var chain []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			info.Error = err.Error()
+			return info, true
+		}
+		chain = append(chain, cert)
+	}
+
+	// Keys and other PEM files picked up by a directory scan are skipped.
+	if len(chain) == 0 {
+		return info, false
+	}
+
+	fillCertificateInfo(&info, chain, "")
+	return info, true
+}
+
+func fillCertificateInfo(info *models.CertificateInfo, chain []*x509.Certificate, dnsName string) {
+	leaf := chain[0]
+	info.Subject = leaf.Subject.String()
+	info.Issuer = leaf.Issuer.String()
+	info.SerialNumber = leaf.SerialNumber.Text(16)
+	info.NotBefore = leaf.NotBefore.UnixMilli()
+	info.NotAfter = leaf.NotAfter.UnixMilli()
+	days := daysUntil(time.Now(), leaf.NotAfter)
+	info.DaysRemaining = &days
+
+	info.SANs = append(info.SANs, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		info.SANs = append(info.SANs, ip.String())
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{DNSName: dnsName, Intermediates: intermediates}); err != nil {
+		info.ChainError = err.Error()
+	}
+}
+
+func daysUntil(now, t time.Time) float64 {
+	return t.Sub(now).Hours() / 24
+}
+
+// certificateFiles expands files, directories and globs into certificate
+// file paths.
+func certificateFiles(patterns []string) []string {
+	var files []string
+	seen := map[string]bool{}
+	add := func(path string) {
+		if !seen[path] && len(files) < maxCertificateFiles {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			log.Printf("Invalid certificate path %q: %v", pattern, err)
+			continue
+		}
+		for _, match := range matches {
+			st, err := os.Stat(match)
+			if err != nil {
+				continue
+			}
+			if !st.IsDir() {
+				add(match)
+				continue
+			}
+			err = filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return nil
+				}
+				if d.IsDir() {
+					return nil
+				}
+				switch strings.ToLower(filepath.Ext(path)) {
+				case ".pem", ".crt", ".cer", ".cert":
+					add(path)
+				}
+				if len(files) >= maxCertificateFiles {
+					return errStopWalk
+				}
+				return nil
+			})
+			if err != nil && !errors.Is(err, errStopWalk) {
+				log.Printf("Certificate scan %s: %v", match, err)
+			}
+		}
+	}
+
+	return files
+}
+
+var errStopWalk = errors.New("stop walk")
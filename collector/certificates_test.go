@@ -0,0 +1,224 @@
+package collector
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, cn string, notAfter time.Time, parent *testCert, dnsNames ...string) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		DNSNames:     dnsNames,
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+		tmpl.IPAddresses = nil
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func (c *testCert) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der})
+}
+
+func TestFillCertificateInfo(t *testing.T) {
+	ca := newTestCert(t, "Test CA", time.Now().Add(365*24*time.Hour), nil)
+	leaf := newTestCert(t, "web", time.Now().Add(10*24*time.Hour), ca, "example.com")
+
+	var info models.CertificateInfo
+	fillCertificateInfo(&info, []*x509.Certificate{leaf.cert, ca.cert}, "example.com")
+	if info.Subject != "CN=web" || info.Issuer != "CN=Test CA" || info.SerialNumber != leaf.cert.SerialNumber.Text(16) {
+		t.Errorf("info = %+v", info)
+	}
+	if strings.Join(info.SANs, ",") != "example.com,127.0.0.1" || info.NotAfter != leaf.cert.NotAfter.UnixMilli() {
+		t.Errorf("SANs %v, NotAfter %d", info.SANs, info.NotAfter)
+	}
+	if info.DaysRemaining == nil || *info.DaysRemaining < 9.9 || *info.DaysRemaining > 10 {
+		t.Errorf("DaysRemaining = %v", info.DaysRemaining)
+	}
+	// Signed by a CA outside the system pool.
+	if !strings.Contains(info.ChainError, "unknown authority") {
+		t.Errorf("ChainError = %q", info.ChainError)
+	}
+
+	var expired models.CertificateInfo
+	old := newTestCert(t, "old", time.Now().Add(-48*time.Hour), ca)
+	fillCertificateInfo(&expired, []*x509.Certificate{old.cert}, "")
+	if expired.DaysRemaining == nil || *expired.DaysRemaining > -1.9 {
+		t.Errorf("expired DaysRemaining = %v", expired.DaysRemaining)
+	}
+}
+
+func TestCertificateFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.pem", "b.CRT", "sub/c.cer", "sub/deep/d.cert", "key.key", "notes.txt"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rel := func(files []string) string {
+		var out []string
+		for _, f := range files {
+			r, _ := filepath.Rel(dir, f)
+			out = append(out, filepath.ToSlash(r))
+		}
+		sort.Strings(out)
+		return strings.Join(out, " ")
+	}
+
+	if got := rel(certificateFiles([]string{dir})); got != "a.pem b.CRT sub/c.cer sub/deep/d.cert" {
+		t.Errorf("directory = %q", got)
+	}
+	// Named files are taken whatever their extension; duplicates once.
+	if got := rel(certificateFiles([]string{filepath.Join(dir, "*.txt"), filepath.Join(dir, "a.pem"), dir + "/a.*"})); got != "a.pem notes.txt" {
+		t.Errorf("globs = %q", got)
+	}
+	if got := certificateFiles([]string{filepath.Join(dir, "missing.pem"), "[bad"}); len(got) != 0 {
+		t.Errorf("missing = %v", got)
+	}
+}
+
+func TestCheckFileCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "Test CA", time.Now().Add(24*time.Hour), nil)
+	leaf := newTestCert(t, "web", time.Now().Add(time.Hour), ca)
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte("x")})
+	info, ok := checkFileCertificate(write("chain.pem", append(append(keyPEM, leaf.pem()...), ca.pem()...)))
+	if !ok || info.Subject != "CN=web" || info.Type != "file" || info.DaysRemaining == nil || info.Error != "" {
+		t.Errorf("chain = %+v, %v", info, ok)
+	}
+	if _, ok := checkFileCertificate(write("only.key", keyPEM)); ok {
+		t.Error("key file reported")
+	}
+	bad := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("garbage")})
+	if info, ok := checkFileCertificate(write("bad.pem", bad)); !ok || info.Error == "" || info.DaysRemaining != nil {
+		t.Errorf("bad = %+v, %v", info, ok)
+	}
+	if info, ok := checkFileCertificate(filepath.Join(dir, "gone.pem")); !ok || info.Error == "" {
+		t.Errorf("missing = %+v, %v", info, ok)
+	}
+}
+
+func TestCheckEndpointCertificate(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+
+	info := checkEndpointCertificate(config.CertificateEndpoint{Target: addr, ServerName: "example.com"}, 5*time.Second)
+	if info.Error != "" || info.ServerName != "example.com" || info.DaysRemaining == nil || info.ChainError == "" {
+		t.Errorf("endpoint = %+v", info)
+	}
+
+	// A closed port: no expiry is known, and none is sent.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := ln.Addr().String()
+	ln.Close()
+	failed := checkEndpointCertificate(config.CertificateEndpoint{Target: closed}, time.Second)
+	if failed.Error == "" || failed.DaysRemaining != nil || failed.ServerName != "127.0.0.1" {
+		t.Errorf("failed = %+v", failed)
+	}
+	data, _ := json.Marshal(failed)
+	if strings.Contains(string(data), "daysRemaining") {
+		t.Errorf("failed endpoint encodes %s", data)
+	}
+
+	if info := checkEndpointCertificate(config.CertificateEndpoint{Target: "no-port"}, time.Second); info.Error == "" {
+		t.Errorf("bad target = %+v", info)
+	}
+}
+
+func TestCertificateChecker(t *testing.T) {
+	if startCertificateChecker(config.CertificatesConfig{}) != nil {
+		t.Error("checker started without certificates")
+	}
+	var nilChecker *certificateChecker
+	if nilChecker.latest() != nil {
+		t.Error("nil checker returned results")
+	}
+
+	// A blackholed endpoint doesn't hold up the file results: nothing is
+	// reported until the check completes, without blocking.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	path := filepath.Join(t.TempDir(), "c.pem")
+	ca := newTestCert(t, "Test CA", time.Now().Add(24*time.Hour), nil)
+	os.WriteFile(path, ca.pem(), 0o644)
+
+	r := startCertificateChecker(config.CertificatesConfig{
+		Timeout:   config.Duration(300 * time.Millisecond),
+		Endpoints: []config.CertificateEndpoint{{Target: ln.Addr().String()}},
+		Paths:     []string{path},
+	})
+	start := time.Now()
+	if got := r.latest(); len(got) != 0 || time.Since(start) > 100*time.Millisecond {
+		t.Errorf("latest before the first check = %+v after %v", got, time.Since(start))
+	}
+	var certs []models.CertificateInfo
+	for deadline := time.Now().Add(5 * time.Second); len(certs) == 0 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		certs = r.latest()
+	}
+	if len(certs) != 2 || certs[0].Error == "" || certs[1].Subject != "CN=Test CA" || certs[1].DaysRemaining == nil {
+		t.Errorf("certs = %+v", certs)
+	}
+}
@@ -0,0 +1,319 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+)
+
+const (
+	defaultCheckInterval    = 60 * time.Second
+	defaultCheckConcurrency = 4
+	maxCheckMessageSize     = 1024
+	maxCheckOutputSize      = 16 * 1024
+)
+
+// Nagios plugin exit codes.
+var checkStates = []string{"ok", "warning", "critical", "unknown"}
+
+// checkRunner runs the configured plugins on their own schedules and keeps
+// the latest result of each.
+type checkRunner struct {
+	checks []config.CheckConfig
+	sem    chan struct{}
+
+	mu      sync.Mutex
+	results map[string]models.CheckResult
+}
+
+var checks *checkRunner
+
+func startChecks(c config.ChecksConfig) *checkRunner {
+	if len(c.Commands) == 0 {
+		return nil
+	}
+	concurrency := c.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultCheckConcurrency
+	}
+	r := &checkRunner{
+		checks:  c.Commands,
+		sem:     make(chan struct{}, concurrency),
+		results: map[string]models.CheckResult{},
+	}
+	for _, check := range c.Commands {
+		log.Printf("Check scheduled: %s every %v", check.Name, check.Interval.Or(defaultCheckInterval))
+		go r.loop(check)
+	}
+	return r
+}
+
+func (r *checkRunner) loop(check config.CheckConfig) {
+	ticker := time.NewTicker(check.Interval.Or(defaultCheckInterval))
+	defer ticker.Stop()
+	for {
+		r.sem <- struct{}{}
+		result := executeCheck(check)
+		<-r.sem
+
+		r.mu.Lock()
+		r.results[check.Name] = result
+		r.mu.Unlock()
+		<-ticker.C
+	}
+}
+
+// latest returns the last result of every check that has run, in config
+// order.
+func (r *checkRunner) latest() []models.CheckResult {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	results := make([]models.CheckResult, 0, len(r.results))
+	for _, check := range r.checks {
+		if result, ok := r.results[check.Name]; ok {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+func executeCheck(check config.CheckConfig) models.CheckResult {
+	timeout := check.Timeout.Or(cmdTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	out, stderr, err := runCmdContext(ctx, checkEnv(check.Env), check.Command[0], check.Command[1:]...)
+	result := models.CheckResult{
+		Name:      check.Name,
+		Duration:  millis(time.Since(start)),
+		CheckedAt: start.UnixMilli(),
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return checkFailed(result, fmt.Sprintf("timed out after %v", timeout))
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+		if result.ExitCode < 0 {
+			return checkFailed(result, exitErr.Error())
+		}
+	case err != nil:
+		return checkFailed(result, err.Error())
+	}
+
+	// Plugins report on stdout; stderr only explains a silent one, as in
+	// Nagios.
+	if strings.TrimSpace(out) == "" {
+		result.State = checkState(result.ExitCode)
+		result.Message = truncateString("(No output on stdout) "+strings.TrimSpace(stderr), maxCheckMessageSize)
+		return result
+	}
+	if check.Format == "json" {
+		if err := parseCheckJSON(out, &result); err != nil {
+			return checkFailed(result, "invalid JSON output: "+err.Error())
+		}
+	} else {
+		result.State = checkState(result.ExitCode)
+		result.Message, result.Output, result.Metrics = parseNagiosOutput(out)
+	}
+	result.Message = truncateString(result.Message, maxCheckMessageSize)
+	result.Output = truncateString(result.Output, maxCheckOutputSize)
+	return result
+}
+
+func checkFailed(result models.CheckResult, message string) models.CheckResult {
+	result.State = "unknown"
+	result.ExitCode = 3
+	result.Message = message
+	return result
+}
+
+func checkState(code int) string {
+	if code >= 0 && code < len(checkStates) {
+		return checkStates[code]
+	}
+	return "unknown"
+}
+
+// checkEnv is the whole environment a plugin sees, so agent credentials and
+// other settings don't leak into scripts.
+func checkEnv(extra map[string]string) []string {
+	env := []string{"LANG=C"}
+	if runtime.GOOS == "windows" {
+		for _, k := range []string{"PATH", "SystemRoot", "TEMP", "TMP"} {
+			if v, ok := os.LookupEnv(k); ok {
+				env = append(env, k+"="+v)
+			}
+		}
+	} else {
+		env = append(env, "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin")
+	}
+
+	keys := make([]string, 0, len(extra))
+	for k := range extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, k+"="+extra[k])
+	}
+	return env
+}
+
+// parseNagiosOutput splits plugin output into the status line, the long
+// output and the perfdata, which follows a "|" on the first line and on the
+// long output line holding the second "|" and all lines after it.
+func parseNagiosOutput(out string) (string, string, []models.CheckMetric) {
+	lines := strings.Split(strings.TrimRight(strings.ReplaceAll(out, "\r\n", "\n"), "\n"), "\n")
+	message, perfdata, _ := strings.Cut(lines[0], "|")
+
+	var long []string
+	for i, line := range lines[1:] {
+		if text, perf, ok := strings.Cut(line, "|"); ok {
+			long = append(long, text)
+			perfdata += " " + perf + " " + strings.Join(lines[i+2:], " ")
+			break
+		}
+		long = append(long, line)
+	}
+	return strings.TrimSpace(message), strings.TrimSpace(strings.Join(long, "\n")), parsePerfdata(perfdata)
+}
+
+// parsePerfdata reads "'label'=value[UOM];[warn];[crit];[min];[max]" items
+// separated by spaces. Labels may be quoted to hold spaces, with a doubled
+// quote standing for one.
+func parsePerfdata(s string) []models.CheckMetric {
+	var metrics []models.CheckMetric
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return metrics
+		}
+
+		var label string
+		if s[0] == '\'' {
+			var b strings.Builder
+			i := 1
+			for ; i < len(s); i++ {
+				if s[i] == '\'' {
+					if i+1 < len(s) && s[i+1] == '\'' {
+						b.WriteByte('\'')
+						i++
+						continue
+					}
+					break
+				}
+				b.WriteByte(s[i])
+			}
+			if i+1 >= len(s) || s[i+1] != '=' {
+				return metrics
+			}
+			label, s = b.String(), s[i+1:]
+		} else {
+			eq := strings.IndexByte(s, '=')
+			if eq < 0 {
+				return metrics
+			}
+			label, s = s[:eq], s[eq:]
+		}
+		s = s[1:] // "="
+
+		item := s
+		if sp := strings.IndexAny(s, " \t"); sp >= 0 {
+			item, s = s[:sp], s[sp:]
+		} else {
+			s = ""
+		}
+		if m, ok := parsePerfValue(label, item); ok {
+			metrics = append(metrics, m)
+		}
+	}
+}
+
+func parsePerfValue(label, item string) (models.CheckMetric, bool) {
+	parts := strings.Split(item, ";")
+	value := parts[0]
+	end := len(value)
+	for end > 0 && !strings.ContainsRune("0123456789.", rune(value[end-1])) {
+		end--
+	}
+	v, err := strconv.ParseFloat(strings.Replace(value[:end], ",", ".", 1), 64)
+	if err != nil {
+		return models.CheckMetric{}, false // "U" means the value could not be determined
+	}
+
+	m := models.CheckMetric{Label: label, Value: v, Unit: value[end:]}
+	field := func(i int) string {
+		if i < len(parts) {
+			return parts[i]
+		}
+		return ""
+	}
+	m.Warn, m.Crit = field(1), field(2)
+	if f, err := strconv.ParseFloat(field(3), 64); err == nil {
+		m.Min = &f
+	}
+	if f, err := strconv.ParseFloat(field(4), 64); err == nil {
+		m.Max = &f
+	}
+	return m, true
+}
+
+// parseCheckJSON reads {"state": "ok"|0..3, "message": "...", "output":
+// "...", "metrics": [{"label", "value", "unit", ...}]}. Without a state the
+// exit code decides.
+func parseCheckJSON(out string, result *models.CheckResult) error {
+	var doc struct {
+		State   any                  `json:"state"`
+		Message string               `json:"message"`
+		Output  string               `json:"output"`
+		Metrics []models.CheckMetric `json:"metrics"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out)), &doc); err != nil {
+		return err
+	}
+
+	result.State = checkState(result.ExitCode)
+	switch state := doc.State.(type) {
+	case float64:
+		result.State = checkState(int(state))
+	case string:
+		switch strings.ToLower(state) {
+		case "ok":
+			result.State = "ok"
+		case "warn", "warning":
+			result.State = "warning"
+		case "crit", "critical":
+			result.State = "critical"
+		default:
+			result.State = "unknown"
+		}
+	}
+	result.Message, result.Output, result.Metrics = doc.Message, doc.Output, doc.Metrics
+	return nil
+}
+
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
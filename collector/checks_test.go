@@ -0,0 +1,137 @@
+package collector
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+)
+
+func perfString(metrics []models.CheckMetric) string {
+	var items []string
+	for _, m := range metrics {
+		bound := func(f *float64) string {
+			if f == nil {
+				return ""
+			}
+			return fmt.Sprint(*f)
+		}
+		items = append(items, fmt.Sprintf("%s=%v%s;%s;%s;%s;%s", m.Label, m.Value, m.Unit, m.Warn, m.Crit, bound(m.Min), bound(m.Max)))
+	}
+	return strings.Join(items, " | ")
+}
+
+func TestParsePerfdata(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"time=0.5s;1;2;0;10", "time=0.5s;1;2;0;10"},
+		{"'disk /'=80%;90;95", "disk /=80%;90;95;;"},
+		{"'it''s'=1", "it's=1;;;;"},
+		{"load1=0,5 load5=0.25", "load1=0.5;;;; | load5=0.25;;;;"},
+		{"  a=1\tb=2c  ", "a=1;;;; | b=2c;;;;"},
+		{"size=10KB;;;0", "size=10KB;;;0;"},
+		{"rta=U b=2", "b=2;;;;"},
+		{"ratio=NaN", ""},
+		{"warn=5;@10:20;~:30", "warn=5;@10:20;~:30;;"},
+		{"a=1 'unterminated=2", "a=1;;;;"},
+		{"a=1 noequals", "a=1;;;;"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := perfString(parsePerfdata(tt.in)); got != tt.want {
+			t.Errorf("parsePerfdata(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseNagiosOutput(t *testing.T) {
+	tests := []struct {
+		name, in, message, long, perf string
+	}{
+		{"status only", "PING OK\n", "PING OK", "", ""},
+		{"status with perfdata", "PING OK - rta 1ms | rta=1ms;5;10;0\r\n", "PING OK - rta 1ms", "", "rta=1ms;5;10;0;"},
+		{
+			name: "long output and trailing perfdata",
+			in: "DISK OK - free space: / 3326 MB | /=2643MB;5948;5958;0;5968\n" +
+				"/ 15272 MB (77%);\n/boot 68 MB (69%); | /boot=68MB;88;93;0;98\n/home=69357MB\n",
+			message: "DISK OK - free space: / 3326 MB",
+			long:    "/ 15272 MB (77%);\n/boot 68 MB (69%);",
+			perf:    "/=2643MB;5948;5958;0;5968 | /boot=68MB;88;93;0;98 | /home=69357MB;;;;",
+		},
+		{"long output without perfdata", "WARNING\nline 1\nline 2", "WARNING", "line 1\nline 2", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, long, metrics := parseNagiosOutput(tt.in)
+			if message != tt.message || long != tt.long || perfString(metrics) != tt.perf {
+				t.Errorf("got %q, %q, %q", message, long, perfString(metrics))
+			}
+		})
+	}
+}
+
+func TestParseCheckJSON(t *testing.T) {
+	tests := []struct {
+		out       string
+		exitCode  int
+		wantState string
+	}{
+		{`{"state":"ok"}`, 2, "ok"},
+		{`{"state":"WARN"}`, 0, "warning"},
+		{`{"state":"crit"}`, 0, "critical"},
+		{`{"state":"bogus"}`, 0, "unknown"},
+		{`{"state":2}`, 0, "critical"},
+		{`{"state":7}`, 0, "unknown"},
+		{`{}`, 1, "warning"},
+	}
+	for _, tt := range tests {
+		result := models.CheckResult{ExitCode: tt.exitCode}
+		if err := parseCheckJSON(tt.out, &result); err != nil || result.State != tt.wantState {
+			t.Errorf("parseCheckJSON(%s) = %q, %v, want %q", tt.out, result.State, err, tt.wantState)
+		}
+	}
+
+	var result models.CheckResult
+	out := ` {"message":"m","output":"o","metrics":[{"label":"x","value":1.5,"unit":"s","min":0}]}` + "\n"
+	if err := parseCheckJSON(out, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Message != "m" || result.Output != "o" || perfString(result.Metrics) != "x=1.5s;;;0;" {
+		t.Errorf("result = %+v", result)
+	}
+	if err := parseCheckJSON("OK - not JSON", &result); err == nil {
+		t.Error("plain text accepted")
+	}
+}
+
+func TestExecuteCheck(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	check := func(script string) models.CheckResult {
+		return executeCheck(config.CheckConfig{Name: "c", Command: []string{"sh", "-c", script},
+			Timeout: config.Duration(time.Second), Env: map[string]string{"GREETING": "hi"}})
+	}
+
+	if r := check(`echo "WARNING - $GREETING | a=1"; exit 1`); r.State != "warning" || r.ExitCode != 1 ||
+		r.Message != "WARNING - hi" || len(r.Metrics) != 1 {
+		t.Errorf("warning = %+v", r)
+	}
+	if r := check(`echo oops >&2; exit 2`); r.State != "critical" || r.Message != "(No output on stdout) oops" {
+		t.Errorf("silent plugin = %+v", r)
+	}
+	if r := check(`exit 9`); r.State != "unknown" || r.ExitCode != 9 {
+		t.Errorf("odd exit code = %+v", r)
+	}
+	if r := check(`sleep 5`); r.State != "unknown" || !strings.HasPrefix(r.Message, "timed out") {
+		t.Errorf("timeout = %+v", r)
+	}
+	if r := check(`head -c 100000 /dev/zero | tr '\0' x; echo; echo more`); len(r.Message) != maxCheckMessageSize || r.Output != "more" {
+		t.Errorf("long status line: %d bytes, output %q", len(r.Message), r.Output)
+	}
+}
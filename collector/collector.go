@@ -1,17 +1,66 @@
 package collector
 
 import (
+	"log"
 	"os"
 	"runtime"
+	"sync"
 	"time"
 
+	"github.com/uptime-id/agent/config"
 	"github.com/uptime-id/agent/models"
 )
 
-func CollectMetrics() (*models.Metric, error) {
+var (
+	setupOnce sync.Once
+
+	// collectMu serializes collections and log position commits, as the
+	// collectors keep unguarded state between runs.
+	collectMu sync.Mutex
+)
+
+// setup initializes the stateful collectors on first use.
+func setup(cfg *config.Config) {
+	redaction = newRedactor(cfg.Redaction)
+	events = newEventDetector(cfg.Events)
+	prometheus = startPromScraper(cfg.Prometheus)
+	certificates = startCertificateChecker(cfg.Certificates)
+	checks = startChecks(cfg.Checks)
+	textfiles = newTextfileCollector(cfg.Textfile)
+	processWatches = newProcessWatchlist(cfg.Processes.Watch)
+
+	state := newStateStore(cfg.StateDir)
+	hasJournal := len(journalFiles(journalDirs)) > 0
+	if hasJournal {
+		journal = newJournalReader(journalDirs, state)
+		var err error
+		if journalMultiline, err = newMultilineRule(cfg.Journal.Multiline); err != nil {
+			log.Printf("Journal: %v, shipping entries unjoined", err)
+		}
+	}
+	containerCursors = newContainerLogCursors(state)
+	tailer = newFileTailer(logTailSources(cfg, hasJournal), state)
+
+	var err error
+	if syslogReceiver, err = startSyslogServer(cfg.Syslog, cfg.MaxLogSize); err != nil {
+		log.Printf("Syslog receiver disabled: %v", err)
+	}
+	if otlpReceiver, err = startOTLPServer(cfg.OTLP); err != nil {
+		log.Printf("OTLP receiver disabled: %v", err)
+	}
+	if statsdReceiver, err = startStatsDServer(cfg.StatsD); err != nil {
+		log.Printf("StatsD server disabled: %v", err)
+	}
+}
+
+func CollectMetrics(cfg *config.Config) (*models.Metric, error) {
+	collectMu.Lock()
+	defer collectMu.Unlock()
+
 	timestamp := time.Now()
 	currentOS := runtime.GOOS
 	caps := DetectCapabilities()
+	setupOnce.Do(func() { setup(cfg) })
 
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -34,29 +83,110 @@ func CollectMetrics() (*models.Metric, error) {
 
 	// Network
 	metric.Network = collectNetworkInfo()
+	metric.NetStack = netStack.collect(timestamp)
+
+	// Probes
+	probes.sync(probeGroupConfig, configuredProbes(cfg))
 
-	// Latency
-	metric.Latency = collectLatency()
+	// TLS certificate expiry
+	metric.Certificates = certificates.latest()
 
 	// Optional: Docker containers (needs /var/run/docker.sock)
+	var containerLogs []models.LogRecord
 	if caps.HasDockerSocket {
-		metric.Containers = collectDockerContainers()
+		metric.Containers, containerLogs = collectDockerContainers()
+		if cfg.KubernetesMode {
+			enrichKubernetes(cfg, metric.Containers)
+		}
+		metric.DockerDisk = dockerDisk.collect()
 	}
 
 	// Optional: System logs (needs journal or /var/log mount)
-	if caps.HasJournal || caps.HasHostLogs {
-		metric.Logs = collectSystemLogs(currentOS)
+	if caps.HasJournal || caps.HasHostLogs || len(cfg.LogFiles) > 0 {
+		// Half the send limit, leaving room for the other sources and for
+		// the record fields, so what is read is not truncated before it is
+		// sent.
+		metric.Logs = collectSystemLogs(currentOS, int64(cfg.MaxLogSize/2))
+	}
+	metric.Logs.Records = append(metric.Logs.Records, containerLogs...)
+	metric.Logs.Records = append(metric.Logs.Records, logEvents.expired(time.Now())...)
+	received, dropped := syslogReceiver.drain()
+	metric.Logs.Records = append(metric.Logs.Records, received...)
+	metric.Logs.Dropped += dropped
+	received, dropped, metric.CustomMetrics, metric.Spans, metric.SpansDropped = otlpReceiver.drain()
+	metric.Logs.Records = append(metric.Logs.Records, received...)
+	metric.Logs.Dropped += dropped
+	metric.Events = events.detect(metric.Logs.Records)
+	if currentOS != "windows" {
+		metric.Security = collectSecurity(metric.Logs.Records)
 	}
 
+	// Application metrics pushed over StatsD
+	metric.CustomMetrics = append(metric.CustomMetrics, statsdReceiver.drain(time.Now())...)
+
+	// Prometheus exporters
+	metric.CustomMetrics = append(metric.CustomMetrics, prometheus.latest()...)
+
+	// Metric files written by cron jobs and scripts
+	fileMetrics, textfileInfo := textfiles.collect(time.Now())
+	metric.CustomMetrics = append(metric.CustomMetrics, fileMetrics...)
+	metric.Textfiles = textfileInfo
+
 	// Optional: Host processes (needs pid: host)
 	if caps.HasHostPID {
-		metric.Processes = collectTopProcesses()
+		procs := processes.refresh(timestamp)
+		metric.Processes = collectTopProcesses(procs, cfg.Processes)
+		metric.ProcessGroups = processWatches.collect(procs)
+		metric.Events = append(metric.Events, processGroupEvents(metric.ProcessGroups, timestamp)...)
 	}
 
+	// Listening sockets and TCP connection states (Linux)
+	var socketEvents []models.LogEvent
+	metric.Sockets, socketEvents = sockets.collect(timestamp)
+	metric.Events = append(metric.Events, socketEvents...)
+
 	// Optional: Systemd services (needs D-Bus socket)
 	if caps.HasDBus {
 		metric.Services = collectServices(currentOS)
 	}
 
+	metric.Probes = probes.results()
+	metric.Checks = checks.latest()
+	metric.Latency = latencyFromProbes(metric.Probes)
+
+	redaction.apply(metric)
+
 	return metric, nil
 }
+
+// CommitLogPositions persists how far the log sources have been read, once
+// the payload holding those lines was delivered.
+func CommitLogPositions() {
+	collectMu.Lock()
+	defer collectMu.Unlock()
+	if journal != nil {
+		journal.commit()
+	}
+	if tailer != nil {
+		tailer.commit()
+	}
+	containerCursors.commit()
+	logEvents.commit()
+	syslogReceiver.commit()
+}
+
+// RewindLogPositions makes the next collection read the lines of a payload
+// that couldn't be delivered again.
+func RewindLogPositions() {
+	collectMu.Lock()
+	defer collectMu.Unlock()
+	if journal != nil {
+		journal.rewind()
+	}
+	if tailer != nil {
+		tailer.rewind()
+	}
+	containerCursors.rewind()
+	logEvents.rewind()
+	syslogReceiver.rewind()
+}
@@ -41,7 +41,7 @@ func DetectCapabilities() Capabilities {
 		logCap("Docker", caps.HasDockerSocket, "(container monitoring)")
 		logCap("Host PID", caps.HasHostPID, "(process listing)")
 		logCap("D-Bus", caps.HasDBus, "(systemd services)")
-		logCap("Journal", caps.HasJournal, "(system logs via journalctl)")
+		logCap("Journal", caps.HasJournal, "(native journal reader)")
 		logCap("Host Logs", caps.HasHostLogs, "(log files (/var/log))")
 		log.Println("╰───────────────────────────────────────────────────────────╯")
 	})
@@ -78,7 +78,7 @@ func detectHostPID() bool {
 }
 
 func detectJournal() bool {
-	return fileExists("/run/log/journal")
+	return len(journalFiles(journalDirs)) > 0
 }
 
 func detectHostLogs() bool {
@@ -1,15 +1,19 @@
 package collector
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
 	"log"
+	"maps"
 	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/uptime-id/agent/models"
 
-	"bytes"
-
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
@@ -18,16 +22,78 @@ import (
 const maxTotalContainerLogSize = 500 * 1024
 const maxPerContainerLogSize = 50 * 1024
 
-func collectDockerContainers() []models.ContainerInfo {
+const (
+	containerStateName     = "containers"
+	containerBackfillLines = "50"
+)
+
+// containerLogCursors remembers the timestamp of the newest log line read
+// per container, so each tick fetches only what is new instead of a fixed
+// tail that cuts stack traces in half. Like the tailer, it reads ahead of
+// what has been delivered: since is where the next read starts, committed
+// what was last acknowledged and persisted.
+type containerLogCursors struct {
+	state     *stateStore
+	since     map[string]int64 // unix ns
+	committed map[string]int64
+}
+
+var containerCursors = &containerLogCursors{since: map[string]int64{}, committed: map[string]int64{}}
+
+func newContainerLogCursors(state *stateStore) *containerLogCursors {
+	c := &containerLogCursors{state: state, since: map[string]int64{}}
+	state.load(containerStateName, &c.since)
+	c.committed = maps.Clone(c.since)
+	return c
+}
+
+// prune drops cursors of removed containers.
+func (c *containerLogCursors) prune(containerList []container.Summary) {
+	ids := map[string]bool{}
+	for _, ctr := range containerList {
+		ids[ctr.ID] = true
+	}
+	for id := range c.since {
+		if !ids[id] {
+			delete(c.since, id)
+		}
+	}
+}
+
+// commit persists the cursors of everything read so far, once it has been
+// delivered.
+func (c *containerLogCursors) commit() {
+	c.committed = maps.Clone(c.since)
+	if c.state != nil {
+		c.state.save(containerStateName, c.committed)
+	}
+}
+
+// rewind goes back to the committed cursors, so lines whose delivery failed
+// are read again.
+func (c *containerLogCursors) rewind() {
+	c.since = maps.Clone(c.committed)
+}
+
+// collectDockerContainers lists the containers and reads their new log
+// lines, up to maxPerContainerLogSize bytes per container and, across them,
+// about maxTotalContainerLogSize. Lines past either limit are left for the
+// next ticks.
+func collectDockerContainers() ([]models.ContainerInfo, []models.LogRecord) {
 	containers := []models.ContainerInfo{}
+	var records []models.LogRecord
+	// Without a container list the discovered probes would keep probing
+	// containers that may be gone.
 	if _, err := os.Stat("/var/run/docker.sock"); err != nil {
-		return containers
+		probes.sync(probeGroupContainer, nil)
+		return containers, nil
 	}
 
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
 		log.Printf("Docker client error: %v", err)
-		return containers
+		probes.sync(probeGroupContainer, nil)
+		return containers, nil
 	}
 	defer cli.Close()
 
@@ -35,24 +101,26 @@ func collectDockerContainers() []models.ContainerInfo {
 	containerList, err := cli.ContainerList(ctx, container.ListOptions{All: true})
 	if err != nil {
 		log.Printf("Docker list error: %v", err)
-		return containers
+		probes.sync(probeGroupContainer, nil)
+		return containers, nil
 	}
 
+	probes.sync(probeGroupContainer, discoverProbes(containerList))
+
 	totalLogSize := 0
 
 	for _, c := range containerList {
-		name := ""
-		if len(c.Names) > 0 {
-			name = strings.TrimPrefix(c.Names[0], "/")
-		}
-
-		logs := ""
-		if totalLogSize < maxTotalContainerLogSize {
-			logs = collectContainerLogs(cli, c.ID)
-			if len(logs) > maxPerContainerLogSize {
-				logs = logs[:maxPerContainerLogSize] + "\n[TRUNCATED]"
+		name := containerName(c)
+
+		if totalLogSize < maxTotalContainerLogSize && !logsExcluded(c) {
+			parser, rule := containerLogFormat(c), containerMultiline(c)
+			for _, line := range collectContainerLogs(cli, c.ID, name) {
+				key := "container:" + c.ID + ":" + line.Fields["stream"]
+				for _, rec := range logEvents.add(key, rule, parser, line) {
+					totalLogSize += rec.Size()
+					records = append(records, rec)
+				}
 			}
-			totalLogSize += len(logs)
 		}
 
 		containers = append(containers, models.ContainerInfo{
@@ -62,30 +130,88 @@ func collectDockerContainers() []models.ContainerInfo {
 			Status:  c.Status,
 			State:   c.State,
 			Created: c.Created,
-			Logs:    logs,
 		})
 	}
 
-	return containers
+	containerCursors.prune(containerList)
+	return containers, records
 }
 
-func collectContainerLogs(cli *client.Client, containerID string) string {
+func collectContainerLogs(cli *client.Client, containerID, name string) []models.LogRecord {
 	ctx := context.Background()
 
 	options := container.LogsOptions{
 		ShowStdout: true,
 		ShowStderr: true,
-		Tail:       "50",
+		Timestamps: true,
+		Tail:       containerBackfillLines,
+	}
+	since, seen := containerCursors.since[containerID]
+	if seen {
+		// Since is inclusive; start just after the last line read.
+		since++
+		options.Since = fmt.Sprintf("%d.%09d", since/1e9, since%1e9)
+		options.Tail = "all"
 	}
 
 	reader, err := cli.ContainerLogs(ctx, containerID, options)
 	if err != nil {
-		return ""
+		return nil
 	}
 	defer reader.Close()
 
-	var buf bytes.Buffer
-	_, _ = stdcopy.StdCopy(&buf, &buf, reader)
+	records, newest := readContainerLogs(reader, name, maxPerContainerLogSize)
+	if newest > 0 {
+		containerCursors.since[containerID] = newest
+	} else if !seen {
+		// Where reading starts is not a delivery: keep it across a rewind.
+		containerCursors.since[containerID] = time.Now().UnixNano()
+		containerCursors.committed[containerID] = containerCursors.since[containerID]
+	}
+	return records
+}
+
+// readContainerLogs demultiplexes up to limit bytes of a log stream into
+// records in time order and returns the newest timestamp in unix ns. StdCopy
+// drops the frame cut by the limit, one line each as timestamps are on, so
+// the cursor only moves past complete lines and the rest of a burst is read
+// on the next ticks.
+func readContainerLogs(r io.Reader, name string, limit int64) ([]models.LogRecord, int64) {
+	var stdout, stderr bytes.Buffer
+	_, _ = stdcopy.StdCopy(&stdout, &stderr, io.LimitReader(r, limit))
+
+	records, newest := containerLogRecords(stdout.String(), "stdout", name)
+	errRecords, newestErr := containerLogRecords(stderr.String(), "stderr", name)
+	records = append(records, errRecords...)
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Timestamp < records[j].Timestamp })
+	return records, max(newest, newestErr)
+}
 
-	return buf.String()
+// containerLogRecords splits Docker log output with timestamps enabled
+// ("2024-01-02T03:04:05.123456789Z message") into records and returns the
+// newest timestamp in unix ns.
+func containerLogRecords(out, stream, name string) ([]models.LogRecord, int64) {
+	var records []models.LogRecord
+	var newest int64
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			continue
+		}
+		rec := models.LogRecord{
+			Source:    "container",
+			Input:     "docker",
+			Container: name,
+			Message:   line,
+			Fields:    map[string]string{"stream": stream},
+		}
+		if ts, msg, ok := strings.Cut(line, " "); ok {
+			if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+				rec.Timestamp, rec.Message = t.UnixMilli(), msg
+				newest = max(newest, t.UnixNano())
+			}
+		}
+		records = append(records, rec)
+	}
+	return records, newest
 }
@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/uptime-id/agent/models"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+func TestReadContainerLogs(t *testing.T) {
+	var stream bytes.Buffer
+	stdout := stdcopy.NewStdWriter(&stream, stdcopy.Stdout)
+	stderr := stdcopy.NewStdWriter(&stream, stdcopy.Stderr)
+	base := time.Date(2024, 3, 5, 14, 7, 9, 0, time.UTC)
+	for i := range 100 {
+		w := stdout
+		if i%10 == 9 {
+			w = stderr
+		}
+		fmt.Fprintf(w, "%s line %03d\n", base.Add(time.Duration(i)*time.Millisecond).Format(time.RFC3339Nano), i)
+	}
+	raw := stream.Bytes()
+
+	records, newest := readContainerLogs(bytes.NewReader(raw), "web", int64(len(raw)))
+	if len(records) != 100 || newest != base.Add(99*time.Millisecond).UnixNano() {
+		t.Fatalf("read %d records, newest %d", len(records), newest)
+	}
+	for i, rec := range records {
+		if rec.Message != fmt.Sprintf("line %03d", i) {
+			t.Fatalf("record %d = %q, want them in time order", i, rec.Message)
+		}
+	}
+	if records[9].Fields["stream"] != "stderr" || records[10].Fields["stream"] != "stdout" {
+		t.Errorf("streams = %v, %v", records[9].Fields, records[10].Fields)
+	}
+
+	// A limit in the middle of a frame keeps the complete lines only, and
+	// the cursor stops at the last of them.
+	records, newest = readContainerLogs(bytes.NewReader(raw), "web", int64(len(raw)/2+5))
+	last := records[len(records)-1]
+	if len(records) >= 100 || last.Message != fmt.Sprintf("line %03d", len(records)-1) ||
+		newest != base.Add(time.Duration(len(records)-1)*time.Millisecond).UnixNano() {
+		t.Errorf("limited read: %d records, last %q, newest %d", len(records), last.Message, newest)
+	}
+}
+
+func TestContainerLogRecords(t *testing.T) {
+	records, newest := containerLogRecords("2024-03-05T14:07:09.5Z hello\r\n\nno timestamp\n", "stdout", "web")
+	want := []models.LogRecord{
+		{Timestamp: 1709647629500, Message: "hello"},
+		{Message: "no timestamp"},
+	}
+	if len(records) != len(want) || newest != 1709647629500000000 {
+		t.Fatalf("records = %+v, newest %d", records, newest)
+	}
+	for i, rec := range records {
+		if rec.Timestamp != want[i].Timestamp || rec.Message != want[i].Message || rec.Container != "web" || rec.Source != "container" {
+			t.Errorf("record %d = %+v", i, rec)
+		}
+	}
+}
+
+func TestContainerMultiline(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		line   string
+		want   bool // the line continues the previous event; false also for no rule
+	}{
+		{"no labels", nil, "\tat Foo", false},
+		{"preset", map[string]string{labelLogsMultiline: "java"}, "\tat com.example.Foo.bar(Foo.java:12)", true},
+		{"start", map[string]string{labelLogsStart: `^\d{4}-`}, "  details", true},
+		{"start matches", map[string]string{labelLogsStart: `^\d{4}-`}, "2024-03-05 next", false},
+		{"continuation", map[string]string{labelLogsCont: `^\s`}, " more", true},
+		{"continuation does not match", map[string]string{labelLogsCont: `^\s`}, "next", false},
+		{"preset and start conflict", map[string]string{labelLogsMultiline: "java", labelLogsStart: "^x"}, "\tat x", false},
+		{"bad pattern", map[string]string{labelLogsStart: "("}, "x", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := containerMultiline(container.Summary{Labels: tt.labels})
+			if got := rule != nil && rule.continues(tt.line); got != tt.want {
+				t.Errorf("continues(%q) = %v", tt.line, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package collector
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptime-id/agent/models"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+// `docker system df` walks every layer and volume, so it is refreshed far
+// less often than the send interval.
+const (
+	dockerDiskUsageInterval = 5 * time.Minute
+	dockerDiskUsageTimeout  = 60 * time.Second
+	maxDockerDiskItems      = 50
+)
+
+// dockerDiskRefresher keeps the last `docker system df` result, refreshed
+// in the background.
+type dockerDiskRefresher struct {
+	query func() *models.DockerDiskUsage
+
+	mu         sync.Mutex
+	at         time.Time
+	refreshing bool
+	usage      *models.DockerDiskUsage
+}
+
+var dockerDisk = &dockerDiskRefresher{query: queryDockerDiskUsageWithClient}
+
+// collect returns the last known usage and starts a refresh in the
+// background when it is due, so a slow daemon never holds up a collection.
+// Nothing is reported until the first refresh completes.
+func (r *dockerDiskRefresher) collect() *models.DockerDiskUsage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.refreshing && time.Since(r.at) >= dockerDiskUsageInterval {
+		r.refreshing = true
+		go r.refresh()
+	}
+	return r.usage
+}
+
+func (r *dockerDiskRefresher) refresh() {
+	usage := r.query()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Retry on the next interval rather than hammering the daemon every tick.
+	r.at = time.Now()
+	r.refreshing = false
+	if usage != nil {
+		r.usage = usage
+	}
+}
+
+func queryDockerDiskUsageWithClient() *models.DockerDiskUsage {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		log.Printf("Docker client error: %v", err)
+		return nil
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), dockerDiskUsageTimeout)
+	defer cancel()
+
+	usage, err := queryDockerDiskUsage(ctx, cli)
+	if err != nil {
+		log.Printf("Docker disk usage error: %v", err)
+		return nil
+	}
+	return usage
+}
+
+// dockerDiskClient is the part of the Docker client the disk usage needs.
+type dockerDiskClient interface {
+	DiskUsage(ctx context.Context, options types.DiskUsageOptions) (types.DiskUsage, error)
+	ImageList(ctx context.Context, options image.ListOptions) ([]image.Summary, error)
+	VolumeList(ctx context.Context, options volume.ListOptions) (volume.ListResponse, error)
+}
+
+func queryDockerDiskUsage(ctx context.Context, cli dockerDiskClient) (*models.DockerDiskUsage, error) {
+	du, err := cli.DiskUsage(ctx, types.DiskUsageOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	danglingImages := map[string]bool{}
+	if images, err := cli.ImageList(ctx, image.ListOptions{Filters: filters.NewArgs(filters.Arg("dangling", "true"))}); err == nil {
+		for _, img := range images {
+			danglingImages[img.ID] = true
+		}
+	} else {
+		log.Printf("Docker image list error: %v", err)
+	}
+
+	danglingVolumes := map[string]bool{}
+	if volumes, err := cli.VolumeList(ctx, volume.ListOptions{Filters: filters.NewArgs(filters.Arg("dangling", "true"))}); err == nil {
+		for _, v := range volumes.Volumes {
+			danglingVolumes[v.Name] = true
+		}
+	} else {
+		log.Printf("Docker volume list error: %v", err)
+	}
+
+	usage := &models.DockerDiskUsage{
+		LayersSize:  du.LayersSize,
+		CollectedAt: time.Now().UnixMilli(),
+	}
+
+	for _, img := range du.Images {
+		if img == nil {
+			continue
+		}
+		dangling := danglingImages[img.ID]
+		usage.ImagesCount++
+		usage.ImagesSize += img.Size
+		if img.Containers == 0 {
+			usage.ImagesReclaimable += img.Size - max(img.SharedSize, 0)
+		}
+		if dangling {
+			usage.DanglingImages++
+			usage.DanglingImagesSize += img.Size
+		}
+		usage.Images = append(usage.Images, models.DockerImageUsage{
+			ID:         shortDockerID(img.ID),
+			Tags:       img.RepoTags,
+			Size:       img.Size,
+			SharedSize: img.SharedSize,
+			Containers: img.Containers,
+			Dangling:   dangling,
+			Created:    img.Created,
+		})
+	}
+
+	for _, c := range du.Containers {
+		if c == nil {
+			continue
+		}
+		usage.ContainersCount++
+		usage.ContainersSize += c.SizeRw
+		usage.Containers = append(usage.Containers, models.DockerLayerUsage{
+			ID:         shortDockerID(c.ID),
+			Name:       containerName(*c),
+			SizeRw:     c.SizeRw,
+			SizeRootFs: c.SizeRootFs,
+		})
+	}
+
+	for _, v := range du.Volumes {
+		if v == nil {
+			continue
+		}
+		size, refCount := int64(-1), int64(-1)
+		if v.UsageData != nil {
+			size, refCount = v.UsageData.Size, v.UsageData.RefCount
+		}
+		dangling := danglingVolumes[v.Name]
+		usage.VolumesCount++
+		if size > 0 {
+			usage.VolumesSize += size
+			if dangling {
+				usage.DanglingVolumesSize += size
+			}
+		}
+		if dangling {
+			usage.DanglingVolumes++
+		}
+		usage.Volumes = append(usage.Volumes, models.DockerVolumeUsage{
+			Name:     v.Name,
+			Driver:   v.Driver,
+			Size:     size,
+			RefCount: refCount,
+			Dangling: dangling,
+		})
+	}
+
+	for _, bc := range du.BuildCache {
+		if bc == nil {
+			continue
+		}
+		usage.BuildCacheCount++
+		usage.BuildCacheSize += bc.Size
+		if !bc.InUse && !bc.Shared {
+			usage.BuildCacheReclaimable += bc.Size
+		}
+	}
+
+	// Totals cover everything; the per-item lists only keep the largest.
+	sort.Slice(usage.Images, func(i, j int) bool { return usage.Images[i].Size > usage.Images[j].Size })
+	sort.Slice(usage.Volumes, func(i, j int) bool { return usage.Volumes[i].Size > usage.Volumes[j].Size })
+	sort.Slice(usage.Containers, func(i, j int) bool { return usage.Containers[i].SizeRw > usage.Containers[j].SizeRw })
+	usage.Images = usage.Images[:min(len(usage.Images), maxDockerDiskItems)]
+	usage.Volumes = usage.Volumes[:min(len(usage.Volumes), maxDockerDiskItems)]
+	usage.Containers = usage.Containers[:min(len(usage.Containers), maxDockerDiskItems)]
+
+	return usage, nil
+}
+
+func shortDockerID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
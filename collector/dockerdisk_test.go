@@ -0,0 +1,173 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/uptime-id/agent/models"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/volume"
+)
+
+type fakeDockerDisk struct {
+	du      types.DiskUsage
+	images  []image.Summary
+	volumes []*volume.Volume
+	err     error
+}
+
+func (f *fakeDockerDisk) DiskUsage(context.Context, types.DiskUsageOptions) (types.DiskUsage, error) {
+	return f.du, f.err
+}
+
+func (f *fakeDockerDisk) ImageList(context.Context, image.ListOptions) ([]image.Summary, error) {
+	if f.images == nil {
+		return nil, errors.New("images unavailable")
+	}
+	return f.images, nil
+}
+
+func (f *fakeDockerDisk) VolumeList(context.Context, volume.ListOptions) (volume.ListResponse, error) {
+	return volume.ListResponse{Volumes: f.volumes}, nil
+}
+
+func TestQueryDockerDiskUsage(t *testing.T) {
+	dangling := &volume.Volume{Name: "old", Driver: "local", UsageData: &volume.UsageData{Size: 300, RefCount: 0}}
+	fake := &fakeDockerDisk{
+		du: types.DiskUsage{
+			LayersSize: 5000,
+			Images: []*image.Summary{
+				{ID: "sha256:aaaaaaaaaaaaaaaa", RepoTags: []string{"web:1"}, Size: 1000, SharedSize: 400, Containers: 1},
+				{ID: "sha256:bbbbbbbbbbbbbbbb", Size: 700, SharedSize: -1, Containers: 0},
+				{ID: "sha256:cccccccccccccccc", RepoTags: []string{"app:2"}, Size: 900, SharedSize: 400, Containers: 0},
+				nil,
+			},
+			Containers: []*container.Summary{
+				{ID: "1111111111111111", Names: []string{"/web"}, SizeRw: 10, SizeRootFs: 1010},
+				{ID: "2222222222222222", Names: []string{"/worker"}, SizeRw: 20},
+			},
+			Volumes: []*volume.Volume{
+				{Name: "data", Driver: "local", UsageData: &volume.UsageData{Size: 200, RefCount: 1}},
+				dangling,
+				{Name: "remote", Driver: "nfs"},
+			},
+			BuildCache: []*types.BuildCache{
+				{Size: 50, InUse: true},
+				{Size: 60, Shared: true},
+				{Size: 70},
+			},
+		},
+		images:  []image.Summary{{ID: "sha256:bbbbbbbbbbbbbbbb"}},
+		volumes: []*volume.Volume{dangling},
+	}
+
+	usage, err := queryDockerDiskUsage(context.Background(), fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := *usage
+	got.CollectedAt = 0
+	got.Images, got.Containers, got.Volumes = nil, nil, nil
+	want := models.DockerDiskUsage{
+		LayersSize:  5000,
+		ImagesCount: 3, ImagesSize: 2600, ImagesReclaimable: 700 + 500,
+		DanglingImages: 1, DanglingImagesSize: 700,
+		ContainersCount: 2, ContainersSize: 30,
+		VolumesCount: 3, VolumesSize: 500,
+		DanglingVolumes: 1, DanglingVolumesSize: 300,
+		BuildCacheCount: 3, BuildCacheSize: 180, BuildCacheReclaimable: 70,
+	}
+	if fmt.Sprintf("%+v", got) != fmt.Sprintf("%+v", want) {
+		t.Errorf("totals = %+v\nwant     %+v", got, want)
+	}
+
+	if img := usage.Images[0]; img.ID != "aaaaaaaaaaaa" || img.Tags[0] != "web:1" || usage.Images[2].ID != "bbbbbbbbbbbb" || !usage.Images[2].Dangling {
+		t.Errorf("images = %+v", usage.Images)
+	}
+	if c := usage.Containers[0]; c.Name != "worker" || c.ID != "222222222222" {
+		t.Errorf("containers = %+v", usage.Containers)
+	}
+	if v := usage.Volumes[2]; v.Name != "remote" || v.Size != -1 || v.RefCount != -1 {
+		t.Errorf("volumes = %+v", usage.Volumes)
+	}
+
+	// Without the dangling image list the totals are still reported.
+	fake.images = nil
+	if usage, err := queryDockerDiskUsage(context.Background(), fake); err != nil || usage.DanglingImages != 0 || usage.ImagesCount != 3 {
+		t.Errorf("without image list: %+v, %v", usage, err)
+	}
+	fake.err = errors.New("daemon gone")
+	if _, err := queryDockerDiskUsage(context.Background(), fake); err == nil {
+		t.Error("DiskUsage error ignored")
+	}
+}
+
+func TestQueryDockerDiskUsageLimit(t *testing.T) {
+	fake := &fakeDockerDisk{images: []image.Summary{}}
+	for i := range maxDockerDiskItems + 10 {
+		fake.du.Images = append(fake.du.Images, &image.Summary{ID: fmt.Sprintf("sha256:%016d", i), Size: int64(i)})
+	}
+	usage, err := queryDockerDiskUsage(context.Background(), fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage.Images) != maxDockerDiskItems || usage.ImagesCount != maxDockerDiskItems+10 || usage.Images[0].Size != maxDockerDiskItems+9 {
+		t.Errorf("%d images listed, %d counted, largest %d", len(usage.Images), usage.ImagesCount, usage.Images[0].Size)
+	}
+}
+
+func TestDockerDiskRefresher(t *testing.T) {
+	var calls atomic.Int64
+	var fail atomic.Bool
+	release := make(chan struct{})
+	r := &dockerDiskRefresher{query: func() *models.DockerDiskUsage {
+		n := calls.Add(1)
+		<-release
+		if fail.Load() {
+			return nil
+		}
+		return &models.DockerDiskUsage{ImagesCount: int(n)}
+	}}
+	wait := func() {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			r.mu.Lock()
+			refreshing := r.refreshing
+			r.mu.Unlock()
+			if !refreshing {
+				return
+			}
+		}
+		t.Fatal("refresh didn't finish")
+	}
+
+	// The first collections return nothing while the query is slow, and
+	// don't start a second one.
+	if r.collect() != nil || r.collect() != nil {
+		t.Error("usage before the first refresh")
+	}
+	release <- struct{}{}
+	wait()
+	if u := r.collect(); u == nil || u.ImagesCount != 1 || calls.Load() != 1 {
+		t.Fatalf("after refresh: %+v, %d queries", u, calls.Load())
+	}
+
+	// A failed refresh keeps the last usage and waits for the next interval.
+	fail.Store(true)
+	r.mu.Lock()
+	r.at = time.Now().Add(-dockerDiskUsageInterval)
+	r.mu.Unlock()
+	r.collect()
+	release <- struct{}{}
+	wait()
+	if u := r.collect(); u == nil || u.ImagesCount != 1 || calls.Load() != 2 {
+		t.Errorf("after failed refresh: %+v, %d queries", u, calls.Load())
+	}
+}
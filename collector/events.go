@@ -0,0 +1,229 @@
+package collector
+
+import (
+	"log"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+)
+
+const (
+	maxEventSampleSize = 1024
+	defaultEventWindow = 5 * time.Minute
+	maxEventWindows    = 10000 // groups tracked for MinCount rules
+)
+
+// Built-in detection rule packs, enabled by name in the events config.
+var eventRulePacks = map[string][]config.EventRule{
+	"ssh": {
+		{Name: "ssh-failed-login", Pattern: `Failed (?:password|publickey) for (?:invalid user )?(?P<user>\S+) from (?P<ip>\S+)`, Severity: "warning", GroupBy: []string{"ip", "user"}},
+		{Name: "ssh-brute-force", Pattern: `Failed (?:password|publickey) for (?:invalid user )?\S+ from (?P<ip>\S+)`, Severity: "critical", GroupBy: []string{"ip"}, MinCount: 10, Window: config.Duration(5 * time.Minute)},
+	},
+	"oom": {
+		{Name: "oom-kill", Pattern: `(?i)out of memory: Killed process (?P<pid>\d+) \((?P<process>[^)]+)\)`, Severity: "error", GroupBy: []string{"process"}},
+	},
+	"disk": {
+		{Name: "filesystem-error", Pattern: `(?P<fs>EXT[234]-fs|BTRFS) (?:error|critical) \((?:device )?(?P<device>[^)]+)\)|(?P<fs>XFS) \((?P<device>[^)]+)\): .*(?i:corrupt|error|shut)`, Severity: "error", GroupBy: []string{"fs", "device"}},
+		{Name: "io-error", Pattern: `I/O error,? (?:on )?dev (?P<device>[\w.-]+)`, Severity: "error", GroupBy: []string{"device"}},
+	},
+	"segfault": {
+		{Name: "segfault", Pattern: `(?P<process>\S+)\[\d+\]: segfault at`, Severity: "warning", GroupBy: []string{"process"}},
+	},
+	"kernel": {
+		{Name: "kernel-panic", Pattern: `Kernel panic - not syncing: (?P<reason>.*)`, Severity: "critical"},
+		{Name: "kernel-oops", Pattern: `(?P<reason>BUG: unable to handle|BUG: soft lockup|general protection fault|Oops: )`, Severity: "critical"},
+		{Name: "hung-task", Pattern: `task (?P<process>\S+):\d+ blocked for more than \d+ seconds`, Severity: "warning", GroupBy: []string{"process"}},
+	},
+}
+
+type eventRule struct {
+	name     string
+	severity string
+	source   string
+	re       *regexp.Regexp
+	groupBy  []string
+	minCount int
+	window   time.Duration
+}
+
+// eventDetector keeps, for rules with a MinCount, the times of the latest
+// matches of each group, so a threshold is checked over the rule's window
+// rather than per collection.
+type eventDetector struct {
+	rules   []eventRule
+	windows map[string][]int64 // unix ms, at most minCount per group
+}
+
+var events *eventDetector
+
+func newEventDetector(c config.EventsConfig) *eventDetector {
+	packs := c.Packs
+	if packs == nil {
+		for name := range eventRulePacks {
+			packs = append(packs, name)
+		}
+		sort.Strings(packs)
+	}
+
+	var rules []config.EventRule
+	for _, name := range packs {
+		pack, ok := eventRulePacks[name]
+		if !ok {
+			log.Printf("Events: unknown rule pack %q", name)
+			continue
+		}
+		rules = append(rules, pack...)
+	}
+	rules = append(rules, c.Rules...)
+
+	d := &eventDetector{windows: map[string][]int64{}}
+	for _, r := range rules {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			log.Printf("Event rule %s: %v, skipping", r.Name, err)
+			continue
+		}
+		severity := normalizeSeverity(r.Severity)
+		if severity == "" {
+			severity = "warning"
+		}
+		groupBy := r.GroupBy
+		if len(groupBy) == 0 {
+			for _, name := range re.SubexpNames() {
+				if name != "" {
+					groupBy = append(groupBy, name)
+				}
+			}
+		}
+		d.rules = append(d.rules, eventRule{
+			name:     r.Name,
+			severity: severity,
+			source:   r.Source,
+			re:       re,
+			groupBy:  groupBy,
+			minCount: r.MinCount,
+			window:   r.Window.Or(defaultEventWindow),
+		})
+	}
+	return d
+}
+
+// detect matches the interval's log records against the rules and returns
+// one event per rule and distinct group-by values, in order of first match.
+// A rule with a MinCount only reports a group once that many matches fell
+// within its window, counting those of earlier intervals.
+func (d *eventDetector) detect(records []models.LogRecord) []models.LogEvent {
+	if d == nil || len(d.rules) == 0 {
+		return nil
+	}
+
+	type aggregate struct {
+		event   *models.LogEvent
+		reached bool // the MinCount was reached within the window
+	}
+	seen := map[string]*aggregate{}
+	var order []*aggregate
+
+	for _, rec := range records {
+		for _, rule := range d.rules {
+			if rule.source != "" && rule.source != rec.Source {
+				continue
+			}
+			m := rule.re.FindStringSubmatch(rec.Message)
+			if m == nil {
+				continue
+			}
+
+			fields := map[string]string{}
+			for i, name := range rule.re.SubexpNames() {
+				if name != "" && m[i] != "" {
+					fields[name] = m[i]
+				}
+			}
+			key := rule.name
+			for _, name := range rule.groupBy {
+				key += "\x00" + fields[name]
+			}
+
+			agg := seen[key]
+			if agg != nil {
+				agg.event.Count++
+				agg.event.FirstSeen = min(agg.event.FirstSeen, rec.Timestamp)
+				agg.event.LastSeen = max(agg.event.LastSeen, rec.Timestamp)
+			} else {
+				grouped := make(map[string]string, len(rule.groupBy))
+				for _, name := range rule.groupBy {
+					if v, ok := fields[name]; ok {
+						grouped[name] = v
+					}
+				}
+				sample := rec.Message
+				if len(sample) > maxEventSampleSize {
+					sample = sample[:maxEventSampleSize]
+				}
+				agg = &aggregate{
+					event: &models.LogEvent{
+						Rule:      rule.name,
+						Severity:  rule.severity,
+						Count:     1,
+						FirstSeen: rec.Timestamp,
+						LastSeen:  rec.Timestamp,
+						Source:    rec.Source,
+						Fields:    grouped,
+						Sample:    strings.ToValidUTF8(sample, ""),
+					},
+					reached: rule.minCount <= 1,
+				}
+				seen[key] = agg
+				order = append(order, agg)
+			}
+			if rule.minCount > 1 && d.countMatch(key, rule, rec.Timestamp) {
+				agg.reached = true
+			}
+		}
+	}
+
+	var result []models.LogEvent
+	for _, agg := range order {
+		if agg.reached {
+			result = append(result, *agg.event)
+		}
+	}
+	d.expireWindows(time.Now())
+	return result
+}
+
+// countMatch records a match of a MinCount rule's group at ts and reports
+// whether the group's last minCount matches fall within the rule's window.
+func (d *eventDetector) countMatch(key string, rule eventRule, ts int64) bool {
+	times, ok := d.windows[key]
+	if !ok && len(d.windows) >= maxEventWindows {
+		return false
+	}
+	times = append(times, ts)
+	if len(times) > rule.minCount {
+		times = times[len(times)-rule.minCount:]
+	}
+	d.windows[key] = times
+	return len(times) == rule.minCount && ts-slices.Min(times) <= rule.window.Milliseconds()
+}
+
+// expireWindows forgets groups whose latest match is older than any rule
+// window, so one-off senders don't accumulate.
+func (d *eventDetector) expireWindows(now time.Time) {
+	longest := defaultEventWindow
+	for _, rule := range d.rules {
+		longest = max(longest, rule.window)
+	}
+	horizon := now.Add(-longest).UnixMilli()
+	for key, times := range d.windows {
+		if slices.Max(times) < horizon {
+			delete(d.windows, key)
+		}
+	}
+}
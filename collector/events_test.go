@@ -0,0 +1,126 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+)
+
+func eventString(events []models.LogEvent) string {
+	var items []string
+	for _, e := range events {
+		items = append(items, fmt.Sprintf("%s %v×%d", e.Rule, e.Fields, e.Count))
+	}
+	return strings.Join(items, " ")
+}
+
+func TestEventRulePacks(t *testing.T) {
+	d := newEventDetector(config.EventsConfig{})
+	now := time.Now().UnixMilli()
+	records := []models.LogRecord{
+		{Timestamp: now, Source: "security", Message: "Failed password for invalid user admin from 203.0.113.9 port 22 ssh2"},
+		{Timestamp: now + 1, Source: "security", Message: "Failed publickey for root from 203.0.113.9 port 22 ssh2"},
+		{Timestamp: now + 2, Source: "security", Message: "Failed password for invalid user admin from 203.0.113.9 port 22 ssh2"},
+		{Timestamp: now, Source: "system", Message: "Out of memory: Killed process 4242 (java) total-vm:1kB"},
+		{Timestamp: now, Source: "system", Message: "EXT4-fs error (device sda1): ext4_find_entry:1455: inode #2"},
+		{Timestamp: now, Source: "system", Message: "XFS (dm-0): Corruption detected. Unmount and run xfs_repair"},
+		{Timestamp: now, Source: "system", Message: "blk_update_request: I/O error, dev nvme0n1, sector 12345"},
+		{Timestamp: now, Source: "system", Message: "nginx[311]: segfault at 0 ip 00007f sp 00007ffd error 4"},
+		{Timestamp: now, Source: "system", Message: "Kernel panic - not syncing: Fatal exception"},
+		{Timestamp: now, Source: "system", Message: "BUG: soft lockup - CPU#0 stuck for 22s!"},
+		{Timestamp: now, Source: "system", Message: "INFO: task kworker/0:1:12 blocked for more than 120 seconds."},
+		{Timestamp: now, Source: "system", Message: "nothing to see here"},
+	}
+	want := "ssh-failed-login map[ip:203.0.113.9 user:admin]×2 ssh-failed-login map[ip:203.0.113.9 user:root]×1 " +
+		"oom-kill map[process:java]×1 filesystem-error map[device:sda1 fs:EXT4-fs]×1 filesystem-error map[device:dm-0 fs:XFS]×1 " +
+		"io-error map[device:nvme0n1]×1 segfault map[process:nginx]×1 kernel-panic map[reason:Fatal exception]×1 kernel-oops map[reason:BUG: soft lockup]×1 " +
+		"hung-task map[process:kworker/0:1]×1"
+	events := d.detect(records)
+	if got := eventString(events); got != want {
+		t.Errorf("events =\n%s\nwant\n%s", got, want)
+	}
+	if e := events[0]; e.FirstSeen != now || e.LastSeen != now+2 || e.Severity != "warning" || e.Source != "security" ||
+		!strings.HasPrefix(e.Sample, "Failed password") {
+		t.Errorf("first event = %+v", e)
+	}
+}
+
+func TestEventCustomRules(t *testing.T) {
+	d := newEventDetector(config.EventsConfig{Packs: []string{"nonexistent"}, Rules: []config.EventRule{
+		{Name: "upstream", Pattern: `upstream "(?P<upstream>[^"]+)" (?P<state>\w+)`, Source: "nginx", Severity: "ERR"},
+		{Name: "by-state", Pattern: `upstream "(?P<upstream>[^"]+)" (?P<state>\w+)`, GroupBy: []string{"state"}},
+		{Name: "broken", Pattern: `(`},
+	}})
+	if len(d.rules) != 2 {
+		t.Fatalf("%d rules compiled", len(d.rules))
+	}
+	long := `upstream "b" down ` + strings.Repeat("x", 2*maxEventSampleSize)
+	events := d.detect([]models.LogRecord{
+		{Source: "nginx", Message: `upstream "a" down`},
+		{Source: "nginx", Message: long},
+		{Source: "other", Message: `upstream "a" down`},
+	})
+	want := "upstream map[state:down upstream:a]×1 by-state map[state:down]×3 upstream map[state:down upstream:b]×1"
+	if got := eventString(events); got != want {
+		t.Errorf("events = %s", got)
+	}
+	if events[0].Severity != "error" || events[1].Severity != "warning" || len(events[2].Sample) != maxEventSampleSize {
+		t.Errorf("severities %q %q, sample of %d bytes", events[0].Severity, events[1].Severity, len(events[2].Sample))
+	}
+}
+
+func TestEventMinCountWindow(t *testing.T) {
+	d := newEventDetector(config.EventsConfig{Packs: []string{"ssh"}})
+	failures := func(ip string, at time.Time, n int) []models.LogRecord {
+		var records []models.LogRecord
+		for i := range n {
+			records = append(records, models.LogRecord{
+				Timestamp: at.Add(time.Duration(i) * time.Second).UnixMilli(),
+				Message:   "Failed password for root from " + ip + " port 22 ssh2",
+			})
+		}
+		return records
+	}
+	bruteForce := func(events []models.LogEvent) *models.LogEvent {
+		for i, e := range events {
+			if e.Rule == "ssh-brute-force" {
+				return &events[i]
+			}
+		}
+		return nil
+	}
+	now := time.Now()
+
+	// Four failures per 5s tick: the threshold of 10 is reached on the
+	// third tick, and the event carries that tick's count.
+	for tick := range 3 {
+		e := bruteForce(d.detect(failures("203.0.113.9", now.Add(time.Duration(tick-3)*5*time.Second), 4)))
+		if (e != nil) != (tick == 2) {
+			t.Fatalf("tick %d: brute force event %+v", tick, e)
+		}
+		if e != nil && (e.Count != 4 || e.Fields["ip"] != "203.0.113.9") {
+			t.Errorf("event = %+v", e)
+		}
+	}
+	// Still going: reported while the window holds ten failures.
+	if e := bruteForce(d.detect(failures("203.0.113.9", now, 1))); e == nil || e.Count != 1 {
+		t.Errorf("continued attack: %+v", e)
+	}
+
+	// Failures spread wider than the window don't add up.
+	for tick := range 12 {
+		if e := bruteForce(d.detect(failures("198.51.100.1", now.Add(time.Duration(tick-12)*time.Minute), 1))); e != nil {
+			t.Fatalf("slow failures reported at tick %d: %+v", tick, e)
+		}
+	}
+
+	// Groups whose last match left every window are forgotten.
+	d.detect(failures("192.0.2.1", now.Add(-time.Hour), 1))
+	if _, ok := d.windows["ssh-brute-force\x00192.0.2.1"]; ok || len(d.windows) != 2 {
+		t.Errorf("windows = %v", d.windows)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package collector
+
+import (
+	"os"
+	"syscall"
+)
+
+func fileIdentity(fi os.FileInfo) (uint64, uint64) {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Dev), uint64(st.Ino)
+	}
+	return 0, 0
+}
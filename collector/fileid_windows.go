@@ -0,0 +1,11 @@
+//go:build windows
+
+package collector
+
+import "os"
+
+// fileIdentity has no inode equivalent in os.FileInfo on Windows; rotation
+// is detected from size and fingerprint only.
+func fileIdentity(fi os.FileInfo) (uint64, uint64) {
+	return 0, 0
+}
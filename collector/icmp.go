@@ -0,0 +1,217 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	defaultPingCount    = 5
+	defaultPingInterval = 200 * time.Millisecond
+	pingReplyTimeout    = 1 * time.Second
+	pingPayloadSize     = 16
+)
+
+type pingSocket struct {
+	conn     *icmp.PacketConn
+	proto    int // IANA protocol number for icmp.ParseMessage
+	echoType icmp.Type
+	reply    icmp.Type
+	datagram bool // unprivileged SOCK_DGRAM socket; the kernel owns the echo ID
+}
+
+// listenPing prefers unprivileged datagram ICMP sockets (allowed by
+// net.ipv4.ping_group_range) and falls back to raw sockets.
+func listenPing(ipv6Target bool) (*pingSocket, error) {
+	s := &pingSocket{proto: 1, echoType: ipv4.ICMPTypeEcho, reply: ipv4.ICMPTypeEchoReply}
+	dgram, raw, addr := "udp4", "ip4:icmp", "0.0.0.0"
+	if ipv6Target {
+		s.proto, s.echoType, s.reply = 58, ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+		dgram, raw, addr = "udp6", "ip6:ipv6-icmp", "::"
+	}
+
+	conn, err := icmp.ListenPacket(dgram, addr)
+	if err == nil {
+		s.conn, s.datagram = conn, true
+		return s, nil
+	}
+
+	conn, rawErr := icmp.ListenPacket(raw, addr)
+	if rawErr != nil {
+		return nil, fmt.Errorf("icmp socket unavailable (datagram: %v; raw: %v)", err, rawErr)
+	}
+	s.conn = conn
+	return s, nil
+}
+
+func probeICMP(ctx context.Context, p config.ProbeConfig, result *models.ProbeResult) error {
+	network := p.Network
+	if network == "" {
+		network = "ip"
+	}
+
+	ip := net.ParseIP(p.Target)
+	if ip == nil {
+		start := time.Now()
+		ips, err := net.DefaultResolver.LookupIP(ctx, network, p.Target)
+		result.DNS = millis(time.Since(start))
+		if err != nil {
+			return err
+		}
+		ip = ips[0]
+	}
+	isV6 := ip.To4() == nil
+
+	sock, err := listenPing(isV6)
+	if err != nil {
+		return err
+	}
+	defer sock.conn.Close()
+
+	var dst net.Addr = &net.IPAddr{IP: ip}
+	if sock.datagram {
+		dst = &net.UDPAddr{IP: ip}
+	}
+
+	count := p.Count
+	if count <= 0 {
+		count = defaultPingCount
+	}
+	interval := p.PacketInterval.Or(defaultPingInterval)
+	if d, ok := ctx.Deadline(); ok {
+		interval = min(interval, time.Until(d)/time.Duration(count))
+	}
+
+	token := make([]byte, pingPayloadSize)
+	_, _ = rand.Read(token)
+	id := os.Getpid() & 0xffff
+
+	stats := &models.ICMPStats{}
+	result.ICMP = stats
+	var rtts []float64
+
+	for seq := 1; seq <= count; seq++ {
+		if ctx.Err() != nil {
+			break
+		}
+		sent := time.Now()
+
+		msg := icmp.Message{
+			Type: sock.echoType,
+			Body: &icmp.Echo{ID: id, Seq: seq, Data: token},
+		}
+		wire, err := msg.Marshal(nil)
+		if err != nil {
+			return err
+		}
+		if _, err := sock.conn.WriteTo(wire, dst); err != nil {
+			return err
+		}
+		stats.PacketsSent++
+
+		// Share what is left of the probe timeout between the packets still
+		// to send, so a silent target doesn't leave the last ones unsent.
+		wait := pingReplyTimeout
+		if d, ok := ctx.Deadline(); ok {
+			wait = min(wait, time.Until(d)/time.Duration(count-seq+1))
+		}
+		if rtt, ok := awaitEchoReply(ctx, sock, ip, id, seq, token, sent, wait); ok {
+			stats.PacketsRecv++
+			rtts = append(rtts, millis(rtt))
+		}
+
+		if seq < count {
+			select {
+			case <-time.After(time.Until(sent.Add(interval))):
+			case <-ctx.Done():
+			}
+		}
+	}
+
+	summarizePings(stats, rtts)
+	if stats.PacketsRecv == 0 {
+		return errors.New("100% packet loss")
+	}
+	result.Latency = stats.RTTAvg
+	return nil
+}
+
+func awaitEchoReply(ctx context.Context, sock *pingSocket, ip net.IP, id, seq int, token []byte, sent time.Time, wait time.Duration) (time.Duration, bool) {
+	deadline := sent.Add(wait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = sock.conn.SetReadDeadline(deadline)
+
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := sock.conn.ReadFrom(buf)
+		if err != nil {
+			return 0, false
+		}
+		received := time.Now()
+
+		if !addrIP(peer).Equal(ip) {
+			continue
+		}
+		msg, err := icmp.ParseMessage(sock.proto, buf[:n])
+		if err != nil || msg.Type != sock.reply {
+			continue
+		}
+		echo, ok := msg.Body.(*icmp.Echo)
+		// Raw sockets see every echo reply on the host, so also match the ID.
+		if !ok || echo.Seq != seq || !bytes.Equal(echo.Data, token) || (!sock.datagram && echo.ID != id) {
+			continue
+		}
+		return received.Sub(sent), true
+	}
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.IPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+// summarizePings fills min/avg/max RTT, jitter (standard deviation) and loss.
+func summarizePings(stats *models.ICMPStats, rtts []float64) {
+	if stats.PacketsSent > 0 {
+		stats.Loss = float64(stats.PacketsSent-stats.PacketsRecv) / float64(stats.PacketsSent) * 100
+	}
+	if len(rtts) == 0 {
+		return
+	}
+
+	stats.RTTMin, stats.RTTMax = rtts[0], rtts[0]
+	var sum float64
+	for _, r := range rtts {
+		sum += r
+		stats.RTTMin = math.Min(stats.RTTMin, r)
+		stats.RTTMax = math.Max(stats.RTTMax, r)
+	}
+	stats.RTTAvg = sum / float64(len(rtts))
+
+	var variance float64
+	for _, r := range rtts {
+		variance += (r - stats.RTTAvg) * (r - stats.RTTAvg)
+	}
+	stats.Jitter = math.Sqrt(variance / float64(len(rtts)))
+}
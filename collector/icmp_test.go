@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+)
+
+func TestProbeICMPLoopback(t *testing.T) {
+	for _, target := range []string{"127.0.0.1", "::1"} {
+		t.Run(target, func(t *testing.T) {
+			p := config.ProbeConfig{
+				Name:           target,
+				Type:           "icmp",
+				Target:         target,
+				Count:          3,
+				PacketInterval: config.Duration(10 * time.Millisecond),
+			}
+			result := executeProbe(context.Background(), probeSpec{Key: target, Probe: p})
+			if result.ICMP == nil || result.ICMP.PacketsSent == 0 {
+				t.Skipf("no ICMP socket here: %s", result.Error)
+			}
+			if !result.Success {
+				t.Fatalf("probe failed: %s", result.Error)
+			}
+			s := result.ICMP
+			if s.PacketsSent != 3 || s.PacketsRecv != 3 || s.Loss != 0 {
+				t.Errorf("sent %d, received %d, loss %v", s.PacketsSent, s.PacketsRecv, s.Loss)
+			}
+			if s.RTTMin <= 0 || s.RTTMin > s.RTTAvg || s.RTTAvg > s.RTTMax || result.Latency != s.RTTAvg {
+				t.Errorf("rtt min/avg/max = %v/%v/%v, latency %v", s.RTTMin, s.RTTAvg, s.RTTMax, result.Latency)
+			}
+		})
+	}
+}
+
+func TestSummarizePings(t *testing.T) {
+	tests := []struct {
+		name       string
+		sent, recv int
+		rtts       []float64
+		want       models.ICMPStats
+	}{
+		{"no replies", 4, 0, nil, models.ICMPStats{PacketsSent: 4, Loss: 100}},
+		{"steady", 2, 2, []float64{10, 10}, models.ICMPStats{PacketsSent: 2, PacketsRecv: 2, RTTMin: 10, RTTAvg: 10, RTTMax: 10}},
+		{"jitter and loss", 4, 2, []float64{10, 30}, models.ICMPStats{PacketsSent: 4, PacketsRecv: 2, Loss: 50, RTTMin: 10, RTTAvg: 20, RTTMax: 30, Jitter: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := models.ICMPStats{PacketsSent: tt.sent, PacketsRecv: tt.recv}
+			summarizePings(&stats, tt.rtts)
+			if math.Abs(stats.Jitter-tt.want.Jitter) > 1e-9 {
+				t.Errorf("jitter = %v, want %v", stats.Jitter, tt.want.Jitter)
+			}
+			stats.Jitter = tt.want.Jitter
+			if stats != tt.want {
+				t.Errorf("got %+v, want %+v", stats, tt.want)
+			}
+		})
+	}
+}
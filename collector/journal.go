@@ -0,0 +1,325 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// A minimal reader for the systemd journal file format
+// (https://systemd.io/JOURNAL_FILE_FORMAT/), so logs can be read without
+// journalctl or libsystemd in a CGO-free static binary.
+
+const (
+	journalSignature = "LPKSHHRH"
+
+	journalIncompatCompressedXZ   = 1 << 0
+	journalIncompatCompressedLZ4  = 1 << 1
+	journalIncompatCompressedZSTD = 1 << 3
+	journalIncompatCompact        = 1 << 4
+
+	journalObjectData       = 1
+	journalObjectEntry      = 3
+	journalObjectEntryArray = 6
+
+	journalObjectCompressedXZ   = 1 << 0
+	journalObjectCompressedLZ4  = 1 << 1
+	journalObjectCompressedZSTD = 1 << 2
+
+	journalObjectHeaderSize = 16
+	journalEntryHeaderSize  = 64
+	journalMaxObjectSize    = 64 * 1024 * 1024
+)
+
+var errJournalCompressionUnsupported = errors.New("unsupported journal compression")
+
+var journalZstd, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+
+type journalFile struct {
+	path string
+	f    *os.File
+
+	compact          bool
+	seqnumID         [16]byte
+	entryArrayOffset uint64
+	tailSeqnum       uint64
+	tailRealtime     uint64
+}
+
+// journalEntryRef is an entry's position in the file plus the header fields
+// needed for ordering.
+type journalEntryRef struct {
+	offset    uint64
+	seqnum    uint64
+	realtime  uint64
+	monotonic uint64
+	bootID    [16]byte
+}
+
+func openJournalFile(path string) (*journalFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	hdr := make([]byte, 208)
+	if _, err := f.ReadAt(hdr, 0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: read header: %w", path, err)
+	}
+	if string(hdr[:8]) != journalSignature {
+		f.Close()
+		return nil, fmt.Errorf("%s: not a journal file", path)
+	}
+
+	incompat := binary.LittleEndian.Uint32(hdr[12:])
+	jf := &journalFile{
+		path:             path,
+		f:                f,
+		compact:          incompat&journalIncompatCompact != 0,
+		entryArrayOffset: binary.LittleEndian.Uint64(hdr[176:]),
+		tailSeqnum:       binary.LittleEndian.Uint64(hdr[160:]),
+		tailRealtime:     binary.LittleEndian.Uint64(hdr[192:]),
+	}
+	copy(jf.seqnumID[:], hdr[72:88])
+	return jf, nil
+}
+
+func (jf *journalFile) Close() error {
+	return jf.f.Close()
+}
+
+func (jf *journalFile) readObject(offset uint64, want uint8) ([]byte, uint8, error) {
+	// Most objects are small; read a chunk up front and only go back for
+	// the remainder when needed.
+	buf := make([]byte, 256)
+	n, err := jf.f.ReadAt(buf, int64(offset))
+	if n < journalObjectHeaderSize {
+		if err == nil {
+			err = errors.New("short read")
+		}
+		return nil, 0, fmt.Errorf("object at %d: %w", offset, err)
+	}
+
+	typ, flags := buf[0], buf[1]
+	size := binary.LittleEndian.Uint64(buf[8:])
+	if typ != want || size < journalObjectHeaderSize || size > journalMaxObjectSize {
+		return nil, 0, fmt.Errorf("object at %d: unexpected type %d size %d", offset, typ, size)
+	}
+
+	if size <= uint64(n) {
+		return buf[:size], flags, nil
+	}
+	obj := make([]byte, size)
+	copy(obj, buf[:n])
+	if _, err := jf.f.ReadAt(obj[n:], int64(offset)+int64(n)); err != nil {
+		return nil, 0, fmt.Errorf("object at %d: %w", offset, err)
+	}
+	return obj, flags, nil
+}
+
+func (jf *journalFile) itemSize() uint64 {
+	if jf.compact {
+		return 4
+	}
+	return 8
+}
+
+// entryArray returns the next array offset and the entry offsets stored in
+// the array at offset; unused (zero) slots are dropped.
+func (jf *journalFile) entryArray(offset uint64) (uint64, []uint64, error) {
+	obj, _, err := jf.readObject(offset, journalObjectEntryArray)
+	if err != nil {
+		return 0, nil, err
+	}
+	next := binary.LittleEndian.Uint64(obj[16:])
+
+	size := jf.itemSize()
+	items := make([]uint64, 0, (uint64(len(obj))-24)/size)
+	for p := uint64(24); p+size <= uint64(len(obj)); p += size {
+		var off uint64
+		if jf.compact {
+			off = uint64(binary.LittleEndian.Uint32(obj[p:]))
+		} else {
+			off = binary.LittleEndian.Uint64(obj[p:])
+		}
+		if off == 0 {
+			break
+		}
+		items = append(items, off)
+	}
+	return next, items, nil
+}
+
+func (jf *journalFile) entryRef(offset uint64) (journalEntryRef, error) {
+	buf := make([]byte, journalEntryHeaderSize)
+	if _, err := jf.f.ReadAt(buf, int64(offset)); err != nil {
+		return journalEntryRef{}, err
+	}
+	if buf[0] != journalObjectEntry {
+		return journalEntryRef{}, fmt.Errorf("object at %d: not an entry", offset)
+	}
+	ref := journalEntryRef{
+		offset:    offset,
+		seqnum:    binary.LittleEndian.Uint64(buf[16:]),
+		realtime:  binary.LittleEndian.Uint64(buf[24:]),
+		monotonic: binary.LittleEndian.Uint64(buf[32:]),
+	}
+	copy(ref.bootID[:], buf[40:56])
+	return ref, nil
+}
+
+// entriesAfter returns up to limit entries for which after(ref) holds,
+// assuming after is monotonic over the file's entry order. Whole arrays are
+// skipped by checking their last entry, and the first array with matches is
+// binary searched.
+func (jf *journalFile) entriesAfter(after func(journalEntryRef) bool, limit int) ([]journalEntryRef, error) {
+	var refs []journalEntryRef
+	for offset := jf.entryArrayOffset; offset != 0 && len(refs) < limit; {
+		next, items, err := jf.entryArray(offset)
+		if err != nil {
+			return refs, err
+		}
+		offset = next
+		if len(items) == 0 {
+			continue
+		}
+
+		start := 0
+		if len(refs) == 0 {
+			last, err := jf.entryRef(items[len(items)-1])
+			if err != nil {
+				return refs, err
+			}
+			if !after(last) {
+				continue
+			}
+			lo, hi := 0, len(items)-1
+			for lo < hi {
+				mid := (lo + hi) / 2
+				ref, err := jf.entryRef(items[mid])
+				if err != nil {
+					return refs, err
+				}
+				if after(ref) {
+					hi = mid
+				} else {
+					lo = mid + 1
+				}
+			}
+			start = lo
+		}
+
+		for _, item := range items[start:] {
+			if len(refs) >= limit {
+				break
+			}
+			ref, err := jf.entryRef(item)
+			if err != nil {
+				return refs, err
+			}
+			refs = append(refs, ref)
+		}
+	}
+	return refs, nil
+}
+
+// fields reads the FIELD=value pairs of an entry. Fields that can't be read
+// (e.g. XZ compressed) are skipped.
+func (jf *journalFile) fields(ref journalEntryRef) (map[string]string, error) {
+	obj, _, err := jf.readObject(ref.offset, journalObjectEntry)
+	if err != nil {
+		return nil, err
+	}
+
+	itemSize := uint64(16)
+	if jf.compact {
+		itemSize = 4
+	}
+
+	fields := make(map[string]string, (uint64(len(obj))-journalEntryHeaderSize)/itemSize)
+	for p := uint64(journalEntryHeaderSize); p+itemSize <= uint64(len(obj)); p += itemSize {
+		var dataOffset uint64
+		if jf.compact {
+			dataOffset = uint64(binary.LittleEndian.Uint32(obj[p:]))
+		} else {
+			dataOffset = binary.LittleEndian.Uint64(obj[p:])
+		}
+
+		payload, err := jf.dataPayload(dataOffset)
+		if err != nil {
+			continue
+		}
+		if k, v, ok := bytes.Cut(payload, []byte{'='}); ok {
+			fields[string(k)] = string(v)
+		}
+	}
+	return fields, nil
+}
+
+func (jf *journalFile) dataPayload(offset uint64) ([]byte, error) {
+	obj, flags, err := jf.readObject(offset, journalObjectData)
+	if err != nil {
+		return nil, err
+	}
+
+	start := uint64(64)
+	if jf.compact {
+		start = 72
+	}
+	if uint64(len(obj)) < start {
+		return nil, fmt.Errorf("data object at %d: truncated", offset)
+	}
+	payload := obj[start:]
+
+	switch {
+	case flags&journalObjectCompressedZSTD != 0:
+		return journalZstd.DecodeAll(payload, nil)
+	case flags&journalObjectCompressedLZ4 != 0:
+		// 8-byte little endian uncompressed size, then an LZ4 block.
+		if len(payload) < 8 {
+			return nil, fmt.Errorf("data object at %d: truncated", offset)
+		}
+		size := binary.LittleEndian.Uint64(payload)
+		if size > journalMaxObjectSize {
+			return nil, fmt.Errorf("data object at %d: too large", offset)
+		}
+		out := make([]byte, size)
+		n, err := lz4.UncompressBlock(payload[8:], out)
+		if err != nil {
+			return nil, err
+		}
+		return out[:n], nil
+	case flags&journalObjectCompressedXZ != 0:
+		return nil, errJournalCompressionUnsupported
+	}
+	return payload, nil
+}
+
+func (ref journalEntryRef) bootIDString() string {
+	return hex.EncodeToString(ref.bootID[:])
+}
+
+// journalFiles lists the journal files below the given journal directories
+// (each containing per machine-id subdirectories). Files with a trailing ~
+// were not closed cleanly and are skipped.
+func journalFiles(dirs []string) []string {
+	var files []string
+	for _, dir := range dirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*", "*.journal"))
+		for _, m := range matches {
+			if !strings.HasSuffix(m, "~") {
+				files = append(files, m)
+			}
+		}
+	}
+	return files
+}
@@ -0,0 +1,230 @@
+package collector
+
+import (
+	"encoding/hex"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/uptime-id/agent/models"
+)
+
+const (
+	journalStateName      = "journal"
+	journalBackfill       = 10 * time.Minute
+	maxJournalPerTick     = 2000
+	maxJournalScanPerTick = 50000 // per file, including entries filtered out
+	defaultLogPriority    = 6     // LOG_INFO, as journalctl assumes for entries without PRIORITY
+)
+
+var journalDirs = []string{
+	"/host/var/log/journal", "/var/log/journal",
+	"/host/run/log/journal", "/run/log/journal",
+}
+
+// journalCursor marks the last shipped entry. Seqnums are only comparable
+// within one seqnum ID; across IDs the realtime timestamp is used.
+type journalCursor struct {
+	SeqnumID string `json:"seqnumId"`
+	Seqnum   uint64 `json:"seqnum"`
+	Realtime uint64 `json:"realtime"` // µs
+}
+
+type journalRecord struct {
+	ref      journalEntryRef
+	seqnumID string
+	fields   map[string]string
+}
+
+type journalReader struct {
+	dirs  []string
+	state *stateStore
+
+	// cursor is where the next read starts; committed is the position of
+	// the last delivered entry, the one persisted.
+	cursor    *journalCursor
+	committed *journalCursor
+}
+
+func newJournalReader(dirs []string, state *stateStore) *journalReader {
+	r := &journalReader{dirs: dirs, state: state}
+	var c journalCursor
+	if state.load(journalStateName, &c) {
+		r.cursor, r.committed = &c, &c
+	}
+	return r
+}
+
+// journalBefore is the order entries are shipped in: by realtime, with the
+// seqnum breaking ties.
+func journalBefore(a, b journalEntryRef) bool {
+	if a.realtime != b.realtime {
+		return a.realtime < b.realtime
+	}
+	return a.seqnum < b.seqnum
+}
+
+// read returns up to limit entries accepted by keep, written since the last
+// call, oldest first, stopping before their records exceed budget bytes.
+// Entries keep rejects are skipped without counting against either, so noisy
+// units can't crowd out the ones wanted. On first start it backfills a short
+// window instead of replaying the whole journal. The cursor only moves past
+// the entries returned, and is only persisted by commit.
+func (r *journalReader) read(limit int, budget int64, keep func(fields map[string]string) bool) []journalRecord {
+	if r.cursor == nil {
+		r.cursor = &journalCursor{Realtime: uint64(time.Now().Add(-journalBackfill).UnixMicro())}
+		r.committed = r.cursor
+	}
+	cursor := *r.cursor
+
+	var scanned []journalRecord
+	var horizon *journalEntryRef // last entry scanned in a file cut short
+	for _, path := range journalFiles(r.dirs) {
+		jf, err := openJournalFile(path)
+		if err != nil {
+			log.Printf("Journal: %v", err)
+			continue
+		}
+
+		seqnumID := hex.EncodeToString(jf.seqnumID[:])
+		sameSeqnum := seqnumID == cursor.SeqnumID
+		if (sameSeqnum && jf.tailSeqnum <= cursor.Seqnum) || (!sameSeqnum && jf.tailRealtime <= cursor.Realtime) {
+			jf.Close()
+			continue
+		}
+
+		refs, err := jf.entriesAfter(func(ref journalEntryRef) bool {
+			if sameSeqnum {
+				return ref.seqnum > cursor.Seqnum
+			}
+			return ref.realtime > cursor.Realtime
+		}, maxJournalScanPerTick)
+		if err != nil {
+			// Active files can have a partially written tail; keep what we got.
+			log.Printf("Journal %s: %v", path, err)
+		}
+		if len(refs) == maxJournalScanPerTick {
+			if last := refs[len(refs)-1]; horizon == nil || journalBefore(last, *horizon) {
+				horizon = &last
+			}
+		}
+
+		for _, ref := range refs {
+			fields, err := jf.fields(ref)
+			if err != nil {
+				continue
+			}
+			rec := journalRecord{ref: ref, seqnumID: seqnumID}
+			if keep(fields) {
+				rec.fields = fields
+			}
+			scanned = append(scanned, rec)
+		}
+		jf.Close()
+	}
+
+	records, last := selectJournalRecords(scanned, horizon, limit, budget)
+	if last != nil {
+		r.cursor = &journalCursor{SeqnumID: last.seqnumID, Seqnum: last.ref.seqnum, Realtime: last.ref.realtime}
+	}
+	return records
+}
+
+// selectJournalRecords sorts the scanned entries and returns the kept ones
+// (those with fields), up to limit and budget bytes, along with the last
+// entry passed over, where the next read resumes. The first kept entry is
+// taken whatever its size, so an oversized one can't stall the journal.
+// Nothing past horizon is taken: entries of the file that was cut short
+// there may still be unread.
+func selectJournalRecords(scanned []journalRecord, horizon *journalEntryRef, limit int, budget int64) ([]journalRecord, *journalRecord) {
+	sort.Slice(scanned, func(i, j int) bool { return journalBefore(scanned[i].ref, scanned[j].ref) })
+
+	var records []journalRecord
+	var last *journalRecord
+	for i := range scanned {
+		if horizon != nil && journalBefore(*horizon, scanned[i].ref) {
+			break
+		}
+		if scanned[i].fields != nil {
+			size := scanned[i].size()
+			if len(records) == limit || (len(records) > 0 && size > budget) {
+				break
+			}
+			budget -= size
+			records = append(records, scanned[i])
+		}
+		last = &scanned[i]
+	}
+	return records, last
+}
+
+// commit persists the position of everything read so far, once it has been
+// delivered.
+func (r *journalReader) commit() {
+	if r.cursor != nil && r.cursor != r.committed {
+		r.committed = r.cursor
+		r.state.save(journalStateName, r.committed)
+	}
+}
+
+// rewind goes back to the last committed position, so entries whose
+// delivery failed are read again.
+func (r *journalReader) rewind() {
+	r.cursor = r.committed
+}
+
+// logSeverities maps syslog priorities (0 = emerg .. 7 = debug) to names.
+var logSeverities = []string{"emergency", "alert", "critical", "error", "warning", "notice", "info", "debug"}
+
+func (rec journalRecord) toRecord(stream string) models.LogRecord {
+	f := rec.fields
+	priority := defaultLogPriority
+	if p, err := strconv.Atoi(f["PRIORITY"]); err == nil && p >= 0 && p < len(logSeverities) {
+		priority = p
+	}
+
+	fields := map[string]string{
+		"bootId":    rec.ref.bootIDString(),
+		"monotonic": strconv.FormatUint(rec.ref.monotonic, 10),
+	}
+	for key, name := range map[string]string{
+		"SYSLOG_IDENTIFIER": "identifier",
+		"_COMM":             "comm",
+		"_PID":              "pid",
+		"_TRANSPORT":        "transport",
+	} {
+		if v := f[key]; v != "" {
+			fields[name] = v
+		}
+	}
+
+	return models.LogRecord{
+		Timestamp: int64(rec.ref.realtime / 1000),
+		Source:    stream,
+		Input:     "journal",
+		Severity:  logSeverities[priority],
+		Host:      f["_HOSTNAME"],
+		Unit:      f["_SYSTEMD_UNIT"],
+		Message:   f["MESSAGE"],
+		Fields:    fields,
+	}
+}
+
+// size is what the entry's record counts against the log budget.
+func (rec journalRecord) size() int64 {
+	return int64(rec.toRecord(journalStream(rec.fields)).Size())
+}
+
+// journalStream classifies an entry the way the journalctl based collector
+// used to select it: kernel messages are system logs, the securityApps are
+// security.
+func journalStream(fields map[string]string) string {
+	switch {
+	case securityApps[fields["SYSLOG_IDENTIFIER"]] || securityApps[fields["_COMM"]]:
+		return "security"
+	case fields["_TRANSPORT"] == "kernel":
+		return "system"
+	}
+	return ""
+}
@@ -0,0 +1,208 @@
+package collector
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type testJournalEntry struct {
+	seqnum   uint64
+	realtime time.Time
+	fields   []string // FIELD=value
+}
+
+// writeTestJournal writes a journal file with one data object per field,
+// one entry object per entry and a single entry array. In compact mode the
+// data payloads are zstd compressed.
+func writeTestJournal(t *testing.T, dir string, compact bool, entries []testJournalEntry) {
+	t.Helper()
+	buf := make([]byte, 208)
+	copy(buf, journalSignature)
+	if compact {
+		binary.LittleEndian.PutUint32(buf[12:], journalIncompatCompact|journalIncompatCompressedZSTD)
+	}
+	copy(buf[72:88], "0123456789abcdef") // seqnum ID
+
+	align := func() {
+		for len(buf)%8 != 0 {
+			buf = append(buf, 0)
+		}
+	}
+	object := func(typ, flags uint8, body []byte) uint64 {
+		align()
+		offset := uint64(len(buf))
+		hdr := make([]byte, 16)
+		hdr[0], hdr[1] = typ, flags
+		binary.LittleEndian.PutUint64(hdr[8:], uint64(16+len(body)))
+		buf = append(buf, hdr...)
+		buf = append(buf, body...)
+		return offset
+	}
+
+	enc, _ := zstd.NewWriter(nil)
+	defer enc.Close()
+	var entryOffsets []uint64
+	for _, e := range entries {
+		var items []byte
+		for _, f := range e.fields {
+			payload, flags := []byte(f), uint8(0)
+			dataHeader := 64 - 16
+			if compact {
+				payload, flags = enc.EncodeAll(payload, nil), journalObjectCompressedZSTD
+				dataHeader = 72 - 16
+			}
+			data := object(journalObjectData, flags, append(make([]byte, dataHeader), payload...))
+			if compact {
+				items = binary.LittleEndian.AppendUint32(items, uint32(data))
+			} else {
+				items = binary.LittleEndian.AppendUint64(items, data)
+				items = binary.LittleEndian.AppendUint64(items, 0) // hash
+			}
+		}
+		body := make([]byte, 64-16)
+		binary.LittleEndian.PutUint64(body[0:], e.seqnum)
+		binary.LittleEndian.PutUint64(body[8:], uint64(e.realtime.UnixMicro()))
+		entryOffsets = append(entryOffsets, object(journalObjectEntry, 0, append(body, items...)))
+	}
+
+	array := make([]byte, 8) // next array
+	for _, off := range entryOffsets {
+		if compact {
+			array = binary.LittleEndian.AppendUint32(array, uint32(off))
+		} else {
+			array = binary.LittleEndian.AppendUint64(array, off)
+		}
+	}
+	arrayOffset := object(journalObjectEntryArray, 0, array)
+
+	last := entries[len(entries)-1]
+	binary.LittleEndian.PutUint64(buf[160:], last.seqnum)
+	binary.LittleEndian.PutUint64(buf[176:], arrayOffset)
+	binary.LittleEndian.PutUint64(buf[192:], uint64(last.realtime.UnixMicro()))
+
+	if err := os.MkdirAll(filepath.Join(dir, "machine"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "machine", "system.journal"), buf, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func journalMessages(records []journalRecord) string {
+	var msgs []string
+	for _, r := range records {
+		msgs = append(msgs, r.fields["MESSAGE"])
+	}
+	return strings.Join(msgs, ",")
+}
+
+func TestJournalReader(t *testing.T) {
+	now := time.Now()
+	entries := []testJournalEntry{
+		{1, now.Add(-time.Hour), []string{"_TRANSPORT=kernel", "MESSAGE=too old"}},
+		{2, now.Add(-5 * time.Second), []string{"_TRANSPORT=kernel", "MESSAGE=k1"}},
+		{3, now.Add(-4 * time.Second), []string{"_TRANSPORT=journal", "_SYSTEMD_UNIT=noisy.service", "MESSAGE=noise"}},
+		{4, now.Add(-4 * time.Second), []string{"_TRANSPORT=journal", "_SYSTEMD_UNIT=noisy.service", "MESSAGE=noise"}},
+		{5, now.Add(-3 * time.Second), []string{"SYSLOG_IDENTIFIER=sshd", "PRIORITY=5", "MESSAGE=s1"}},
+		{6, now.Add(-2 * time.Second), []string{"_TRANSPORT=kernel", "MESSAGE=k2"}},
+	}
+	keep := func(fields map[string]string) bool { return journalStream(fields) != "" }
+
+	for _, compact := range []bool{false, true} {
+		name := "regular"
+		if compact {
+			name = "compact"
+		}
+		t.Run(name, func(t *testing.T) {
+			dir, stateDir := t.TempDir(), t.TempDir()
+			writeTestJournal(t, dir, compact, entries)
+			r := newJournalReader([]string{dir}, newStateStore(stateDir))
+
+			// The noise doesn't count against the limit.
+			if got := journalMessages(r.read(2, 1<<20, keep)); got != "k1,s1" {
+				t.Fatalf("first read = %q", got)
+			}
+			// Not delivered: the same entries come back.
+			r.rewind()
+			if got := journalMessages(r.read(2, 1<<20, keep)); got != "k1,s1" {
+				t.Fatalf("read after rewind = %q", got)
+			}
+			r.commit()
+			if got := journalMessages(r.read(2, 1<<20, keep)); got != "k2" {
+				t.Fatalf("second read = %q", got)
+			}
+
+			// Only the committed position survives a restart.
+			r = newJournalReader([]string{dir}, newStateStore(stateDir))
+			records := r.read(10, 1<<20, keep)
+			if got := journalMessages(records); got != "k2" {
+				t.Fatalf("read after restart = %q", got)
+			}
+			rec := records[0].toRecord(journalStream(records[0].fields))
+			if rec.Source != "system" || rec.Severity != "info" || rec.Timestamp != entries[5].realtime.UnixMilli() {
+				t.Errorf("record = %+v", rec)
+			}
+
+			// A byte budget cuts the read after the first entry, and the
+			// cursor stays on it: the rest comes next time.
+			r = newJournalReader([]string{dir}, newStateStore(t.TempDir()))
+			if got := journalMessages(r.read(10, 1, keep)); got != "k1" {
+				t.Fatalf("read with a small budget = %q", got)
+			}
+			if got := journalMessages(r.read(10, 1<<20, keep)); got != "s1,k2" {
+				t.Fatalf("read after the budget ran out = %q", got)
+			}
+		})
+	}
+}
+
+func TestSelectJournalRecords(t *testing.T) {
+	rec := func(seqnum, realtime uint64, kept bool) journalRecord {
+		r := journalRecord{ref: journalEntryRef{seqnum: seqnum, realtime: realtime}}
+		if kept {
+			r.fields = map[string]string{"MESSAGE": "m"}
+		}
+		return r
+	}
+	size := rec(0, 0, true).size()
+	tests := []struct {
+		name     string
+		scanned  []journalRecord
+		horizon  *journalEntryRef
+		limit    int
+		budget   int64
+		wantKept int
+		wantLast uint64 // seqnum, 0 for none
+	}{
+		{"empty", nil, nil, 10, 1 << 20, 0, 0},
+		{"skipped entries advance the cursor", []journalRecord{rec(1, 10, false), rec(2, 20, false)}, nil, 10, 1 << 20, 0, 2},
+		{"sorted by realtime", []journalRecord{rec(9, 30, true), rec(2, 10, true), rec(5, 20, true)}, nil, 2, 1 << 20, 2, 5},
+		{"seqnum breaks ties", []journalRecord{rec(4, 10, true), rec(3, 10, true)}, nil, 1, 1 << 20, 1, 3},
+		{"limit stops after skipped entries", []journalRecord{rec(1, 10, true), rec(2, 20, false), rec(3, 30, true)}, nil, 1, 1 << 20, 1, 2},
+		{"budget", []journalRecord{rec(1, 10, true), rec(2, 20, false), rec(3, 30, true)}, nil, 10, 2*size - 1, 1, 2},
+		{"budget fits exactly", []journalRecord{rec(1, 10, true), rec(2, 20, true), rec(3, 30, true)}, nil, 10, 2 * size, 2, 2},
+		{"oversized first entry", []journalRecord{rec(1, 10, true), rec(2, 20, true)}, nil, 10, 1, 1, 1},
+		{"horizon", []journalRecord{rec(1, 10, true), rec(2, 20, true), rec(3, 30, true)}, &journalEntryRef{seqnum: 2, realtime: 20}, 10, 1 << 20, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, last := selectJournalRecords(tt.scanned, tt.horizon, tt.limit, tt.budget)
+			if len(kept) != tt.wantKept {
+				t.Errorf("kept %d, want %d", len(kept), tt.wantKept)
+			}
+			var lastSeqnum uint64
+			if last != nil {
+				lastSeqnum = last.ref.seqnum
+			}
+			if lastSeqnum != tt.wantLast {
+				t.Errorf("last = %d, want %d", lastSeqnum, tt.wantLast)
+			}
+		})
+	}
+}
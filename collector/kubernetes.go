@@ -0,0 +1,336 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+)
+
+const (
+	kubeletCacheTTL     = 15 * time.Second
+	kubeletTimeout      = 10 * time.Second
+	maxKubeletBodySize  = 32 * 1024 * 1024
+	dockerK8sNamePrefix = "k8s_"
+)
+
+// Minimal views of the kubelet /pods and /stats/summary responses.
+type kubePodList struct {
+	Items []kubePod `json:"items"`
+}
+
+type kubePod struct {
+	Metadata struct {
+		Name            string            `json:"name"`
+		Namespace       string            `json:"namespace"`
+		UID             string            `json:"uid"`
+		Labels          map[string]string `json:"labels"`
+		OwnerReferences []struct {
+			Kind       string `json:"kind"`
+			Name       string `json:"name"`
+			Controller *bool  `json:"controller"`
+		} `json:"ownerReferences"`
+	} `json:"metadata"`
+	Spec struct {
+		NodeName string `json:"nodeName"`
+	} `json:"spec"`
+	Status struct {
+		ContainerStatuses     []kubeContainerStatus `json:"containerStatuses"`
+		InitContainerStatuses []kubeContainerStatus `json:"initContainerStatuses"`
+	} `json:"status"`
+}
+
+type kubeContainerStatus struct {
+	Name         string `json:"name"`
+	ContainerID  string `json:"containerID"`
+	RestartCount int32  `json:"restartCount"`
+}
+
+type kubeStatsSummary struct {
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+			UID       string `json:"uid"`
+		} `json:"podRef"`
+		Containers []struct {
+			Name string `json:"name"`
+			CPU  *struct {
+				UsageNanoCores *uint64 `json:"usageNanoCores"`
+			} `json:"cpu"`
+			Memory *struct {
+				WorkingSetBytes *uint64 `json:"workingSetBytes"`
+			} `json:"memory"`
+		} `json:"containers"`
+	} `json:"pods"`
+}
+
+type kubeletClient struct {
+	baseURL   string
+	tokenFile string
+	client    *http.Client
+}
+
+// newKubeletClient talks to the kubelet at baseURL, authenticating with the
+// service account token read from tokenFile on every request (projected
+// tokens are rotated in place).
+func newKubeletClient(baseURL, tokenFile string, client *http.Client) *kubeletClient {
+	return &kubeletClient{
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		tokenFile: tokenFile,
+		client:    client,
+	}
+}
+
+func (k *kubeletClient) get(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if k.tokenFile != "" {
+		if token, err := os.ReadFile(k.tokenFile); err == nil {
+			req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+		}
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("kubelet %s: %d: %s", path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxKubeletBodySize)).Decode(out)
+}
+
+func (k *kubeletClient) pods(ctx context.Context) ([]kubePod, error) {
+	var list kubePodList
+	if err := k.get(ctx, "/pods", &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func (k *kubeletClient) statsSummary(ctx context.Context) (*kubeStatsSummary, error) {
+	var summary kubeStatsSummary
+	if err := k.get(ctx, "/stats/summary", &summary); err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+func newKubeletHTTPClient(cfg *config.Config) *http.Client {
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.KubeletInsecure}
+	if !cfg.KubeletInsecure && cfg.KubeletCAFile != "" {
+		if pem, err := os.ReadFile(cfg.KubeletCAFile); err == nil {
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			pool.AppendCertsFromPEM(pem)
+			tlsConfig.RootCAs = pool
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Timeout: kubeletTimeout, Transport: transport}
+}
+
+// podIndex resolves Docker containers to their pod, either by container ID
+// or by the k8s_<container>_<pod>_<namespace>_<uid>_<attempt> naming scheme.
+type podIndex struct {
+	byContainerID map[string]podRef
+	byUID         map[string]*kubePod
+	usage         map[string]kubeUsage // uid/container
+}
+
+type podRef struct {
+	pod       *kubePod
+	container kubeContainerStatus
+}
+
+type kubeUsage struct {
+	cpuNanoCores     uint64
+	memoryWorkingSet uint64
+}
+
+var kubelet struct {
+	mu      sync.Mutex
+	client  *kubeletClient
+	index   *podIndex
+	fetched time.Time
+	errOnce sync.Once
+}
+
+func kubernetesPodIndex(cfg *config.Config) *podIndex {
+	kubelet.mu.Lock()
+	defer kubelet.mu.Unlock()
+
+	if kubelet.index != nil && time.Since(kubelet.fetched) < kubeletCacheTTL {
+		return kubelet.index
+	}
+
+	if kubelet.client == nil {
+		if cfg.KubeletURL == "" {
+			kubelet.errOnce.Do(func() {
+				log.Println("Kubernetes mode enabled but neither KUBELET_URL nor NODE_NAME is set")
+			})
+			return nil
+		}
+		kubelet.client = newKubeletClient(cfg.KubeletURL, cfg.KubeletTokenFile, newKubeletHTTPClient(cfg))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kubeletTimeout)
+	defer cancel()
+
+	pods, err := kubelet.client.pods(ctx)
+	kubelet.fetched = time.Now()
+	if err != nil {
+		log.Printf("Kubelet pods error: %v", err)
+		return kubelet.index
+	}
+
+	var summary *kubeStatsSummary
+	if cfg.KubeletStatsSummary {
+		if summary, err = kubelet.client.statsSummary(ctx); err != nil {
+			log.Printf("Kubelet stats summary error: %v", err)
+		}
+	}
+
+	kubelet.index = buildPodIndex(pods, summary)
+	return kubelet.index
+}
+
+func buildPodIndex(pods []kubePod, summary *kubeStatsSummary) *podIndex {
+	idx := &podIndex{
+		byContainerID: map[string]podRef{},
+		byUID:         map[string]*kubePod{},
+		usage:         map[string]kubeUsage{},
+	}
+
+	for i := range pods {
+		pod := &pods[i]
+		idx.byUID[pod.Metadata.UID] = pod
+
+		for _, statuses := range [][]kubeContainerStatus{pod.Status.ContainerStatuses, pod.Status.InitContainerStatuses} {
+			for _, cs := range statuses {
+				// containerID is "<runtime>://<id>"
+				_, id, ok := strings.Cut(cs.ContainerID, "://")
+				if !ok || len(id) < 12 {
+					continue
+				}
+				idx.byContainerID[id[:12]] = podRef{pod: pod, container: cs}
+			}
+		}
+	}
+
+	if summary != nil {
+		for _, p := range summary.Pods {
+			for _, c := range p.Containers {
+				var u kubeUsage
+				if c.CPU != nil && c.CPU.UsageNanoCores != nil {
+					u.cpuNanoCores = *c.CPU.UsageNanoCores
+				}
+				if c.Memory != nil && c.Memory.WorkingSetBytes != nil {
+					u.memoryWorkingSet = *c.Memory.WorkingSetBytes
+				}
+				idx.usage[p.PodRef.UID+"/"+c.Name] = u
+			}
+		}
+	}
+
+	return idx
+}
+
+func (idx *podIndex) lookup(id, name string) (*kubePod, string, int32) {
+	if ref, ok := idx.byContainerID[id]; ok {
+		return ref.pod, ref.container.Name, ref.container.RestartCount
+	}
+
+	// k8s_<container>_<pod>_<namespace>_<uid>_<attempt>
+	if !strings.HasPrefix(name, dockerK8sNamePrefix) {
+		return nil, "", 0
+	}
+	parts := strings.Split(strings.TrimPrefix(name, dockerK8sNamePrefix), "_")
+	if len(parts) != 5 {
+		return nil, "", 0
+	}
+	pod, ok := idx.byUID[parts[3]]
+	if !ok {
+		return nil, "", 0
+	}
+	container := parts[0]
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == container {
+			return pod, container, cs.RestartCount
+		}
+	}
+	return pod, container, 0
+}
+
+func enrichKubernetes(cfg *config.Config, containers []models.ContainerInfo) {
+	idx := kubernetesPodIndex(cfg)
+	if idx == nil {
+		return
+	}
+
+	for i := range containers {
+		c := &containers[i]
+		pod, containerName, restarts := idx.lookup(c.ID, c.Name)
+		if pod == nil {
+			continue
+		}
+
+		ownerKind, ownerName := podOwner(pod)
+		info := &models.KubernetesInfo{
+			Node:      pod.Spec.NodeName,
+			Namespace: pod.Metadata.Namespace,
+			Pod:       pod.Metadata.Name,
+			PodUID:    pod.Metadata.UID,
+			Container: containerName,
+			OwnerKind: ownerKind,
+			OwnerName: ownerName,
+			Labels:    pod.Metadata.Labels,
+			Restarts:  restarts,
+		}
+		if u, ok := idx.usage[pod.Metadata.UID+"/"+containerName]; ok {
+			info.CPUNanoCores = u.cpuNanoCores
+			info.MemoryWorkingSet = u.memoryWorkingSet
+		}
+		c.Kubernetes = info
+	}
+}
+
+// podOwner returns the workload owning the pod, collapsing the ReplicaSet
+// created by a Deployment into the Deployment itself.
+func podOwner(pod *kubePod) (string, string) {
+	for _, ref := range pod.Metadata.OwnerReferences {
+		if ref.Controller == nil || !*ref.Controller {
+			continue
+		}
+		if ref.Kind == "ReplicaSet" {
+			if hash := pod.Metadata.Labels["pod-template-hash"]; hash != "" && strings.HasSuffix(ref.Name, "-"+hash) {
+				return "Deployment", strings.TrimSuffix(ref.Name, "-"+hash)
+			}
+		}
+		return ref.Kind, ref.Name
+	}
+	return "", ""
+}
@@ -0,0 +1,119 @@
+package collector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const kubeletPodsJSON = `{"items": [{
+	"metadata": {
+		"name": "web-7d4b9c8f6-abcde",
+		"namespace": "shop",
+		"uid": "0b5c1a2e-1111-2222-3333-444455556666",
+		"labels": {"app": "web", "pod-template-hash": "7d4b9c8f6"},
+		"ownerReferences": [{"kind": "ReplicaSet", "name": "web-7d4b9c8f6", "controller": true}]
+	},
+	"spec": {"nodeName": "node-1"},
+	"status": {
+		"containerStatuses": [
+			{"name": "nginx", "containerID": "containerd://4f1e2d3c4b5a69788796a5b4c3d2e1f00112233445566778899aabbccddeeff", "restartCount": 2},
+			{"name": "sidecar", "containerID": "", "restartCount": 0}
+		]
+	}
+}]}`
+
+const kubeletSummaryJSON = `{"pods": [{
+	"podRef": {"name": "web-7d4b9c8f6-abcde", "namespace": "shop", "uid": "0b5c1a2e-1111-2222-3333-444455556666"},
+	"containers": [{"name": "nginx", "cpu": {"usageNanoCores": 1500000}, "memory": {"workingSetBytes": 52428800}}]
+}]}`
+
+func fakeKubelet(t *testing.T, token string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	auth := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer "+token {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(body))
+		}
+	}
+	mux.HandleFunc("/pods", auth(kubeletPodsJSON))
+	mux.HandleFunc("/stats/summary", auth(kubeletSummaryJSON))
+	srv := httptest.NewTLSServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestKubeletPodLookup(t *testing.T) {
+	srv := fakeKubelet(t, "s3cret")
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	k := newKubeletClient(srv.URL+"/", tokenFile, srv.Client())
+
+	pods, err := k.pods(context.Background())
+	if err != nil {
+		t.Fatalf("pods: %v", err)
+	}
+	summary, err := k.statsSummary(context.Background())
+	if err != nil {
+		t.Fatalf("stats summary: %v", err)
+	}
+	idx := buildPodIndex(pods, summary)
+
+	tests := []struct {
+		name, id, dockerName string
+		wantContainer        string
+		wantRestarts         int32
+	}{
+		{"by container ID", "4f1e2d3c4b5a", "/whatever", "nginx", 2},
+		{"by k8s_ name", "ffffffffffff", "k8s_nginx_web-7d4b9c8f6-abcde_shop_0b5c1a2e-1111-2222-3333-444455556666_3", "nginx", 2},
+		{"by k8s_ name without status", "ffffffffffff", "k8s_sidecar_web-7d4b9c8f6-abcde_shop_0b5c1a2e-1111-2222-3333-444455556666_0", "sidecar", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod, container, restarts := idx.lookup(tt.id, tt.dockerName)
+			if pod == nil {
+				t.Fatal("pod not found")
+			}
+			if pod.Metadata.Name != "web-7d4b9c8f6-abcde" || container != tt.wantContainer || restarts != tt.wantRestarts {
+				t.Errorf("got %s/%s restarts %d", pod.Metadata.Name, container, restarts)
+			}
+		})
+	}
+
+	for _, miss := range [][2]string{
+		{"000000000000", "/nginx"},
+		{"000000000000", "k8s_nginx_web_shop_unknown-uid_0"},
+		{"000000000000", "k8s_too_few_parts"},
+	} {
+		if pod, _, _ := idx.lookup(miss[0], miss[1]); pod != nil {
+			t.Errorf("lookup(%q, %q) found %s", miss[0], miss[1], pod.Metadata.Name)
+		}
+	}
+
+	pod, _, _ := idx.lookup("4f1e2d3c4b5a", "")
+	if kind, name := podOwner(pod); kind != "Deployment" || name != "web" {
+		t.Errorf("owner = %s/%s, want Deployment/web", kind, name)
+	}
+	u := idx.usage[pod.Metadata.UID+"/nginx"]
+	if u.cpuNanoCores != 1500000 || u.memoryWorkingSet != 52428800 {
+		t.Errorf("usage = %+v", u)
+	}
+}
+
+func TestKubeletUnauthorized(t *testing.T) {
+	srv := fakeKubelet(t, "s3cret")
+	k := newKubeletClient(srv.URL, "", srv.Client())
+	if _, err := k.pods(context.Background()); err == nil {
+		t.Fatal("expected an error without a token")
+	}
+}
@@ -0,0 +1,509 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptime-id/agent/models"
+)
+
+// Log formats that can be configured per file source or container label:
+// json, logfmt, syslog (RFC 5424 or RFC 3164, detected per line), rfc3164,
+// rfc5424, nginx / apache (combined access log) and regex (named groups).
+type logParser struct {
+	format string
+	re     *regexp.Regexp
+}
+
+var (
+	rfc3164Line = regexp.MustCompile(`^(?:<(\d{1,3})>)?([A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}|\d{4}-\d{2}-\d{2}T\S+) (\S+) ([^\s:\[]+)(?:\[(\d+)\])?: ?(.*)$`)
+	rfc5424Head = regexp.MustCompile(`^(?:<(\d{1,3})>)?1 (\S+) (\S+) (\S+) (\S+) (\S+) `)
+	combinedLog = regexp.MustCompile(`^(\S+) \S+ (\S+) \[([^\]]+)\] "([^"]*)" (\d{3}) (\d+|-)(?: "([^"]*)" "([^"]*)")?`)
+)
+
+func newLogParser(format, pattern string) (*logParser, error) {
+	switch format {
+	case "":
+		return nil, nil
+	case "json", "logfmt", "syslog", "rfc3164", "rfc5424", "nginx", "apache":
+		return &logParser{format: format}, nil
+	case "regex":
+		if pattern == "" {
+			return nil, errors.New("regex format requires a pattern")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if re.NumSubexp() == 0 || strings.Join(re.SubexpNames(), "") == "" {
+			return nil, errors.New("regex pattern has no named groups")
+		}
+		return &logParser{format: format, re: re}, nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+var (
+	containerParsersMu sync.Mutex
+	containerParsers   = map[string]*logParser{}
+)
+
+// containerLogParser compiles the parser a container asks for through its
+// labels once; a broken label is logged once and the logs are shipped raw.
+func containerLogParser(format, pattern string) *logParser {
+	key := format + "\x00" + pattern
+	containerParsersMu.Lock()
+	defer containerParsersMu.Unlock()
+
+	if p, ok := containerParsers[key]; ok {
+		return p
+	}
+	p, err := newLogParser(format, pattern)
+	if err != nil {
+		log.Printf("Container log format %q: %v", format, err)
+	}
+	containerParsers[key] = p
+	return p
+}
+
+// apply parses rec.Message in place. Lines the format doesn't match keep
+// their raw message and are flagged with ParseError.
+func (p *logParser) apply(rec *models.LogRecord) {
+	if p == nil {
+		return
+	}
+
+	var fields map[string]string
+	var ok bool
+	switch p.format {
+	case "json":
+		fields, ok = parseJSONLog(rec.Message)
+	case "logfmt":
+		fields, ok = parseLogfmt(rec.Message)
+	case "syslog":
+		if fields, ok = parseRFC5424(rec.Message); !ok {
+			fields, ok = parseRFC3164(rec.Message)
+		}
+	case "rfc3164":
+		fields, ok = parseRFC3164(rec.Message)
+	case "rfc5424":
+		fields, ok = parseRFC5424(rec.Message)
+	case "nginx", "apache":
+		fields, ok = parseCombinedLog(rec.Message)
+	case "regex":
+		fields, ok = parseNamedGroups(p.re, rec.Message)
+	}
+	if !ok {
+		rec.ParseError = true
+		return
+	}
+	applyLogFields(rec, fields)
+}
+
+// applyLogFields lifts the well-known keys (message, time, level, host) into
+// the record and keeps the rest as fields.
+func applyLogFields(rec *models.LogRecord, fields map[string]string) {
+	take := func(keys ...string) (string, bool) {
+		for _, k := range keys {
+			if v, ok := fields[k]; ok {
+				delete(fields, k)
+				return v, true
+			}
+		}
+		return "", false
+	}
+
+	if msg, ok := take("message", "msg"); ok {
+		rec.Message = msg
+	}
+	if ts, ok := take("timestamp", "time", "ts", "@timestamp"); ok {
+		if t, ok := parseLogTime(ts); ok {
+			rec.Timestamp = t.UnixMilli()
+		} else {
+			fields["time"] = ts
+		}
+	}
+	if level, ok := take("severity", "level", "lvl", "loglevel", "log.level"); ok {
+		if sev := normalizeSeverity(level); sev != "" {
+			rec.Severity = sev
+		} else {
+			fields["level"] = level
+		}
+	}
+	if rec.Host == "" {
+		if host, ok := take("hostname", "host"); ok {
+			rec.Host = host
+		}
+	}
+
+	if len(fields) == 0 {
+		return
+	}
+	if rec.Fields == nil {
+		rec.Fields = make(map[string]string, len(fields))
+	}
+	for k, v := range fields {
+		rec.Fields[k] = v
+	}
+}
+
+// normalizeSeverity maps level names used by common loggers, syslog
+// priorities (0-7) and pino/bunyan numeric levels (10-60) to syslog severity
+// names. Unknown levels return "".
+func normalizeSeverity(level string) string {
+	if n, err := strconv.Atoi(level); err == nil {
+		switch {
+		case n >= 0 && n < len(logSeverities):
+			return logSeverities[n]
+		case n >= 60:
+			return "critical"
+		case n >= 50:
+			return "error"
+		case n >= 40:
+			return "warning"
+		case n >= 30:
+			return "info"
+		case n >= 10:
+			return "debug"
+		}
+		return ""
+	}
+
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "emerg", "emergency", "panic":
+		return "emergency"
+	case "alert":
+		return "alert"
+	case "crit", "critical", "fatal":
+		return "critical"
+	case "err", "error", "eror":
+		return "error"
+	case "warn", "warning":
+		return "warning"
+	case "notice":
+		return "notice"
+	case "info", "information", "informational":
+		return "info"
+	case "debug", "dbug", "trace":
+		return "debug"
+	}
+	return ""
+}
+
+var logTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"02/Jan/2006:15:04:05 -0700",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+func parseLogTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		// Epoch seconds, milliseconds, microseconds or nanoseconds, told
+		// apart by magnitude.
+		switch {
+		case f > 1e17:
+			return time.Unix(0, int64(f)), true
+		case f > 1e14:
+			return time.UnixMicro(int64(f)), true
+		case f > 1e11:
+			return time.UnixMilli(int64(f)), true
+		case f > 1e9:
+			sec, frac := math.Modf(f)
+			return time.Unix(int64(sec), int64(frac*1e9)), true
+		}
+		return time.Time{}, false
+	}
+
+	for _, layout := range logTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+
+	// RFC 3164 timestamps carry no year or zone: assume local time within
+	// the last year.
+	if t, err := time.ParseInLocation(time.Stamp, s, time.Local); err == nil {
+		now := time.Now()
+		t = t.AddDate(now.Year(), 0, 0)
+		if t.After(now.Add(24 * time.Hour)) {
+			t = t.AddDate(-1, 0, 0)
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+func parseJSONLog(line string) (map[string]string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") {
+		return nil, false
+	}
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	var obj map[string]any
+	if err := dec.Decode(&obj); err != nil {
+		return nil, false
+	}
+
+	fields := make(map[string]string, len(obj))
+	flattenJSON("", obj, fields)
+	return fields, true
+}
+
+// flattenJSON turns nested objects into dotted keys; arrays are kept as
+// their JSON text.
+func flattenJSON(prefix string, obj map[string]any, out map[string]string) {
+	for k, v := range obj {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch v := v.(type) {
+		case nil:
+		case string:
+			out[key] = v
+		case map[string]any:
+			flattenJSON(key, v, out)
+		case json.Number:
+			out[key] = v.String()
+		case bool:
+			out[key] = strconv.FormatBool(v)
+		default:
+			b, _ := json.Marshal(v)
+			out[key] = string(b)
+		}
+	}
+}
+
+// parseLogfmt parses key=value pairs with optional double-quoted values.
+// Bare words count as keys without a value; a line without any key=value
+// pair is not logfmt.
+func parseLogfmt(line string) (map[string]string, bool) {
+	fields := map[string]string{}
+	pairs := 0
+	for i := 0; i < len(line); {
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' {
+			i++
+		}
+		key := line[start:i]
+		if i >= len(line) || line[i] != '=' {
+			if key != "" {
+				fields[key] = ""
+			}
+			continue
+		}
+		i++ // '='
+
+		var value string
+		if i < len(line) && line[i] == '"' {
+			end := i + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return nil, false
+			}
+			v, err := strconv.Unquote(line[i : end+1])
+			if err != nil {
+				v = line[i+1 : end]
+			}
+			value, i = v, end+1
+		} else {
+			vstart := i
+			for i < len(line) && line[i] != ' ' {
+				i++
+			}
+			value = line[vstart:i]
+		}
+		if key == "" {
+			return nil, false
+		}
+		fields[key] = value
+		pairs++
+	}
+	return fields, pairs > 0
+}
+
+// syslogPriority splits a <PRI> value into facility and severity.
+func syslogPriority(pri string, fields map[string]string) {
+	if n, err := strconv.Atoi(pri); err == nil && n <= 191 {
+		fields["facility"] = strconv.Itoa(n / 8)
+		fields["severity"] = logSeverities[n%8]
+	}
+}
+
+func parseRFC3164(line string) (map[string]string, bool) {
+	m := rfc3164Line.FindStringSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+	fields := map[string]string{
+		"timestamp": m[2],
+		"hostname":  m[3],
+		"appName":   m[4],
+		"message":   m[6],
+	}
+	if m[1] != "" {
+		syslogPriority(m[1], fields)
+	}
+	if m[5] != "" {
+		fields["pid"] = m[5]
+	}
+	return fields, true
+}
+
+func parseRFC5424(line string) (map[string]string, bool) {
+	loc := rfc5424Head.FindStringSubmatchIndex(line)
+	if loc == nil {
+		return nil, false
+	}
+	group := func(i int) string {
+		if loc[2*i] < 0 {
+			return ""
+		}
+		return line[loc[2*i]:loc[2*i+1]]
+	}
+
+	fields := map[string]string{}
+	if pri := group(1); pri != "" {
+		syslogPriority(pri, fields)
+	}
+	for i, key := range []string{"", "", "timestamp", "hostname", "appName", "procId", "msgId"} {
+		if key == "" {
+			continue
+		}
+		if v := group(i); v != "-" {
+			fields[key] = v
+		}
+	}
+
+	rest, ok := parseStructuredData(line[loc[1]:], fields)
+	if !ok {
+		return nil, false
+	}
+	rest = strings.TrimPrefix(rest, " ")
+	fields["message"] = strings.TrimPrefix(rest, "\ufeff")
+	return fields, true
+}
+
+// parseStructuredData consumes RFC 5424 SD-ELEMENTs ([id key="value" ...])
+// into id.key fields and returns the remaining message.
+func parseStructuredData(s string, fields map[string]string) (string, bool) {
+	if strings.HasPrefix(s, "-") {
+		return s[1:], true
+	}
+	for strings.HasPrefix(s, "[") {
+		end := strings.IndexAny(s, " ]")
+		if end < 0 {
+			return "", false
+		}
+		id := s[1:end]
+		s = s[end:]
+
+		for strings.HasPrefix(s, " ") {
+			s = s[1:]
+			eq := strings.Index(s, `="`)
+			if eq < 0 {
+				return "", false
+			}
+			name := s[:eq]
+			s = s[eq+2:]
+
+			var value bytes.Buffer
+			i := 0
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`"\]`, s[i+1]) >= 0 {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return "", false
+			}
+			fields[id+"."+name] = value.String()
+			s = s[i+1:]
+		}
+
+		if !strings.HasPrefix(s, "]") {
+			return "", false
+		}
+		s = s[1:]
+	}
+	return s, true
+}
+
+// parseCombinedLog parses the nginx/apache combined (or common) access log
+// format. The raw line stays the message; severity follows the status code.
+func parseCombinedLog(line string) (map[string]string, bool) {
+	m := combinedLog.FindStringSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+	fields := map[string]string{
+		"clientIp":  m[1],
+		"timestamp": m[3],
+		"status":    m[5],
+	}
+	if m[2] != "-" {
+		fields["user"] = m[2]
+	}
+	if parts := strings.Fields(m[4]); len(parts) == 3 {
+		fields["method"], fields["path"], fields["protocol"] = parts[0], parts[1], parts[2]
+	} else {
+		fields["request"] = m[4]
+	}
+	if m[6] != "-" {
+		fields["bytes"] = m[6]
+	}
+	if m[7] != "" && m[7] != "-" {
+		fields["referer"] = m[7]
+	}
+	if m[8] != "" && m[8] != "-" {
+		fields["userAgent"] = m[8]
+	}
+
+	switch m[5][0] {
+	case '5':
+		fields["severity"] = "error"
+	case '4':
+		fields["severity"] = "warning"
+	default:
+		fields["severity"] = "info"
+	}
+	return fields, true
+}
+
+func parseNamedGroups(re *regexp.Regexp, line string) (map[string]string, bool) {
+	m := re.FindStringSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+	fields := map[string]string{}
+	for i, name := range re.SubexpNames() {
+		if name != "" && m[i] != "" {
+			fields[name] = m[i]
+		}
+	}
+	return fields, true
+}
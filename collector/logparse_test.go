@@ -0,0 +1,186 @@
+package collector
+
+import (
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/uptime-id/agent/models"
+)
+
+func TestParseLogTime(t *testing.T) {
+	want := time.Date(2024, 3, 5, 14, 7, 9, 123456000, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"1709647629", want.Truncate(time.Second)},
+		{"1709647629.123456", want},
+		{"1709647629123", want.Truncate(time.Millisecond)},
+		{"1709647629123456", want},
+		{"1709647629123456000", want},
+		{"2024-03-05T14:07:09.123456Z", want},
+		{"2024-03-05T16:07:09.123456+02:00", want},
+		{"2024-03-05 14:07:09.123456Z", want},
+		{"2024-03-05 14:07:09.123456", want},
+		{"2024-03-05T14:07:09.123456", want},
+		{"05/Mar/2024:16:07:09 +0200", want.Truncate(time.Second)},
+		{"Tue, 05 Mar 2024 16:07:09 +0200", want.Truncate(time.Second)},
+	}
+	for _, tt := range tests {
+		got, ok := parseLogTime(tt.in)
+		if !ok || !got.Round(time.Microsecond).Equal(tt.want) { // float epochs are off by a few ns
+			t.Errorf("parseLogTime(%q) = %v, %v; want %v", tt.in, got, ok, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "12345", "yesterday", "2024-13-45"} {
+		if got, ok := parseLogTime(in); ok {
+			t.Errorf("parseLogTime(%q) = %v, want no match", in, got)
+		}
+	}
+
+	// RFC 3164 stamps have no year: never more than a day in the future.
+	now := time.Now()
+	stamp := now.Add(-time.Hour).Format(time.Stamp)
+	if got, ok := parseLogTime(stamp); !ok || got.Year() != now.Add(-time.Hour).Year() {
+		t.Errorf("parseLogTime(%q) = %v, %v", stamp, got, ok)
+	}
+	stamp = now.Add(48 * time.Hour).Format(time.Stamp)
+	if got, ok := parseLogTime(stamp); !ok || got.After(now) {
+		t.Errorf("parseLogTime(%q) = %v, %v; want last year", stamp, got, ok)
+	}
+}
+
+func TestLogParsers(t *testing.T) {
+	ts := time.Date(2024, 3, 5, 14, 7, 9, 0, time.UTC).UnixMilli()
+	tests := []struct {
+		name, format, pattern, line string
+		want                        models.LogRecord
+	}{
+		{
+			name:   "json",
+			format: "json",
+			line:   `{"time":"2024-03-05T14:07:09Z","level":"WARN","msg":"disk low","ctx":{"free":12,"ok":false},"tags":["a"],"none":null}`,
+			want: models.LogRecord{Message: "disk low", Timestamp: ts, Severity: "warning",
+				Fields: map[string]string{"ctx.free": "12", "ctx.ok": "false", "tags": `["a"]`}},
+		},
+		{
+			name:   "json numeric level and unknown time",
+			format: "json",
+			line:   `{"level":50,"time":"soon","message":"boom","host":"web-1"}`,
+			want:   models.LogRecord{Message: "boom", Severity: "error", Host: "web-1", Fields: map[string]string{"time": "soon"}},
+		},
+		{
+			name:   "logfmt",
+			format: "logfmt",
+			line:   `ts=1709647629 level=info msg="request done" path=/api dur=12ms flag`,
+			want: models.LogRecord{Message: "request done", Timestamp: ts, Severity: "info",
+				Fields: map[string]string{"path": "/api", "dur": "12ms", "flag": ""}},
+		},
+		{
+			name:   "logfmt unknown level",
+			format: "logfmt",
+			line:   `lvl=chatty msg=hi`,
+			want:   models.LogRecord{Message: "hi", Fields: map[string]string{"level": "chatty"}},
+		},
+		{
+			name:   "rfc5424",
+			format: "syslog",
+			line:   `<165>1 2024-03-05T14:07:09Z web-1 app 42 ID47 [ex@1 k="v\"q" n="1"][other a="b"] ` + "\ufeff" + `hello`,
+			want: models.LogRecord{Message: "hello", Timestamp: ts, Severity: "notice", Host: "web-1",
+				Fields: map[string]string{"facility": "20", "appName": "app", "procId": "42", "msgId": "ID47",
+					"ex@1.k": `v"q`, "ex@1.n": "1", "other.a": "b"}},
+		},
+		{
+			name:   "rfc5424 nil values",
+			format: "rfc5424",
+			line:   `1 2024-03-05T14:07:09Z - app - - - plain`,
+			want:   models.LogRecord{Message: "plain", Timestamp: ts, Fields: map[string]string{"appName": "app"}},
+		},
+		{
+			name:   "rfc3164",
+			format: "syslog",
+			line:   `<38>2024-03-05T14:07:09Z host sshd[123]: Accepted key`,
+			want: models.LogRecord{Message: "Accepted key", Timestamp: ts, Severity: "info", Host: "host",
+				Fields: map[string]string{"facility": "4", "appName": "sshd", "pid": "123"}},
+		},
+		{
+			name:   "nginx",
+			format: "nginx",
+			line:   `10.0.0.1 - bob [05/Mar/2024:14:07:09 +0000] "GET /x?y=1 HTTP/1.1" 503 512 "-" "curl/8.0"`,
+			want: models.LogRecord{Message: `10.0.0.1 - bob [05/Mar/2024:14:07:09 +0000] "GET /x?y=1 HTTP/1.1" 503 512 "-" "curl/8.0"`,
+				Timestamp: ts, Severity: "error",
+				Fields: map[string]string{"clientIp": "10.0.0.1", "user": "bob", "status": "503", "method": "GET",
+					"path": "/x?y=1", "protocol": "HTTP/1.1", "bytes": "512", "userAgent": "curl/8.0"}},
+		},
+		{
+			name:   "apache common",
+			format: "apache",
+			line:   `::1 - - [05/Mar/2024:14:07:09 +0000] "-" 404 -`,
+			want: models.LogRecord{Message: `::1 - - [05/Mar/2024:14:07:09 +0000] "-" 404 -`, Timestamp: ts, Severity: "warning",
+				Fields: map[string]string{"clientIp": "::1", "status": "404", "request": "-"}},
+		},
+		{
+			name:    "regex",
+			format:  "regex",
+			pattern: `^(?P<time>\S+) \[(?P<level>\w+)\] (?P<msg>.*?)(?: id=(?P<id>\d+))?$`,
+			line:    `2024-03-05T14:07:09Z [ERROR] failed`,
+			want:    models.LogRecord{Message: "failed", Timestamp: ts, Severity: "error"},
+		},
+		{name: "json mismatch", format: "json", line: "not json", want: models.LogRecord{Message: "not json", ParseError: true}},
+		{name: "logfmt mismatch", format: "logfmt", line: "just words", want: models.LogRecord{Message: "just words", ParseError: true}},
+		{name: "logfmt unterminated", format: "logfmt", line: `a="b`, want: models.LogRecord{Message: `a="b`, ParseError: true}},
+		{name: "syslog mismatch", format: "syslog", line: "hello", want: models.LogRecord{Message: "hello", ParseError: true}},
+		{name: "rfc5424 bad structured data", format: "rfc5424", line: `1 - - - - - [x k="v] m`,
+			want: models.LogRecord{Message: `1 - - - - - [x k="v] m`, ParseError: true}},
+		{name: "access log mismatch", format: "nginx", line: "GET /", want: models.LogRecord{Message: "GET /", ParseError: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newLogParser(tt.format, tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := models.LogRecord{Message: tt.line}
+			p.apply(&rec)
+			if rec.Message != tt.want.Message || rec.Timestamp != tt.want.Timestamp || rec.Severity != tt.want.Severity ||
+				rec.Host != tt.want.Host || rec.ParseError != tt.want.ParseError {
+				t.Errorf("record = %+v\nwant %+v", rec, tt.want)
+			}
+			if !maps.Equal(rec.Fields, tt.want.Fields) {
+				t.Errorf("fields = %v\nwant %v", rec.Fields, tt.want.Fields)
+			}
+		})
+	}
+}
+
+func TestNewLogParserErrors(t *testing.T) {
+	for _, tt := range []struct{ format, pattern string }{
+		{"xml", ""},
+		{"regex", ""},
+		{"regex", `(`},
+		{"regex", `(\d+) (\w+)`},
+	} {
+		if _, err := newLogParser(tt.format, tt.pattern); err == nil {
+			t.Errorf("newLogParser(%q, %q) succeeded", tt.format, tt.pattern)
+		}
+	}
+	if p, err := newLogParser("", ""); p != nil || err != nil {
+		t.Errorf("empty format = %v, %v", p, err)
+	}
+}
+
+func TestNormalizeSeverity(t *testing.T) {
+	tests := map[string]string{
+		"0": "emergency", "3": "error", "7": "debug",
+		"10": "debug", "30": "info", "40": "warning", "50": "error", "60": "critical",
+		"FATAL": "critical", "Warn": "warning", "information": "info", "trace": "debug",
+		"loud": "", "-1": "",
+	}
+	for in, want := range tests {
+		if got := normalizeSeverity(in); got != want {
+			t.Errorf("normalizeSeverity(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -1,53 +1,147 @@
 package collector
 
 import (
-	"os"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
 
+	"github.com/uptime-id/agent/config"
 	"github.com/uptime-id/agent/models"
 )
 
-func collectSystemLogs(osName string) models.LogsInfo {
+var (
+	journal          *journalReader
+	journalMultiline *multilineRule
+	tailer           *fileTailer
+)
+
+// collectSystemLogs reads the event log on Windows, the journal elsewhere,
+// and the tailed files everywhere, reading at most budget bytes of the
+// files and the journal together. The journal gets what the files leave,
+// and at least half.
+func collectSystemLogs(osName string, budget int64) models.LogsInfo {
 	logs := models.LogsInfo{}
 
 	if osName == "windows" {
-		logs.System = runPowerShell(`Get-EventLog -LogName System -Newest 50 | Out-String`)
-		logs.Security = runPowerShell(`Get-EventLog -LogName Security -Newest 30 | Out-String`)
-		return logs
-	}
-
-	// System Logs
-	sysLog, err := runCmdWithErr("journalctl", "-k", "-b", "-n", "50", "--no-pager", "-o", "cat")
-	if err == nil && len(sysLog) > 10 {
-		logs.System = sysLog
-	} else {
-		paths := []string{
-			"/host/var/log/syslog", "/var/log/syslog",
-			"/host/var/log/messages", "/var/log/messages",
+		logs.Records = append(logs.Records, collectEventLog("System", "system", 50)...)
+		logs.Records = append(logs.Records, collectEventLog("Security", "security", 30)...)
+	}
+
+	tailBudget := budget
+	if journal != nil {
+		tailBudget = budget / 2
+	}
+	now := time.Now().UnixMilli()
+	for _, line := range tailer.poll(tailBudget) {
+		rec := models.LogRecord{
+			Timestamp: now,
+			Source:    line.Source,
+			Input:     "file",
+			Path:      line.Path,
+			Message:   line.Text,
 		}
-		for _, path := range paths {
-			if _, err := os.Stat(path); err == nil {
-				logs.System = readLastLines(path, 50)
-				break
-			}
+		budget -= int64(rec.Size())
+		logs.Records = append(logs.Records, logEvents.add("file:"+line.Path, line.Multiline, line.Parser, rec)...)
+	}
+
+	if journal != nil && budget > 0 {
+		keep := func(fields map[string]string) bool { return journalStream(fields) != "" }
+		for _, rec := range journal.read(maxJournalPerTick, budget, keep) {
+			key := "journal:" + rec.fields["_SYSTEMD_UNIT"] + ":" + rec.fields["_PID"]
+			logs.Records = append(logs.Records, logEvents.add(key, journalMultiline, nil, rec.toRecord(journalStream(rec.fields)))...)
+		}
+	}
+
+	return logs
+}
+
+type eventLogEntry struct {
+	Time    int64  `json:"time"`
+	Level   string `json:"level"`
+	Source  string `json:"source"`
+	EventID int64  `json:"eventId"`
+	Message string `json:"message"`
+}
+
+var eventLogSeverities = map[string]string{
+	"Error":        "error",
+	"Warning":      "warning",
+	"Information":  "info",
+	"SuccessAudit": "notice",
+	"FailureAudit": "warning",
+}
+
+func collectEventLog(logName, source string, newest int) []models.LogRecord {
+	out := runPowerShell(fmt.Sprintf(`Get-EventLog -LogName %s -Newest %d | Select-Object `+
+		`@{n='time';e={([DateTimeOffset]$_.TimeGenerated).ToUnixTimeMilliseconds()}},`+
+		`@{n='level';e={"$($_.EntryType)"}},@{n='source';e={$_.Source}},`+
+		`@{n='eventId';e={$_.InstanceId}},@{n='message';e={$_.Message}} | ConvertTo-Json -Compress`, logName, newest))
+
+	// ConvertTo-Json emits a bare object for a single entry.
+	var entries []eventLogEntry
+	if err := json.Unmarshal([]byte(out), &entries); err != nil {
+		var single eventLogEntry
+		if json.Unmarshal([]byte(out), &single) != nil {
+			return nil
 		}
+		entries = []eventLogEntry{single}
 	}
 
-	// Security Logs
-	secLog, err := runCmdWithErr("journalctl", "_COMM=sshd", "-n", "50", "--no-pager", "-o", "cat")
-	if err == nil && len(secLog) > 10 {
-		logs.Security = secLog
-	} else {
-		paths := []string{
-			"/host/var/log/auth.log", "/var/log/auth.log",
-			"/host/var/log/secure", "/var/log/secure",
+	records := make([]models.LogRecord, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- { // newest first from Get-EventLog
+		e := entries[i]
+		records = append(records, models.LogRecord{
+			Timestamp: e.Time,
+			Source:    source,
+			Input:     "eventlog",
+			Severity:  eventLogSeverities[e.Level],
+			Message:   e.Message,
+			Fields: map[string]string{
+				"provider": e.Source,
+				"eventId":  strconv.FormatInt(e.EventID, 10),
+			},
+		})
+	}
+	return records
+}
+
+// logTailSources returns the configured log files plus, when there is no
+// journal to read, the classic syslog and auth log files.
+func logTailSources(cfg *config.Config, hasJournal bool) []tailSource {
+	var sources []tailSource
+	if !hasJournal {
+		defaults := map[string][]string{
+			"system": {
+				"/host/var/log/syslog", "/var/log/syslog",
+				"/host/var/log/messages", "/var/log/messages",
+			},
+			"security": {
+				"/host/var/log/auth.log", "/var/log/auth.log",
+				"/host/var/log/secure", "/var/log/secure",
+			},
 		}
-		for _, path := range paths {
-			if _, err := os.Stat(path); err == nil {
-				logs.Security = readLastLines(path, 50)
-				break
+		for _, source := range []string{"system", "security"} {
+			for _, path := range defaults[source] {
+				if fileExists(path) {
+					sources = append(sources, tailSource{Source: source, Pattern: path, Parser: &logParser{format: "syslog"}})
+					break
+				}
 			}
 		}
 	}
 
-	return logs
+	for _, l := range cfg.LogFiles {
+		parser, err := newLogParser(l.Format, l.Regex)
+		if err != nil {
+			log.Printf("Log file %s: %v, shipping lines unparsed", l.Path, err)
+		}
+		rule, err := newMultilineRule(l.Multiline)
+		if err != nil {
+			log.Printf("Log file %s: %v, shipping lines unjoined", l.Path, err)
+		}
+		sources = append(sources, tailSource{Source: l.Source, Pattern: l.Path, Parser: parser, Multiline: rule})
+	}
+	return sources
 }
@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func logMessages(records []models.LogRecord) []string {
+	var msgs []string
+	for _, r := range records {
+		msgs = append(msgs, r.Message)
+	}
+	return msgs
+}
+
+func TestLogPositionsFailedSend(t *testing.T) {
+	savedTailer, savedJournal, savedEvents, savedCursors := tailer, journal, logEvents, containerCursors
+	t.Cleanup(func() {
+		tailer, journal, logEvents, containerCursors = savedTailer, savedJournal, savedEvents, savedCursors
+	})
+
+	dir, stateDir := t.TempDir(), t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "")
+	rule, err := newMultilineRule(config.MultilineConfig{Start: `^\d`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tailer = newFileTailer([]tailSource{{Source: "app", Pattern: path, Multiline: rule}}, newStateStore(stateDir))
+	journal = nil
+	logEvents = &logAssembler{pending: map[string]*pendingLogEvent{}}
+	containerCursors = newContainerLogCursors(newStateStore(stateDir))
+
+	collectSystemLogs("linux", 1<<20)
+	CommitLogPositions()
+
+	appendFile(t, path, "1 first\n  more\n2 second\n")
+	if got := logMessages(collectSystemLogs("linux", 1<<20).Records); len(got) != 1 || got[0] != "1 first\n  more" {
+		t.Fatalf("first collection = %q", got)
+	}
+	// The send failed: the event still pending is not completed by the
+	// lines read again, and nothing is shipped twice.
+	RewindLogPositions()
+	appendFile(t, path, "3 third\n")
+	if got := logMessages(collectSystemLogs("linux", 1<<20).Records); len(got) != 2 || got[0] != "1 first\n  more" || got[1] != "2 second" {
+		t.Fatalf("collection after rewind = %q", got)
+	}
+	CommitLogPositions()
+	if got := logMessages(logEvents.expired(time.Now().Add(time.Hour))); len(got) != 1 || got[0] != "3 third" {
+		t.Fatalf("expired = %q", got)
+	}
+
+	// Container cursors are only persisted and kept once committed.
+	containerCursors.since["abc"] = 5
+	CommitLogPositions()
+	containerCursors.since["abc"] = 9
+	containerCursors.prune([]container.Summary{{ID: "abc"}})
+	RewindLogPositions()
+	if got := containerCursors.since["abc"]; got != 5 {
+		t.Errorf("cursor after rewind = %d", got)
+	}
+	containerCursors.since["abc"] = 9
+	containerCursors.prune(nil)
+	if got := newContainerLogCursors(newStateStore(stateDir)).since["abc"]; got != 5 {
+		t.Errorf("cursor after restart = %d", got)
+	}
+}
@@ -0,0 +1,203 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+)
+
+const (
+	defaultMultilineTimeout  = 5 * time.Second
+	defaultMultilineMaxLines = 500
+)
+
+// Continuation patterns for common stack traces. A line matching the
+// pattern is appended to the event before it.
+var multilinePresets = map[string]string{
+	// "java.lang.IllegalStateException: ...", "\tat com.example.Foo.bar(Foo.java:12)",
+	// "Caused by: ...", "\t... 5 more"
+	"java": `^(\s+at\s|\s+\.\.\.\s+\d+\s+more|\s*Caused by:|\s+Suppressed:|\t|[\w.$]+(Exception|Error|Throwable)(:\s|$))`,
+	// The traceback header, indented frames, chained exception notes and the
+	// final "ValueError: ..." line.
+	"python": `^(\s+|Traceback \(most recent call last\):|During handling of the above exception|The above exception was the direct cause|[\w.]+(Error|Exception|Warning|Exit|Interrupt)\b)`,
+	// "goroutine 1 [running]:", "main.main()", "\t/src/main.go:12 +0x1d"
+	"go": `^(\s+|goroutine \d+ \[|created by |\[signal |exit status \d+|[\w./*()\-]+\(.*\)$)`,
+}
+
+// multilineRule decides whether a line starts a new event or continues the
+// previous one: with a start pattern every non-matching line continues, with
+// a continuation pattern every matching line does.
+type multilineRule struct {
+	start    *regexp.Regexp
+	cont     *regexp.Regexp
+	timeout  time.Duration
+	maxLines int
+}
+
+func newMultilineRule(c config.MultilineConfig) (*multilineRule, error) {
+	if c.Preset == "" && c.Start == "" && c.Continuation == "" {
+		return nil, nil
+	}
+
+	rule := &multilineRule{timeout: c.Timeout.Or(defaultMultilineTimeout), maxLines: c.MaxLines}
+	if rule.maxLines <= 0 {
+		rule.maxLines = defaultMultilineMaxLines
+	}
+
+	cont := c.Continuation
+	if c.Preset != "" {
+		preset, ok := multilinePresets[c.Preset]
+		if !ok {
+			return nil, fmt.Errorf("unknown multiline preset %q", c.Preset)
+		}
+		cont = preset
+	}
+
+	var err error
+	switch {
+	case c.Start != "" && cont != "":
+		return nil, errors.New("multiline takes either a start or a continuation pattern")
+	case c.Start != "":
+		rule.start, err = regexp.Compile(c.Start)
+	default:
+		rule.cont, err = regexp.Compile(cont)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (r *multilineRule) continues(line string) bool {
+	if r.start != nil {
+		return !r.start.MatchString(line)
+	}
+	return r.cont.MatchString(line)
+}
+
+var (
+	containerRulesMu sync.Mutex
+	containerRules   = map[config.MultilineConfig]*multilineRule{}
+)
+
+// containerMultilineRule compiles the rule a container asks for through its
+// labels once; a broken rule is logged once and leaves lines unjoined.
+func containerMultilineRule(c config.MultilineConfig) *multilineRule {
+	containerRulesMu.Lock()
+	defer containerRulesMu.Unlock()
+
+	if r, ok := containerRules[c]; ok {
+		return r
+	}
+	r, err := newMultilineRule(c)
+	if err != nil {
+		log.Printf("Container logs: multiline: %v", err)
+	}
+	containerRules[c] = r
+	return r
+}
+
+type pendingLogEvent struct {
+	rec    models.LogRecord
+	lines  []string
+	rule   *multilineRule
+	parser *logParser
+	seen   time.Time
+}
+
+// logAssembler joins multi-line events per stream (a file, a container's
+// stdout, a journal unit) and parses each event once it is complete. An
+// event is complete when the next event starts, it reaches the line limit,
+// or no continuation arrived within the rule's flush timeout.
+//
+// The pending events follow the log positions: committed holds them as they
+// were when the positions were last committed, so that after a rewind the
+// lines read again are joined to the same events instead of completing
+// them a second time.
+type logAssembler struct {
+	pending   map[string]*pendingLogEvent
+	committed map[string]*pendingLogEvent
+}
+
+var logEvents = &logAssembler{pending: map[string]*pendingLogEvent{}}
+
+func (a *logAssembler) add(key string, rule *multilineRule, parser *logParser, rec models.LogRecord) []models.LogRecord {
+	if rule == nil {
+		parser.apply(&rec)
+		return []models.LogRecord{rec}
+	}
+
+	var done []models.LogRecord
+	if p := a.pending[key]; p != nil {
+		if rule.continues(rec.Message) && len(p.lines) < rule.maxLines {
+			p.lines = append(p.lines, rec.Message)
+			p.seen = lineTime(rec)
+			return nil
+		}
+		done = append(done, p.complete())
+	}
+	a.pending[key] = &pendingLogEvent{rec: rec, lines: []string{rec.Message}, rule: rule, parser: parser, seen: lineTime(rec)}
+	return done
+}
+
+// lineTime is when a line was written if the source says so (journal,
+// Docker), otherwise when it was read.
+func lineTime(rec models.LogRecord) time.Time {
+	if rec.Timestamp > 0 {
+		return time.UnixMilli(rec.Timestamp)
+	}
+	return time.Now()
+}
+
+// expired completes events that saw no continuation within their timeout.
+func (a *logAssembler) expired(now time.Time) []models.LogRecord {
+	var done []models.LogRecord
+	for key, p := range a.pending {
+		if now.Sub(p.seen) >= p.rule.timeout {
+			done = append(done, p.complete())
+			delete(a.pending, key)
+		}
+	}
+	return done
+}
+
+// commit keeps the events pending now, those whose lines were read before
+// the committed positions.
+func (a *logAssembler) commit() {
+	a.committed = clonePendingEvents(a.pending)
+}
+
+// rewind restores the events pending at the last commit.
+func (a *logAssembler) rewind() {
+	a.pending = clonePendingEvents(a.committed)
+}
+
+func clonePendingEvents(events map[string]*pendingLogEvent) map[string]*pendingLogEvent {
+	clone := make(map[string]*pendingLogEvent, len(events))
+	for key, p := range events {
+		c := *p
+		c.lines = slices.Clone(p.lines)
+		c.rec.Fields = maps.Clone(p.rec.Fields)
+		clone[key] = &c
+	}
+	return clone
+}
+
+func (p *pendingLogEvent) complete() models.LogRecord {
+	rec := p.rec
+	rec.Message = p.lines[0]
+	p.parser.apply(&rec)
+	if len(p.lines) > 1 {
+		rec.Message += "\n" + strings.Join(p.lines[1:], "\n")
+	}
+	return rec
+}
@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/uptime-id/agent/models"
+)
+
+// netStackSampler turns the kernel's cumulative network counters into
+// per-second rates between collections.
+type netStackSampler struct {
+	prev   map[string]uint64
+	prevAt time.Time
+}
+
+var netStack = &netStackSampler{}
+
+// collect reads the network stack counters; rates are zero on the first
+// collection and across counter resets.
+func (s *netStackSampler) collect(now time.Time) *models.NetStackInfo {
+	counters, info, err := readNetStack()
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("Failed to read network stack counters: %v", err)
+		return nil
+	}
+
+	elapsed := now.Sub(s.prevAt).Seconds()
+	rate := func(keys ...string) float64 {
+		if s.prev == nil || elapsed <= 0 {
+			return 0
+		}
+		var delta uint64
+		for _, k := range keys {
+			if cur, prev := counters[k], s.prev[k]; cur >= prev {
+				delta += cur - prev
+			}
+		}
+		return float64(delta) / elapsed
+	}
+	info.TCPRetransSegs = rate("Tcp.RetransSegs")
+	info.TCPOutRsts = rate("Tcp.OutRsts")
+	info.TCPInErrs = rate("Tcp.InErrs")
+	info.TCPAttemptFails = rate("Tcp.AttemptFails")
+	info.TCPEstabResets = rate("Tcp.EstabResets")
+	info.TCPListenOverflows = rate("TcpExt.ListenOverflows")
+	info.TCPListenDrops = rate("TcpExt.ListenDrops")
+	info.TCPSyncookiesSent = rate("TcpExt.SyncookiesSent")
+	info.UDPInErrors = rate("Udp.InErrors", "Udp6.InErrors")
+	info.UDPRcvbufErrors = rate("Udp.RcvbufErrors", "Udp6.RcvbufErrors")
+	info.UDPSndbufErrors = rate("Udp.SndbufErrors", "Udp6.SndbufErrors")
+	info.UDPNoPorts = rate("Udp.NoPorts", "Udp6.NoPorts")
+	info.ConntrackDrops = rate("Conntrack.drop", "Conntrack.early_drop", "Conntrack.insert_failed")
+
+	s.prev, s.prevAt = counters, now
+	return info
+}
@@ -0,0 +1,160 @@
+package collector
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/uptime-id/agent/models"
+)
+
+// readNetStack gathers the counters of /proc/net/snmp, netstat, snmp6 and
+// stat/nf_conntrack, keyed "Tcp.RetransSegs", "Udp6.InErrors",
+// "Conntrack.drop" and so on, along with the socket and conntrack usage.
+// Only snmp is required; the other files depend on the kernel config.
+func readNetStack() (map[string]uint64, *models.NetStackInfo, error) {
+	counters := map[string]uint64{}
+	if err := readNetCounterPairs("snmp", counters); err != nil {
+		return nil, nil, err
+	}
+	readNetCounterPairs("netstat", counters)
+	if f, err := openNetFile("snmp6"); err == nil {
+		parseSnmp6(f, counters)
+		f.Close()
+	}
+	readConntrackStats(counters)
+
+	info := &models.NetStackInfo{}
+	sockstat := readSockstat("sockstat")
+	for k, v := range readSockstat("sockstat6") {
+		sockstat[k] = v
+	}
+	info.TCPInUse = sockstat["TCP.inuse"] + sockstat["TCP6.inuse"]
+	info.TCPOrphan = sockstat["TCP.orphan"]
+	info.TCPTimeWait = sockstat["TCP.tw"]
+	info.TCPAlloc = sockstat["TCP.alloc"]
+	info.TCPMem = uint64(sockstat["TCP.mem"]) * pageSize
+	info.UDPInUse = sockstat["UDP.inuse"] + sockstat["UDP6.inuse"]
+	info.UDPMem = uint64(sockstat["UDP.mem"]) * pageSize
+
+	info.ConntrackCount = readSysctlUint("net", "netfilter", "nf_conntrack_count")
+	info.ConntrackMax = readSysctlUint("net", "netfilter", "nf_conntrack_max")
+	return counters, info, nil
+}
+
+// readNetCounterPairs reads an snmp or netstat file. Unlike the socket
+// tables these have no header line: the first line already names counters.
+func readNetCounterPairs(name string, counters map[string]uint64) error {
+	f, err := openNetFile(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return parseNetCounterPairs(f, counters)
+}
+
+// parseNetCounterPairs parses the snmp and netstat layout, where a line of
+// names ("Tcp: RtoAlgorithm RtoMin ...") is followed by a line of values
+// with the same prefix. Negative values (Tcp MaxConn) are skipped.
+func parseNetCounterPairs(r io.Reader, counters map[string]uint64) error {
+	var header []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if header == nil || header[0] != fields[0] {
+			header = fields
+			continue
+		}
+		prefix := strings.TrimSuffix(fields[0], ":")
+		for i := 1; i < len(fields) && i < len(header); i++ {
+			if v, err := strconv.ParseUint(fields[i], 10, 64); err == nil {
+				counters[prefix+"."+header[i]] = v
+			}
+		}
+		header = nil
+	}
+	return sc.Err()
+}
+
+// parseSnmp6 picks the UDP counters out of the "Udp6InErrors 0" lines of
+// snmp6 as "Udp6.InErrors".
+func parseSnmp6(r io.Reader, counters map[string]uint64) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(fields[0], "Udp6"); ok {
+			if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+				counters["Udp6."+rest] = v
+			}
+		}
+	}
+}
+
+// readSockstat parses "TCP: inuse 4 orphan 0 tw 0 alloc 4 mem 1" lines
+// into "TCP.inuse" and so on. Memory is in pages.
+func readSockstat(name string) map[string]int {
+	values := map[string]int{}
+	f, err := openNetFile(name)
+	if err != nil {
+		return values
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		prefix := strings.TrimSuffix(fields[0], ":")
+		for i := 1; i+1 < len(fields); i += 2 {
+			if v, err := strconv.Atoi(fields[i+1]); err == nil {
+				values[prefix+"."+fields[i]] = v
+			}
+		}
+	}
+	return values
+}
+
+// readConntrackStats sums the per-CPU hex counters of stat/nf_conntrack,
+// which has a header line naming the columns.
+func readConntrackStats(counters map[string]uint64) {
+	f, err := openNetFile("stat/nf_conntrack")
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	if !sc.Scan() {
+		return
+	}
+	header := strings.Fields(sc.Text())
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		for i := 0; i < len(fields) && i < len(header); i++ {
+			if header[i] == "entries" {
+				continue // a gauge, repeated on every line
+			}
+			if v, err := strconv.ParseUint(fields[i], 16, 64); err == nil {
+				counters["Conntrack."+header[i]] += v
+			}
+		}
+	}
+}
+
+// readSysctlUint reads a numeric sysctl, 0 when it doesn't exist.
+func readSysctlUint(elem ...string) uint64 {
+	data, err := os.ReadFile(hostProc(append([]string{"sys"}, elem...)...))
+	if err != nil {
+		return 0
+	}
+	v, _ := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	return v
+}
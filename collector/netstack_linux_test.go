@@ -0,0 +1,84 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+)
+
+// Captured from a 6.x kernel. The first line already names the TcpExt
+// counters.
+const procNetNetstat = `TcpExt: SyncookiesSent SyncookiesRecv SyncookiesFailed EmbryonicRsts PruneCalled RcvPruned OfoPruned OutOfWindowIcmps LockDroppedIcmps ArpFilter TW TWRecycled TWKilled PAWSActive PAWSEstab BeyondWindow TSEcrRejected PAWSOldAck PAWSTimewait DelayedACKs DelayedACKLocked DelayedACKLost ListenOverflows ListenDrops TCPHPHits TCPPureAcks TCPHPAcks TCPRenoRecovery TCPSackRecovery TCPSACKReneging TCPSACKReorder TCPRenoReorder TCPTSReorder TCPFullUndo TCPPartialUndo TCPDSACKUndo TCPLossUndo TCPLostRetransmit TCPRenoFailures TCPSackFailures TCPLossFailures TCPFastRetrans TCPSlowStartRetrans TCPTimeouts TCPLossProbes TCPLossProbeRecovery TCPRenoRecoveryFail TCPSackRecoveryFail TCPRcvCollapsed TCPBacklogCoalesce TCPDSACKOldSent TCPDSACKOfoSent TCPDSACKRecv TCPDSACKOfoRecv TCPAbortOnData TCPAbortOnClose TCPAbortOnMemory TCPAbortOnTimeout TCPAbortOnLinger TCPAbortFailed TCPMemoryPressures TCPMemoryPressuresChrono TCPSACKDiscard TCPDSACKIgnoredOld TCPDSACKIgnoredNoUndo TCPSpuriousRTOs TCPMD5NotFound TCPMD5Unexpected TCPMD5Failure TCPSackShifted TCPSackMerged TCPSackShiftFallback TCPBacklogDrop PFMemallocDrop TCPMinTTLDrop TCPDeferAcceptDrop IPReversePathFilter TCPTimeWaitOverflow TCPReqQFullDoCookies TCPReqQFullDrop TCPRetransFail TCPRcvCoalesce TCPOFOQueue TCPOFODrop TCPOFOMerge TCPChallengeACK TCPSYNChallenge TCPFastOpenActive TCPFastOpenActiveFail TCPFastOpenPassive TCPFastOpenPassiveFail TCPFastOpenListenOverflow TCPFastOpenCookieReqd TCPFastOpenBlackhole TCPSpuriousRtxHostQueues BusyPollRxPackets TCPAutoCorking TCPFromZeroWindowAdv TCPToZeroWindowAdv TCPWantZeroWindowAdv TCPSynRetrans TCPOrigDataSent TCPHystartTrainDetect TCPHystartTrainCwnd TCPHystartDelayDetect TCPHystartDelayCwnd TCPACKSkippedSynRecv TCPACKSkippedPAWS TCPACKSkippedSeq TCPACKSkippedFinWait2 TCPACKSkippedTimeWait TCPACKSkippedChallenge TCPWinProbe TCPKeepAlive TCPMTUPFail TCPMTUPSuccess TCPDelivered TCPDeliveredCE TCPAckCompressed TCPZeroWindowDrop TCPRcvQDrop TCPWqueueTooBig TCPFastOpenPassiveAltKey TcpTimeoutRehash TcpDuplicateDataRehash TCPDSACKRecvSegs TCPDSACKIgnoredDubious TCPMigrateReqSuccess TCPMigrateReqFailure TCPPLBRehash TCPAORequired TCPAOBad TCPAOKeyNotFound TCPAOGood TCPAODroppedIcmps
+TcpExt: 0 0 0 0 0 0 0 0 0 0 79 0 0 0 0 0 0 0 0 11 0 4 0 0 377 1512 4388 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 5 0 0 0 0 993 4 0 4 0 36 0 0 0 0 0 0 0 0 0 4 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 720 0 0 0 0 0 0 0 0 0 0 0 0 0 0 293 1 1 4 0 8124 0 0 0 0 0 0 0 0 0 0 0 12 0 0 8219 0 0 0 0 0 0 0 0 4 0 0 0 0 0 0 0 0 0
+IpExt: InNoRoutes InTruncatedPkts InMcastPkts OutMcastPkts InBcastPkts OutBcastPkts InOctets OutOctets InMcastOctets OutMcastOctets InBcastOctets OutBcastOctets InCsumErrors InNoECTPkts InECT1Pkts InECT0Pkts InCEPkts ReasmOverlaps
+IpExt: 0 0 0 0 0 0 158391359 117575516 0 0 0 0 0 15885 0 0 0 0
+`
+
+const procNetSnmp = `Ip: Forwarding DefaultTTL InReceives InHdrErrors InAddrErrors ForwDatagrams InUnknownProtos InDiscards InDelivers OutRequests OutDiscards OutNoRoutes ReasmTimeout ReasmReqds ReasmOKs ReasmFails FragOKs FragFails FragCreates OutTransmits
+Ip: 2 64 15884 0 0 0 0 0 15884 15974 25 0 0 0 0 0 0 0 0 15974
+Tcp: RtoAlgorithm RtoMin RtoMax MaxConn ActiveOpens PassiveOpens AttemptFails EstabResets CurrEstab InSegs OutSegs RetransSegs InErrs OutRsts InCsumErrors
+Tcp: 1 200 120000 -1 159 109 31 62 2 15627 15754 4 0 74 0
+Udp: InDatagrams NoPorts InErrors OutDatagrams RcvbufErrors SndbufErrors InCsumErrors IgnoredMulti MemErrors
+Udp: 94 25 0 119 0 0 0 0 0
+`
+
+const procNetSnmp6 = `Ip6InReceives                   	93
+Udp6InDatagrams                 	12
+Udp6NoPorts                     	3
+Udp6InErrors                    	1
+Udp6RcvbufErrors                	0
+UdpLite6InDatagrams             	0
+`
+
+func TestParseNetCounterPairs(t *testing.T) {
+	counters := map[string]uint64{}
+	if err := parseNetCounterPairs(strings.NewReader(procNetNetstat), counters); err != nil {
+		t.Fatal(err)
+	}
+	if err := parseNetCounterPairs(strings.NewReader(procNetSnmp), counters); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]uint64{
+		"TcpExt.SyncookiesSent":    0,
+		"TcpExt.TW":                79,
+		"TcpExt.DelayedACKs":       11,
+		"TcpExt.ListenOverflows":   0,
+		"TcpExt.ListenDrops":       0,
+		"TcpExt.TCPHPHits":         377,
+		"TcpExt.TCPAODroppedIcmps": 0,
+		"IpExt.InOctets":           158391359,
+		"Ip.Forwarding":            2,
+		"Ip.InReceives":            15884,
+		"Tcp.ActiveOpens":          159,
+		"Tcp.RetransSegs":          4,
+		"Tcp.OutRsts":              74,
+		"Udp.NoPorts":              25,
+		"Udp.MemErrors":            0,
+	}
+	for key, v := range want {
+		if got, ok := counters[key]; !ok || got != v {
+			t.Errorf("%s = %d (present %v), want %d", key, got, ok, v)
+		}
+	}
+	if _, ok := counters["Tcp.MaxConn"]; ok {
+		t.Error("negative Tcp.MaxConn kept")
+	}
+}
+
+func TestParseNetCounterPairsMismatch(t *testing.T) {
+	counters := map[string]uint64{}
+	in := "Tcp: A B\nUdp: C D\nUdp: 3 4 5\n\nIp: F\n"
+	if err := parseNetCounterPairs(strings.NewReader(in), counters); err != nil {
+		t.Fatal(err)
+	}
+	if len(counters) != 2 || counters["Udp.C"] != 3 || counters["Udp.D"] != 4 {
+		t.Errorf("counters = %v", counters)
+	}
+}
+
+func TestParseSnmp6(t *testing.T) {
+	counters := map[string]uint64{}
+	parseSnmp6(strings.NewReader(procNetSnmp6), counters)
+	if len(counters) != 4 || counters["Udp6.InDatagrams"] != 12 || counters["Udp6.NoPorts"] != 3 || counters["Udp6.InErrors"] != 1 {
+		t.Errorf("counters = %v", counters)
+	}
+}
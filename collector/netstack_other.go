@@ -0,0 +1,14 @@
+//go:build !linux
+
+package collector
+
+import (
+	"errors"
+
+	"github.com/uptime-id/agent/models"
+)
+
+// readNetStack is Linux only.
+func readNetStack() (map[string]uint64, *models.NetStackInfo, error) {
+	return nil, nil, errors.ErrUnsupported
+}
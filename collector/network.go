@@ -2,7 +2,6 @@ package collector
 
 import (
 	"net"
-	"time"
 
 	"github.com/uptime-id/agent/models"
 
@@ -19,33 +18,22 @@ func collectNetworkInfo() models.NetworkInfo {
 	return models.NetworkInfo{}
 }
 
-func collectLatency() []models.LatencyInfo {
-	targets := []string{"8.8.8.8:53", "1.1.1.1:53"}
-	results := make([]models.LatencyInfo, 0, len(targets))
-
-	for _, targetAddr := range targets {
-		host, _, _ := net.SplitHostPort(targetAddr)
-		if host == "" {
-			host = targetAddr
-		}
-
-		info := models.LatencyInfo{
-			Target:  host,
-			Success: false,
+// latencyFromProbes keeps the legacy latency list populated from TCP probes.
+func latencyFromProbes(results []models.ProbeResult) []models.LatencyInfo {
+	var latency []models.LatencyInfo
+	for _, r := range results {
+		if r.Type != "tcp" || r.Container != "" {
+			continue
 		}
-
-		start := time.Now()
-		conn, err := net.DialTimeout("tcp", targetAddr, 2*time.Second)
-		if err == nil {
-			conn.Close()
-			latency := time.Since(start).Seconds() * 1000 // ms
-			info.Latency = latency
-			info.Success = true
-		} else {
+		host, _, err := net.SplitHostPort(r.Target)
+		if err != nil {
+			host = r.Target
 		}
-
-		results = append(results, info)
+		latency = append(latency, models.LatencyInfo{
+			Target:  host,
+			Latency: r.Latency,
+			Success: r.Success,
+		})
 	}
-
-	return results
+	return latency
 }
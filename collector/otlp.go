@@ -0,0 +1,664 @@
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+
+	collogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	maxOTLPBodySize = 8 << 20
+	maxOTLPBuffered = 10000
+	maxOTLPSeries   = 10000
+	maxOTLPSpans    = 10000
+)
+
+// otlpMetricLabels are the resource attributes kept as metric labels; the
+// rest describe the process and would only multiply series.
+var otlpMetricLabels = []string{"service.name", "service.namespace", "service.instance.id", "deployment.environment", "host.name"}
+
+// otlpServer receives OTLP/HTTP exports from instrumented applications and
+// buffers logs, metrics and spans until the next collection.
+type otlpServer struct {
+	hostAttrs map[string]string
+
+	mu           sync.Mutex
+	records      []models.LogRecord
+	dropped      int
+	metrics      []models.CustomMetric
+	series       map[string]int // series key -> index in metrics
+	spans        []models.Span
+	spansDropped int
+}
+
+var (
+	errOTLPSeriesLimit = errors.New("agent series limit reached")
+	errOTLPNonFinite   = errors.New("NaN or infinite value")
+)
+
+var otlpReceiver *otlpServer
+
+func startOTLPServer(c config.OTLPConfig) (*otlpServer, error) {
+	if c.Listen == "" {
+		return nil, nil
+	}
+	ln, err := net.Listen("tcp", c.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("listen %s: %w", c.Listen, err)
+	}
+	s := &otlpServer{
+		hostAttrs: otlpHostAttributes(),
+		series:    map[string]int{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/logs", s.handleLogs)
+	mux.HandleFunc("/v1/metrics", s.handleMetrics)
+	if c.Traces {
+		mux.HandleFunc("/v1/traces", s.handleTraces)
+	}
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Minute,
+	}
+	log.Printf("OTLP: listening on http://%s", ln.Addr())
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("OTLP: %v", err)
+		}
+	}()
+	return s, nil
+}
+
+// otlpHostAttributes describes this host with OpenTelemetry resource
+// attribute names, for records whose SDK did not set them.
+func otlpHostAttributes() map[string]string {
+	var m models.Metric
+	collectSystemInfo(&m)
+	attrs := map[string]string{"os.type": runtime.GOOS}
+	if hostname, err := os.Hostname(); err == nil {
+		attrs["host.name"] = hostname
+	}
+	if m.System.Arch != "" {
+		attrs["host.arch"] = m.System.Arch
+	}
+	if desc := strings.TrimSpace(m.System.OS); desc != "" {
+		attrs["os.description"] = desc
+	}
+	if m.System.Kernel != "" {
+		attrs["os.version"] = m.System.Kernel
+	}
+	return attrs
+}
+
+func (s *otlpServer) handleLogs(w http.ResponseWriter, r *http.Request) {
+	req := &collogs.ExportLogsServiceRequest{}
+	format, ok := decodeOTLP(w, r, req)
+	if !ok {
+		return
+	}
+	resp := &collogs.ExportLogsServiceResponse{}
+	if rejected := s.addLogs(req); rejected > 0 {
+		resp.PartialSuccess = &collogs.ExportLogsPartialSuccess{RejectedLogRecords: rejected, ErrorMessage: "agent log buffer full"}
+	}
+	writeOTLP(w, format, resp)
+}
+
+func (s *otlpServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	req := &colmetrics.ExportMetricsServiceRequest{}
+	format, ok := decodeOTLP(w, r, req)
+	if !ok {
+		return
+	}
+	resp := &colmetrics.ExportMetricsServiceResponse{}
+	if rejected, reason := s.addMetrics(req); rejected > 0 {
+		resp.PartialSuccess = &colmetrics.ExportMetricsPartialSuccess{RejectedDataPoints: rejected, ErrorMessage: reason}
+	}
+	writeOTLP(w, format, resp)
+}
+
+func (s *otlpServer) handleTraces(w http.ResponseWriter, r *http.Request) {
+	req := &coltrace.ExportTraceServiceRequest{}
+	format, ok := decodeOTLP(w, r, req)
+	if !ok {
+		return
+	}
+	resp := &coltrace.ExportTraceServiceResponse{}
+	if rejected := s.addSpans(req); rejected > 0 {
+		resp.PartialSuccess = &coltrace.ExportTracePartialSuccess{RejectedSpans: rejected, ErrorMessage: "agent span buffer full"}
+	}
+	writeOTLP(w, format, resp)
+}
+
+// decodeOTLP reads a protobuf or JSON encoded export request, optionally
+// gzip compressed, and answers the error itself when it returns false.
+func decodeOTLP(w http.ResponseWriter, r *http.Request, msg proto.Message) (string, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return "", false
+	}
+	format, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if format != "application/x-protobuf" && format != "application/json" {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return "", false
+	}
+
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxOTLPBodySize)
+	switch r.Header.Get("Content-Encoding") {
+	case "", "identity":
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return "", false
+		}
+		defer gz.Close()
+		body = io.LimitReader(gz, maxOTLPBodySize+1)
+	default:
+		http.Error(w, "unsupported content encoding", http.StatusUnsupportedMediaType)
+		return "", false
+	}
+	data, err := io.ReadAll(body)
+	if err == nil && len(data) > maxOTLPBodySize {
+		err = errors.New("request body too large")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return "", false
+	}
+
+	if format == "application/json" {
+		if data, err = otlpJSONIDs(data); err == nil {
+			err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, msg)
+		}
+	} else {
+		err = proto.Unmarshal(data, msg)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return format, true
+}
+
+func writeOTLP(w http.ResponseWriter, format string, msg proto.Message) {
+	var data []byte
+	var err error
+	if format == "application/json" {
+		data, err = protojson.Marshal(msg)
+	} else {
+		data, err = proto.Marshal(msg)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", format)
+	w.Write(data)
+}
+
+// otlpJSONIDs rewrites trace and span IDs from the hex encoding OTLP/JSON
+// uses to the base64 protojson expects for bytes fields.
+func otlpJSONIDs(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, child := range v {
+				switch k {
+				case "traceId", "spanId", "parentSpanId", "trace_id", "span_id", "parent_span_id":
+					if id, ok := child.(string); ok {
+						if b, err := hex.DecodeString(id); err == nil {
+							v[k] = base64.StdEncoding.EncodeToString(b)
+						}
+					}
+				default:
+					walk(child)
+				}
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(doc)
+	return json.Marshal(doc)
+}
+
+// resourceAttributes flattens resource attributes and fills in the host
+// attributes the SDK left out.
+func (s *otlpServer) resourceAttributes(kvs []*commonpb.KeyValue) map[string]string {
+	attrs := otlpAttributes(nil, kvs)
+	for k, v := range s.hostAttrs {
+		if _, ok := attrs[k]; !ok {
+			attrs[k] = v
+		}
+	}
+	return attrs
+}
+
+func (s *otlpServer) addLogs(req *collogs.ExportLogsServiceRequest) int64 {
+	var records []models.LogRecord
+	now := time.Now().UnixMilli()
+	for _, rl := range req.GetResourceLogs() {
+		resource := s.resourceAttributes(rl.GetResource().GetAttributes())
+		for _, sl := range rl.GetScopeLogs() {
+			scope := sl.GetScope().GetName()
+			for _, lr := range sl.GetLogRecords() {
+				fields := make(map[string]string, len(resource)+len(lr.GetAttributes())+3)
+				for k, v := range resource {
+					fields[k] = v
+				}
+				otlpAttributes(fields, lr.GetAttributes())
+				if scope != "" {
+					fields["otel.scope.name"] = scope
+				}
+				if id := lr.GetTraceId(); len(id) > 0 {
+					fields["trace_id"] = hex.EncodeToString(id)
+				}
+				if id := lr.GetSpanId(); len(id) > 0 {
+					fields["span_id"] = hex.EncodeToString(id)
+				}
+
+				ts := int64(lr.GetTimeUnixNano() / 1e6)
+				if ts == 0 {
+					ts = int64(lr.GetObservedTimeUnixNano() / 1e6)
+				}
+				if ts == 0 {
+					ts = now
+				}
+				severity := otlpSeverity(int32(lr.GetSeverityNumber()))
+				if severity == "" {
+					severity = normalizeSeverity(lr.GetSeverityText())
+				}
+				records = append(records, models.LogRecord{
+					Timestamp: ts,
+					Source:    "otlp",
+					Input:     "otlp",
+					Severity:  severity,
+					Host:      fields["host.name"],
+					Message:   strings.ToValidUTF8(otlpValue(lr.GetBody()), "\uFFFD"),
+					Fields:    fields,
+				})
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	room := max(maxOTLPBuffered-len(s.records), 0)
+	rejected := max(len(records)-room, 0)
+	s.records = append(s.records, records[:len(records)-rejected]...)
+	s.dropped += rejected
+	return int64(rejected)
+}
+
+// otlpSeverity maps OTLP severity numbers (TRACE 1-4 ... FATAL 21-24) to
+// syslog severity names.
+func otlpSeverity(n int32) string {
+	switch {
+	case n >= 21:
+		return "critical"
+	case n >= 17:
+		return "error"
+	case n >= 13:
+		return "warning"
+	case n >= 9:
+		return "info"
+	case n >= 1:
+		return "debug"
+	}
+	return ""
+}
+
+// addMetrics stores the request's data points and returns how many were
+// rejected and why.
+func (s *otlpServer) addMetrics(req *colmetrics.ExportMetricsServiceRequest) (int64, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rejected int64
+	var reasons []string
+	add := func(m models.CustomMetric, delta bool) {
+		if err := s.addSeries(m, delta); err != nil {
+			rejected++
+			if !slices.Contains(reasons, err.Error()) {
+				reasons = append(reasons, err.Error())
+			}
+		}
+	}
+	for _, rm := range req.GetResourceMetrics() {
+		resource := s.resourceAttributes(rm.GetResource().GetAttributes())
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, metric := range sm.GetMetrics() {
+				base := models.CustomMetric{Name: metric.GetName(), Unit: metric.GetUnit(), Source: "otlp"}
+				labels := func(kvs []*commonpb.KeyValue) map[string]string {
+					l := otlpAttributes(nil, kvs)
+					for _, k := range otlpMetricLabels {
+						if v, ok := resource[k]; ok {
+							if _, set := l[k]; !set {
+								l[k] = v
+							}
+						}
+					}
+					return l
+				}
+
+				switch data := metric.GetData().(type) {
+				case *metricspb.Metric_Gauge:
+					for _, dp := range data.Gauge.GetDataPoints() {
+						m := base
+						m.Type, m.Value, m.Labels = "gauge", otlpNumber(dp), labels(dp.GetAttributes())
+						m.Timestamp = int64(dp.GetTimeUnixNano() / 1e6)
+						add(m, false)
+					}
+				case *metricspb.Metric_Sum:
+					delta := data.Sum.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+					for _, dp := range data.Sum.GetDataPoints() {
+						m := base
+						m.Type, m.Value, m.Labels = "gauge", otlpNumber(dp), labels(dp.GetAttributes())
+						m.Timestamp = int64(dp.GetTimeUnixNano() / 1e6)
+						if data.Sum.GetIsMonotonic() {
+							m.Type = "counter"
+						}
+						add(m, delta && data.Sum.GetIsMonotonic())
+					}
+				case *metricspb.Metric_Histogram:
+					delta := data.Histogram.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+					for _, dp := range data.Histogram.GetDataPoints() {
+						m := base
+						m.Type, m.Labels = "histogram", labels(dp.GetAttributes())
+						m.Timestamp = int64(dp.GetTimeUnixNano() / 1e6)
+						m.Count, m.Sum = dp.GetCount(), dp.GetSum()
+						var cumulative uint64
+						counts := dp.GetBucketCounts()
+						for i, bound := range dp.GetExplicitBounds() {
+							if i < len(counts) {
+								cumulative += counts[i]
+							}
+							m.Buckets = append(m.Buckets, models.HistogramBucket{UpperBound: bound, Count: cumulative})
+						}
+						add(m, delta)
+					}
+				case *metricspb.Metric_ExponentialHistogram:
+					delta := data.ExponentialHistogram.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+					for _, dp := range data.ExponentialHistogram.GetDataPoints() {
+						m := base
+						m.Type, m.Labels = "histogram", labels(dp.GetAttributes())
+						m.Timestamp = int64(dp.GetTimeUnixNano() / 1e6)
+						m.Count, m.Sum = dp.GetCount(), dp.GetSum()
+						add(m, delta)
+					}
+				case *metricspb.Metric_Summary:
+					for _, dp := range data.Summary.GetDataPoints() {
+						m := base
+						m.Type, m.Labels = "summary", labels(dp.GetAttributes())
+						m.Timestamp = int64(dp.GetTimeUnixNano() / 1e6)
+						m.Count, m.Sum = dp.GetCount(), dp.GetSum()
+						m.Quantiles = map[string]float64{}
+						for _, q := range dp.GetQuantileValues() {
+							m.Quantiles[strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64)] = q.GetValue()
+						}
+						add(m, false)
+					}
+				}
+			}
+		}
+	}
+	return rejected, strings.Join(reasons, "; ")
+}
+
+// addSeries keeps the latest point of each series; delta points are summed
+// so the interval's total survives several exports. Points with NaN or
+// infinite values are refused, as the payload can't carry them.
+func (s *otlpServer) addSeries(m models.CustomMetric, delta bool) error {
+	if m.Count > 0 {
+		m.Value = m.Sum / float64(m.Count)
+	}
+	if !customMetricFinite(m) {
+		return errOTLPNonFinite
+	}
+	key := customMetricKey(m)
+	i, ok := s.series[key]
+	if !ok {
+		if len(s.metrics) >= maxOTLPSeries {
+			return errOTLPSeriesLimit
+		}
+		s.series[key] = len(s.metrics)
+		s.metrics = append(s.metrics, m)
+		return nil
+	}
+
+	prev := s.metrics[i]
+	if delta {
+		switch {
+		case m.Type == "counter":
+			m.Value += prev.Value
+		case sameBuckets(m.Buckets, prev.Buckets):
+			m.Count += prev.Count
+			m.Sum += prev.Sum
+			for j := range m.Buckets {
+				m.Buckets[j].Count += prev.Buckets[j].Count
+			}
+			if m.Count > 0 {
+				m.Value = m.Sum / float64(m.Count)
+			}
+		}
+	}
+	s.metrics[i] = m
+	return nil
+}
+
+// customMetricFinite reports whether every value of m can be encoded as
+// JSON.
+func customMetricFinite(m models.CustomMetric) bool {
+	finite := func(f float64) bool { return !math.IsNaN(f) && !math.IsInf(f, 0) }
+	if !finite(m.Value) || !finite(m.Sum) || !finite(m.Rate) {
+		return false
+	}
+	for _, b := range m.Buckets {
+		if !finite(b.UpperBound) {
+			return false
+		}
+	}
+	for _, q := range m.Quantiles {
+		if !finite(q) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameBuckets(a, b []models.HistogramBucket) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].UpperBound != b[i].UpperBound {
+			return false
+		}
+	}
+	return true
+}
+
+// customMetricKey identifies a series by name, type and sorted labels.
+func customMetricKey(m models.CustomMetric) string {
+	keys := make([]string, 0, len(m.Labels))
+	for k := range m.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(m.Name)
+	b.WriteByte(0)
+	b.WriteString(m.Type)
+	for _, k := range keys {
+		b.WriteByte(0)
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(m.Labels[k])
+	}
+	return b.String()
+}
+
+func otlpNumber(dp *metricspb.NumberDataPoint) float64 {
+	if v, ok := dp.GetValue().(*metricspb.NumberDataPoint_AsInt); ok {
+		return float64(v.AsInt)
+	}
+	return dp.GetAsDouble()
+}
+
+func (s *otlpServer) addSpans(req *coltrace.ExportTraceServiceRequest) int64 {
+	var spans []models.Span
+	for _, rs := range req.GetResourceSpans() {
+		service := s.resourceAttributes(rs.GetResource().GetAttributes())["service.name"]
+		for _, ss := range rs.GetScopeSpans() {
+			for _, span := range ss.GetSpans() {
+				start, end := span.GetStartTimeUnixNano(), span.GetEndTimeUnixNano()
+				var duration float64
+				if end > start {
+					duration = float64(end-start) / 1e6
+				}
+				spans = append(spans, models.Span{
+					TraceID:       hex.EncodeToString(span.GetTraceId()),
+					SpanID:        hex.EncodeToString(span.GetSpanId()),
+					ParentSpanID:  hex.EncodeToString(span.GetParentSpanId()),
+					Name:          span.GetName(),
+					Kind:          strings.ToLower(strings.TrimPrefix(span.GetKind().String(), "SPAN_KIND_")),
+					Service:       service,
+					StartTime:     int64(start / 1e3),
+					Duration:      duration,
+					Status:        otlpStatus(span.GetStatus().GetCode()),
+					StatusMessage: span.GetStatus().GetMessage(),
+					Attributes:    otlpAttributes(nil, span.GetAttributes()),
+				})
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	room := max(maxOTLPSpans-len(s.spans), 0)
+	rejected := max(len(spans)-room, 0)
+	s.spans = append(s.spans, spans[:len(spans)-rejected]...)
+	s.spansDropped += rejected
+	return int64(rejected)
+}
+
+func otlpStatus(code tracepb.Status_StatusCode) string {
+	switch code {
+	case tracepb.Status_STATUS_CODE_OK:
+		return "ok"
+	case tracepb.Status_STATUS_CODE_ERROR:
+		return "error"
+	}
+	return "unset"
+}
+
+// otlpAttributes flattens key/value attributes into dst, allocating it when
+// nil. Arrays and maps are stored as JSON.
+func otlpAttributes(dst map[string]string, kvs []*commonpb.KeyValue) map[string]string {
+	if dst == nil {
+		dst = make(map[string]string, len(kvs))
+	}
+	for _, kv := range kvs {
+		dst[kv.GetKey()] = otlpValue(kv.GetValue())
+	}
+	return dst
+}
+
+func otlpValue(v *commonpb.AnyValue) string {
+	switch v.GetValue().(type) {
+	case nil:
+		return ""
+	case *commonpb.AnyValue_StringValue:
+		return v.GetStringValue()
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.GetBoolValue())
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.GetIntValue(), 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.GetDoubleValue(), 'g', -1, 64)
+	case *commonpb.AnyValue_BytesValue:
+		return base64.StdEncoding.EncodeToString(v.GetBytesValue())
+	}
+	b, _ := json.Marshal(otlpPlain(v))
+	return string(b)
+}
+
+func otlpPlain(v *commonpb.AnyValue) any {
+	switch x := v.GetValue().(type) {
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]any, 0, len(x.ArrayValue.GetValues()))
+		for _, item := range x.ArrayValue.GetValues() {
+			values = append(values, otlpPlain(item))
+		}
+		return values
+	case *commonpb.AnyValue_KvlistValue:
+		values := make(map[string]any, len(x.KvlistValue.GetValues()))
+		for _, kv := range x.KvlistValue.GetValues() {
+			values[kv.GetKey()] = otlpPlain(kv.GetValue())
+		}
+		return values
+	case *commonpb.AnyValue_BoolValue:
+		return x.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return x.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return x.DoubleValue
+	}
+	return otlpValue(v)
+}
+
+// drain returns what was received since the last call: log records and how
+// many were dropped, one point per metric series, and finished spans and how
+// many were dropped.
+func (s *otlpServer) drain() ([]models.LogRecord, int, []models.CustomMetric, []models.Span, int) {
+	if s == nil {
+		return nil, 0, nil, nil, 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records, dropped, metrics, spans, spansDropped := s.records, s.dropped, s.metrics, s.spans, s.spansDropped
+	s.records, s.dropped, s.metrics, s.spans, s.spansDropped = nil, 0, nil, nil, 0
+	s.series = map[string]int{}
+	return records, dropped, metrics, spans, spansDropped
+}
@@ -0,0 +1,200 @@
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/uptime-id/agent/models"
+
+	coltrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestOTLPServer() *otlpServer {
+	return &otlpServer{hostAttrs: map[string]string{"host.name": "web-1", "os.type": "linux"}, series: map[string]int{}}
+}
+
+func postOTLP(t *testing.T, handler http.HandlerFunc, contentType string, body []byte, gzipped bool) *httptest.ResponseRecorder {
+	t.Helper()
+	if gzipped {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(body)
+		gz.Close()
+		body = buf.Bytes()
+	}
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func TestOTLPJSONIDs(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"hex IDs", `{"traceId":"5b8efff798038103d269b633813fc60c","spanId":"eee19b7ec3c1b174"}`,
+			`{"spanId":"7uGbfsPBsXQ=","traceId":"W47/95gDgQPSabYzgT/GDA=="}`},
+		{"nested and snake case", `{"a":[{"parent_span_id":"eee19b7ec3c1b174","n":1.50}]}`,
+			`{"a":[{"n":1.50,"parent_span_id":"7uGbfsPBsXQ="}]}`},
+		{"not hex", `{"spanId":"7uGbfsPBsXQ="}`, `{"spanId":"7uGbfsPBsXQ="}`},
+		{"empty ID", `{"parentSpanId":""}`, `{"parentSpanId":""}`},
+		{"other keys untouched", `{"name":"eee19b7ec3c1b174","big":12345678901234567890}`,
+			`{"big":12345678901234567890,"name":"eee19b7ec3c1b174"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := otlpJSONIDs([]byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+	if _, err := otlpJSONIDs([]byte(`{"traceId":`)); err == nil {
+		t.Error("truncated JSON accepted")
+	}
+}
+
+func TestOTLPTracesJSON(t *testing.T) {
+	s := newTestOTLPServer()
+	body := `{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"shop"}}]},
+		"scopeSpans":[{"spans":[{"traceId":"5b8efff798038103d269b633813fc60c","spanId":"eee19b7ec3c1b174",
+		"parentSpanId":"eee19b7ec3c1b173","name":"GET /cart","kind":2,"startTimeUnixNano":"1709647629000000000",
+		"endTimeUnixNano":"1709647629250000000","status":{"code":2,"message":"boom"},
+		"attributes":[{"key":"http.status_code","value":{"intValue":"500"}}]}]}]}]}`
+	if w := postOTLP(t, s.handleTraces, "application/json", []byte(body), true); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	_, _, _, spans, dropped := s.drain()
+	want := models.Span{TraceID: "5b8efff798038103d269b633813fc60c", SpanID: "eee19b7ec3c1b174", ParentSpanID: "eee19b7ec3c1b173",
+		Name: "GET /cart", Kind: "server", Service: "shop", StartTime: 1709647629000000, Duration: 250, Status: "error", StatusMessage: "boom"}
+	if len(spans) != 1 || dropped != 0 {
+		t.Fatalf("spans = %+v, dropped %d", spans, dropped)
+	}
+	want.Attributes = map[string]string{"http.status_code": "500"}
+	if !reflect.DeepEqual(spans[0], want) {
+		t.Errorf("span = %+v", spans[0])
+	}
+}
+
+func TestOTLPSpanBufferFull(t *testing.T) {
+	s := newTestOTLPServer()
+	s.spans = make([]models.Span, maxOTLPSpans-1)
+	req := &coltrace.ExportTraceServiceRequest{ResourceSpans: []*tracepb.ResourceSpans{{
+		ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{Name: "a"}, {Name: "b"}, {Name: "c"}}}},
+	}}}
+	data, _ := proto.Marshal(req)
+	w := postOTLP(t, s.handleTraces, "application/x-protobuf", data, false)
+	resp := &coltrace.ExportTraceServiceResponse{}
+	if err := proto.Unmarshal(w.Body.Bytes(), resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetPartialSuccess().GetRejectedSpans() != 2 {
+		t.Errorf("response = %v", resp)
+	}
+	if _, _, _, spans, dropped := s.drain(); len(spans) != maxOTLPSpans || dropped != 2 {
+		t.Errorf("drained %d spans, %d dropped", len(spans), dropped)
+	}
+	if _, _, _, _, dropped := s.drain(); dropped != 0 {
+		t.Errorf("dropped count not reset: %d", dropped)
+	}
+}
+
+func TestOTLPMetricsNonFinite(t *testing.T) {
+	s := newTestOTLPServer()
+	body := `{"resourceMetrics":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"shop"}}]},
+		"scopeMetrics":[{"metrics":[
+		{"name":"temp","gauge":{"dataPoints":[{"asDouble":21.5},{"asDouble":"NaN","attributes":[{"key":"room","value":{"stringValue":"b"}}]}]}},
+		{"name":"reqs","sum":{"isMonotonic":true,"aggregationTemporality":1,"dataPoints":[{"asDouble":"Infinity"},{"asInt":"3","attributes":[{"key":"code","value":{"stringValue":"200"}}]}]}},
+		{"name":"lat","histogram":{"aggregationTemporality":2,"dataPoints":[{"count":"2","sum":"-Infinity","explicitBounds":[1],"bucketCounts":["1","1"]}]}},
+		{"name":"q","summary":{"dataPoints":[{"count":"1","sum":1,"quantileValues":[{"quantile":0.5,"value":"NaN"}]}]}}
+		]}]}]}`
+	w := postOTLP(t, s.handleMetrics, "application/json", []byte(body), false)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		PartialSuccess struct {
+			RejectedDataPoints string `json:"rejectedDataPoints"`
+			ErrorMessage       string `json:"errorMessage"`
+		} `json:"partialSuccess"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.PartialSuccess.RejectedDataPoints != "4" || !strings.Contains(resp.PartialSuccess.ErrorMessage, "NaN") {
+		t.Errorf("partial success = %+v", resp.PartialSuccess)
+	}
+
+	_, _, metrics, _, _ := s.drain()
+	if len(metrics) != 2 {
+		t.Fatalf("metrics = %+v", metrics)
+	}
+	if m := metrics[0]; m.Name != "temp" || m.Value != 21.5 || m.Labels["service.name"] != "shop" || m.Labels["host.name"] != "web-1" {
+		t.Errorf("gauge = %+v", m)
+	}
+	if m := metrics[1]; m.Name != "reqs" || m.Type != "counter" || m.Value != 3 {
+		t.Errorf("counter = %+v", m)
+	}
+	if _, err := json.Marshal(metrics); err != nil {
+		t.Errorf("metrics don't encode: %v", err)
+	}
+}
+
+func TestOTLPDeltaHistograms(t *testing.T) {
+	s := newTestOTLPServer()
+	point := models.CustomMetric{Name: "lat", Type: "histogram", Count: 2, Sum: 3,
+		Buckets: []models.HistogramBucket{{UpperBound: 1, Count: 1}}}
+	for range 2 {
+		p := point
+		p.Buckets = append([]models.HistogramBucket(nil), point.Buckets...)
+		if err := s.addSeries(p, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := s.metrics[0]
+	if len(s.metrics) != 1 || m.Count != 4 || m.Sum != 6 || m.Value != 1.5 || m.Buckets[0].Count != 2 {
+		t.Errorf("merged histogram = %+v", m)
+	}
+}
+
+func TestOTLPDecodeErrors(t *testing.T) {
+	s := newTestOTLPServer()
+	tests := []struct {
+		name, method, contentType, encoding, body string
+		status                                    int
+	}{
+		{"method", http.MethodGet, "application/json", "", "{}", http.StatusMethodNotAllowed},
+		{"content type", http.MethodPost, "text/plain", "", "{}", http.StatusUnsupportedMediaType},
+		{"encoding", http.MethodPost, "application/json", "br", "{}", http.StatusUnsupportedMediaType},
+		{"bad gzip", http.MethodPost, "application/json", "gzip", "{}", http.StatusBadRequest},
+		{"bad JSON", http.MethodPost, "application/json", "", "{", http.StatusBadRequest},
+		{"bad protobuf", http.MethodPost, "application/x-protobuf", "", "\xff\xff", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/v1/logs", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("Content-Encoding", tt.encoding)
+			w := httptest.NewRecorder()
+			s.handleLogs(w, req)
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
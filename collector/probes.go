@@ -0,0 +1,438 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+)
+
+const (
+	defaultProbeInterval = 30 * time.Second
+	defaultProbeTimeout  = 5 * time.Second
+	maxProbeBodySize     = 1 * 1024 * 1024
+)
+
+// Probe groups: configured probes come from CONFIG_FILE, discovered ones from
+// container labels. Each group is synced independently.
+const (
+	probeGroupConfig    = "config"
+	probeGroupContainer = "container"
+)
+
+type probeSpec struct {
+	Key       string
+	Container string
+	Probe     config.ProbeConfig
+}
+
+type probeRunner struct {
+	spec   probeSpec
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	result *models.ProbeResult
+}
+
+type probeRegistry struct {
+	mu      sync.Mutex
+	runners map[string]*probeRunner
+}
+
+var probes = &probeRegistry{runners: map[string]*probeRunner{}}
+
+// sync starts runners for new specs in the group and stops runners whose spec
+// is gone or changed (e.g. the container was recreated with a new IP).
+func (r *probeRegistry) sync(group string, specs []probeSpec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prefix := group + ":"
+	wanted := make(map[string]probeSpec, len(specs))
+	for _, spec := range specs {
+		wanted[prefix+spec.Key] = spec
+	}
+
+	for key, runner := range r.runners {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if spec, ok := wanted[key]; !ok || !reflect.DeepEqual(spec, runner.spec) {
+			runner.cancel()
+			delete(r.runners, key)
+			if !ok {
+				log.Printf("Probe removed: %s", key)
+			}
+		}
+	}
+
+	for key, spec := range wanted {
+		if _, ok := r.runners[key]; ok {
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		runner := &probeRunner{spec: spec, cancel: cancel}
+		r.runners[key] = runner
+		log.Printf("Probe scheduled: %s (%s %s) every %v", key, spec.Probe.Type, spec.Probe.Target, spec.Probe.Interval.Or(defaultProbeInterval))
+		go runner.run(ctx)
+	}
+}
+
+func (r *probeRegistry) results() []models.ProbeResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	results := make([]models.ProbeResult, 0, len(r.runners))
+	for _, runner := range r.runners {
+		runner.mu.Lock()
+		if runner.result != nil {
+			results = append(results, *runner.result)
+		}
+		runner.mu.Unlock()
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Container != results[j].Container {
+			return results[i].Container < results[j].Container
+		}
+		return results[i].Name < results[j].Name
+	})
+	return results
+}
+
+func configuredProbes(cfg *config.Config) []probeSpec {
+	specs := make([]probeSpec, 0, len(cfg.Probes))
+	for _, p := range cfg.Probes {
+		specs = append(specs, probeSpec{Key: p.Name, Probe: p})
+	}
+	return specs
+}
+
+func (p *probeRunner) run(ctx context.Context) {
+	ticker := time.NewTicker(p.spec.Probe.Interval.Or(defaultProbeInterval))
+	defer ticker.Stop()
+
+	for {
+		result := executeProbe(ctx, p.spec)
+		if ctx.Err() != nil {
+			return
+		}
+		p.mu.Lock()
+		p.result = &result
+		p.mu.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func executeProbe(ctx context.Context, spec probeSpec) models.ProbeResult {
+	p := spec.Probe
+	result := models.ProbeResult{
+		Name:      p.Name,
+		Type:      p.Type,
+		Target:    p.Target,
+		Container: spec.Container,
+		CheckedAt: time.Now().UnixMilli(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout.Or(defaultProbeTimeout))
+	defer cancel()
+
+	start := time.Now()
+	var err error
+	switch p.Type {
+	case "tcp":
+		err = probeTCP(ctx, p, &result)
+	case "tls":
+		err = probeTLS(ctx, p, &result)
+	case "http", "https":
+		err = probeHTTP(ctx, p, &result)
+	case "dns":
+		err = probeDNS(ctx, p, &result)
+	case "icmp":
+		err = probeICMP(ctx, p, &result)
+	default:
+		err = fmt.Errorf("unsupported probe type %q", p.Type)
+	}
+	if result.ICMP == nil {
+		result.Latency = millis(time.Since(start))
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Success = true
+	return result
+}
+
+func millis(d time.Duration) float64 {
+	return d.Seconds() * 1000
+}
+
+// dialTimed resolves and connects separately so both phases can be reported.
+func dialTimed(ctx context.Context, target string, result *models.ProbeResult) (net.Conn, string, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ip := host
+	if net.ParseIP(host) == nil {
+		start := time.Now()
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		result.DNS = millis(time.Since(start))
+		if err != nil {
+			return nil, host, err
+		}
+		ip = addrs[0]
+	}
+
+	var d net.Dialer
+	start := time.Now()
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ip, port))
+	result.Connect = millis(time.Since(start))
+	return conn, host, err
+}
+
+func probeTCP(ctx context.Context, p config.ProbeConfig, result *models.ProbeResult) error {
+	conn, _, err := dialTimed(ctx, p.Target, result)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func probeTLS(ctx context.Context, p config.ProbeConfig, result *models.ProbeResult) error {
+	conn, host, err := dialTimed(ctx, p.Target, result)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	serverName := p.ServerName
+	if serverName == "" {
+		serverName = host
+	}
+
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: serverName, InsecureSkipVerify: p.InsecureSkipVerify})
+	start := time.Now()
+	err = tlsConn.HandshakeContext(ctx)
+	result.TLS = millis(time.Since(start))
+	return err
+}
+
+func probeHTTP(ctx context.Context, p config.ProbeConfig, result *models.ProbeResult) error {
+	method := p.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	// Trace hooks may fire from the transport's dial goroutine, which can
+	// outlive the request when the timeout hits.
+	var mu sync.Mutex
+	var dns, connect, tlsHandshake, ttfb float64
+	var dnsStart, connectStart, tlsStart time.Time
+	start := time.Now()
+	mark := func(t *time.Time) {
+		mu.Lock()
+		*t = time.Now()
+		mu.Unlock()
+	}
+	record := func(dst *float64, since *time.Time) {
+		mu.Lock()
+		*dst = millis(time.Since(*since))
+		mu.Unlock()
+	}
+	trace := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { mark(&dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { record(&dns, &dnsStart) },
+		ConnectStart:         func(string, string) { mark(&connectStart) },
+		ConnectDone:          func(string, string, error) { record(&connect, &connectStart) },
+		TLSHandshakeStart:    func() { mark(&tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { record(&tlsHandshake, &tlsStart) },
+		GotFirstResponseByte: func() { record(&ttfb, &start) },
+	}
+	defer func() {
+		mu.Lock()
+		result.DNS, result.Connect, result.TLS, result.TTFB = dns, connect, tlsHandshake, ttfb
+		mu.Unlock()
+	}()
+
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), method, p.Target, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range p.Headers {
+		req.Header.Set(k, v)
+	}
+
+	// A fresh transport per run so every probe pays for DNS, connect and TLS.
+	client := &http.Client{
+		Transport: &http.Transport{
+			DisableKeepAlives: true,
+			TLSClientConfig:   &tls.Config{ServerName: p.ServerName, InsecureSkipVerify: p.InsecureSkipVerify},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	if !statusExpected(resp.StatusCode, p.ExpectedStatus) {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	if p.BodyRegex != "" {
+		re, err := compileBodyRegex(p.BodyRegex)
+		if err != nil {
+			return fmt.Errorf("invalid bodyRegex: %w", err)
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBodySize))
+		if err != nil {
+			return err
+		}
+		if !re.Match(body) {
+			return fmt.Errorf("body does not match %q", p.BodyRegex)
+		}
+	}
+
+	return nil
+}
+
+// bodyRegexps caches compiled body patterns across probe runs.
+var bodyRegexps sync.Map
+
+func compileBodyRegex(pattern string) (*regexp.Regexp, error) {
+	if re, ok := bodyRegexps.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	bodyRegexps.Store(pattern, re)
+	return re, nil
+}
+
+func statusExpected(code int, expected []int) bool {
+	if len(expected) == 0 {
+		return code < 400
+	}
+	for _, e := range expected {
+		if code == e {
+			return true
+		}
+	}
+	return false
+}
+
+func probeDNS(ctx context.Context, p config.ProbeConfig, result *models.ProbeResult) error {
+	resolver := net.DefaultResolver
+	if p.Server != "" {
+		server := p.Server
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	start := time.Now()
+	answers, err := lookupRecords(ctx, resolver, strings.ToUpper(p.RecordType), p.Target)
+	result.DNS = millis(time.Since(start))
+	if err != nil {
+		return err
+	}
+	result.Answers = answers
+
+	if p.ExpectedAnswer == "" {
+		return nil
+	}
+	want := strings.TrimSuffix(strings.ToLower(p.ExpectedAnswer), ".")
+	for _, a := range answers {
+		if strings.TrimSuffix(strings.ToLower(a), ".") == want {
+			return nil
+		}
+	}
+	return fmt.Errorf("expected answer %q not found", p.ExpectedAnswer)
+}
+
+func lookupRecords(ctx context.Context, r *net.Resolver, recordType, name string) ([]string, error) {
+	switch recordType {
+	case "", "A", "AAAA":
+		network := "ip"
+		switch recordType {
+		case "A":
+			network = "ip4"
+		case "AAAA":
+			network = "ip6"
+		}
+		ips, err := r.LookupIP(ctx, network, name)
+		if err != nil {
+			return nil, err
+		}
+		answers := make([]string, 0, len(ips))
+		for _, ip := range ips {
+			answers = append(answers, ip.String())
+		}
+		return answers, nil
+	case "CNAME":
+		cname, err := r.LookupCNAME(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		return []string{cname}, nil
+	case "MX":
+		mxs, err := r.LookupMX(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		answers := make([]string, 0, len(mxs))
+		for _, mx := range mxs {
+			answers = append(answers, mx.Host)
+		}
+		return answers, nil
+	case "NS":
+		nss, err := r.LookupNS(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		answers := make([]string, 0, len(nss))
+		for _, ns := range nss {
+			answers = append(answers, ns.Host)
+		}
+		return answers, nil
+	case "TXT":
+		return r.LookupTXT(ctx, name)
+	default:
+		return nil, fmt.Errorf("unsupported record type %q", recordType)
+	}
+}
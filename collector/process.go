@@ -3,134 +3,312 @@ package collector
 import (
 	"fmt"
 	"log"
+	"regexp"
 	"sort"
+	"strings"
+	"time"
 
+	"github.com/uptime-id/agent/config"
 	"github.com/uptime-id/agent/models"
 
+	"github.com/shirou/gopsutil/v3/mem"
 	"github.com/shirou/gopsutil/v3/process"
 )
 
-func collectTopProcesses() []models.ProcessInfo {
-	procs, err := process.Processes()
+const defaultTopProcesses = 10
+
+// procStat is what one read of /proc/[pid]/stat tells about a process.
+type procStat struct {
+	name    string
+	state   string
+	ppid    int32
+	cpuTime float64 // user + system, seconds
+	threads int32
+	prio    int32 // kernel scheduling priority, Linux only
+	hasPrio bool
+	nice    int32
+	start   uint64 // start time, only compared to detect PID reuse
+	rss     uint64 // bytes
+	vms     uint64 // bytes
+}
+
+// cachedProcess is a process handle kept across collections, with the
+// previous samples needed to turn counters into interval rates.
+type cachedProcess struct {
+	proc *process.Process
+	stat procStat
+	cpu  float64 // % over the last interval, 0 on first sight
+
+	prevCPUTime float64
+	prevAt      time.Time
+
+	// Read on demand, at most once per collection.
+	ioAt                time.Time
+	readBytes           uint64
+	writeBytes          uint64
+	readRate, writeRate float64 // bytes/s
+	fdsAt               time.Time
+	fds                 int
+}
+
+// processTable maps PIDs to cached handles between collections.
+type processTable struct {
+	byPID    map[int32]*cachedProcess
+	memTotal uint64
+	at       time.Time
+}
+
+var processes = &processTable{byPID: map[int32]*cachedProcess{}}
+
+// refresh reads the stat of every process once, reusing the handles of
+// processes seen before; a changed start time means the PID was reused.
+func (t *processTable) refresh(now time.Time) []*cachedProcess {
+	pids, err := process.Pids()
 	if err != nil {
 		log.Printf("Failed to get processes: %v", err)
 		return nil
 	}
-
-	type procData struct {
-		pid      int32
-		name     string
-		user     string
-		status   string
-		cpu      float64
-		memory   float32
-		resMem   uint64
-		virtMem  uint64
-		timeStr  string
-		command  string
+	if vm, err := mem.VirtualMemory(); err == nil {
+		t.memTotal = vm.Total
 	}
+	t.at = now
 
-	var procList []procData
-
-	for _, p := range procs {
-		name, err := p.Name()
-		if err != nil {
-			continue
+	procs := make([]*cachedProcess, 0, len(pids))
+	seen := make(map[int32]bool, len(pids))
+	for _, pid := range pids {
+		c := t.byPID[pid]
+		p := &process.Process{Pid: pid}
+		if c != nil {
+			p = c.proc
 		}
-
-		cpu, err := p.CPUPercent()
+		stat, err := readProcStat(p)
 		if err != nil {
-			cpu = 0
+			continue // exited since listed
+		}
+		if c == nil || c.stat.start != stat.start {
+			c = &cachedProcess{proc: p}
+			t.byPID[pid] = c
 		}
 
-		mem, err := p.MemoryPercent()
-		if err != nil {
-			mem = 0
+		c.cpu = 0
+		if !c.prevAt.IsZero() {
+			if elapsed := now.Sub(c.prevAt).Seconds(); elapsed > 0 && stat.cpuTime >= c.prevCPUTime {
+				c.cpu = (stat.cpuTime - c.prevCPUTime) / elapsed * 100
+			}
 		}
+		c.stat, c.prevCPUTime, c.prevAt = stat, stat.cpuTime, now
+		seen[pid] = true
+		procs = append(procs, c)
+	}
 
-		// Get User
-		user, err := p.Username()
-		if err != nil {
-			user = ""
+	for pid := range t.byPID {
+		if !seen[pid] {
+			delete(t.byPID, pid)
 		}
+	}
+	return procs
+}
 
-		// Get Status
-		statusVals, err := p.Status()
-		status := ""
-		if err == nil && len(statusVals) > 0 {
-			status = statusVals[0]
+func (t *processTable) memoryPercent(c *cachedProcess) float64 {
+	if t.memTotal == 0 {
+		return 0
+	}
+	return float64(c.stat.rss) / float64(t.memTotal) * 100
+}
+
+// name is the process name; the kernel truncates it to 15 bytes in stat,
+// in which case gopsutil recovers the full one from the command line.
+func (c *cachedProcess) name() string {
+	if len(c.stat.name) < 15 {
+		return c.stat.name
+	}
+	if name, err := c.proc.Name(); err == nil {
+		return name
+	}
+	return c.stat.name
+}
+
+// updateIO reads the I/O counters and derives rates from the previous read.
+func (c *cachedProcess) updateIO(now time.Time) {
+	if c.ioAt.Equal(now) {
+		return
+	}
+	io, err := c.proc.IOCounters()
+	if err != nil {
+		return
+	}
+	if !c.ioAt.IsZero() {
+		if elapsed := now.Sub(c.ioAt).Seconds(); elapsed > 0 {
+			c.readRate = float64(io.ReadBytes-min(io.ReadBytes, c.readBytes)) / elapsed
+			c.writeRate = float64(io.WriteBytes-min(io.WriteBytes, c.writeBytes)) / elapsed
 		}
+	}
+	c.readBytes, c.writeBytes, c.ioAt = io.ReadBytes, io.WriteBytes, now
+}
+
+func (c *cachedProcess) updateFDs(now time.Time) {
+	if c.fdsAt.Equal(now) {
+		return
+	}
+	if n, err := c.proc.NumFDs(); err == nil {
+		c.fds = int(n)
+	}
+	c.fdsAt = now
+}
+
+// collectTopProcesses returns the top processes by the configured key: cpu
+// (default), rss, io or fds. I/O and descriptors are only read for every
+// process when they are the sort key, and otherwise only for the top
+// processes when asked for in Details; the sort key is always reported.
+func collectTopProcesses(procs []*cachedProcess, cfg config.ProcessesConfig) []models.ProcessInfo {
+	now := processes.at
+	sorted := append([]*cachedProcess(nil), procs...)
 
-		// Get Memory Info (RES/VIRT)
-		resMem := uint64(0)
-		virtMem := uint64(0)
-		memInfo, err := p.MemoryInfo()
-		if err == nil {
-			resMem = memInfo.RSS
-			virtMem = memInfo.VMS
+	var key func(c *cachedProcess) float64
+	switch cfg.SortBy {
+	case "rss":
+		key = func(c *cachedProcess) float64 { return float64(c.stat.rss) }
+	case "io":
+		for _, c := range sorted {
+			c.updateIO(now)
 		}
+		key = func(c *cachedProcess) float64 { return c.readRate + c.writeRate }
+	case "fds":
+		for _, c := range sorted {
+			c.updateFDs(now)
+		}
+		key = func(c *cachedProcess) float64 { return float64(c.fds) }
+	default:
+		key = func(c *cachedProcess) float64 { return c.cpu }
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if ki, kj := key(sorted[i]), key(sorted[j]); ki != kj {
+			return ki > kj
+		}
+		return sorted[i].stat.rss > sorted[j].stat.rss
+	})
 
-		// Get Time
-		timeStr := "0:00.00"
-		times, err := p.Times()
-		if err == nil {
-			totalSecs := times.User + times.System
-			mins := int(totalSecs / 60)
-			secs := totalSecs - float64(mins*60)
-			timeStr = fmt.Sprintf("%d:%05.2f", mins, secs)
+	limit := cfg.Top
+	if limit <= 0 {
+		limit = defaultTopProcesses
+	}
+	limit = min(limit, len(sorted))
+
+	details := make(map[string]bool, len(cfg.Details))
+	for _, d := range cfg.Details {
+		details[d] = true
+	}
+	if cfg.SortBy == "io" || cfg.SortBy == "fds" {
+		details[cfg.SortBy] = true
+	}
+	var children map[int32]int
+	if details["tree"] {
+		children = make(map[int32]int)
+		for _, c := range procs {
+			children[c.stat.ppid]++
 		}
+	}
 
-		// Get Command
-		cmdline, _ := p.Cmdline()
+	results := make([]models.ProcessInfo, 0, limit)
+	for _, c := range sorted[:limit] {
+		user, _ := c.proc.Username()
+		cmdline, _ := c.proc.Cmdline()
 		if cmdline == "" {
-			cmdline = name
+			cmdline = c.name()
 		}
-
+		cmdline = redaction.redact(cmdline)
 		if len(cmdline) > 200 {
 			cmdline = cmdline[:200] + "..."
 		}
 
-		procList = append(procList, procData{
-			pid:     p.Pid,
-			name:    name,
-			user:    user,
-			status:  status,
-			cpu:     cpu,
-			memory:  mem,
-			resMem:  resMem,
-			virtMem: virtMem,
-			timeStr: timeStr,
-			command: cmdline,
-		})
-	}
-
-	sort.Slice(procList, func(i, j int) bool {
-		scoreI := procList[i].cpu + float64(procList[i].memory)
-		scoreJ := procList[j].cpu + float64(procList[j].memory)
-		return scoreI > scoreJ
-	})
+		mins := int(c.stat.cpuTime / 60)
+		secs := c.stat.cpuTime - float64(mins*60)
 
-	// Get top 10
-	limit := 10
-	if len(procList) < limit {
-		limit = len(procList)
+		info := models.ProcessInfo{
+			PID:        int(c.proc.Pid),
+			Name:       c.name(),
+			User:       user,
+			Status:     c.stat.state,
+			CPU:        c.cpu,
+			Memory:     processes.memoryPercent(c),
+			ResMemory:  c.stat.rss,
+			VirtMemory: c.stat.vms,
+			Time:       fmt.Sprintf("%d:%05.2f", mins, secs),
+			Command:    cmdline,
+		}
+		addProcessDetails(&info, c, now, details, children)
+		results = append(results, info)
 	}
 
-	results := make([]models.ProcessInfo, 0, limit)
-	for _, p := range procList[:limit] {
-		results = append(results, models.ProcessInfo{
-			PID:        int(p.pid),
-			Name:       p.name,
-			User:       p.user,
-			Status:     p.status,
-			CPU:        p.cpu,
-			Memory:     float64(p.memory),
-			ResMemory:  p.resMem,
-			VirtMemory: p.virtMem,
-			Time:       p.timeStr,
-			Command:    p.command,
-		})
+	return results
+}
+
+func addProcessDetails(info *models.ProcessInfo, c *cachedProcess, now time.Time, details map[string]bool, children map[int32]int) {
+	if details["threads"] {
+		info.Threads = int(c.stat.threads)
+	}
+	if details["fds"] {
+		c.updateFDs(now)
+		info.FDs = c.fds
 	}
+	if details["io"] {
+		c.updateIO(now)
+		info.ReadRate, info.WriteRate = c.readRate, c.writeRate
+	}
+	if details["tree"] {
+		info.PPID = int(c.stat.ppid)
+		if parent := processes.byPID[c.stat.ppid]; parent != nil {
+			info.ParentName = parent.name()
+		}
+		info.Children = children[c.proc.Pid]
+	}
+	if details["limits"] {
+		if limits, err := c.proc.Rlimit(); err == nil {
+			for _, l := range limits {
+				if l.Resource == process.RLIMIT_NOFILE {
+					info.FDLimit = l.Soft
+				}
+			}
+		}
+	}
+	if details["ctxSwitches"] {
+		if cs, err := c.proc.NumCtxSwitches(); err == nil {
+			info.VoluntaryCtxSwitches, info.InvoluntaryCtxSwitches = cs.Voluntary, cs.Involuntary
+		}
+	}
+	if details["startTime"] {
+		if created, err := c.proc.CreateTime(); err == nil {
+			info.StartTime = created
+		}
+	}
+	if details["cgroup"] {
+		info.Cgroup = readProcCgroup(c.proc.Pid)
+		info.ContainerID, info.Unit = parseCgroupPath(info.Cgroup)
+	}
+	if details["priority"] {
+		nice := int(c.stat.nice)
+		info.Nice = &nice
+		if c.stat.hasPrio {
+			prio := int(c.stat.prio)
+			info.Priority = &prio
+		}
+	}
+}
 
-	return results
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// parseCgroupPath finds the container and the systemd unit a cgroup belongs
+// to, from paths like /system.slice/docker-<id>.scope,
+// /docker/<id> or /kubepods/burstable/pod<uid>/<id>. Container IDs are
+// shortened to 12 characters like everywhere else in the payload.
+func parseCgroupPath(path string) (containerID, unit string) {
+	if id := containerIDPattern.FindString(path); id != "" {
+		containerID = id[:12]
+	}
+	for _, elem := range strings.Split(path, "/") {
+		if strings.HasSuffix(elem, ".service") || (containerID == "" && strings.HasSuffix(elem, ".scope")) {
+			unit = elem
+		}
+	}
+	return containerID, unit
 }
@@ -0,0 +1,53 @@
+package collector
+
+import (
+	"encoding/json"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+func TestCollectTopProcessesDetails(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs /proc")
+	}
+	saved := processes.at
+	defer func() { processes.at = saved }()
+	processes.at = time.Now()
+
+	self := func() *cachedProcess {
+		return &cachedProcess{proc: &process.Process{Pid: int32(os.Getpid())}, stat: procStat{name: "self", threads: 3}}
+	}
+
+	// Without details nothing extra is read or sent.
+	c := self()
+	info := collectTopProcesses([]*cachedProcess{c}, config.ProcessesConfig{})[0]
+	if info.Threads != 0 || info.FDs != 0 || !c.ioAt.IsZero() || !c.fdsAt.IsZero() {
+		t.Errorf("no details: %+v, io read %v, fds read %v", info, !c.ioAt.IsZero(), !c.fdsAt.IsZero())
+	}
+	data, _ := json.Marshal(info)
+	for _, field := range []string{"threads", "fds", "readRate", "writeRate"} {
+		if strings.Contains(string(data), `"`+field+`"`) {
+			t.Errorf("no details encodes %s: %s", field, data)
+		}
+	}
+
+	c = self()
+	info = collectTopProcesses([]*cachedProcess{c}, config.ProcessesConfig{Details: []string{"threads", "fds", "io"}})[0]
+	if info.Threads != 3 || info.FDs == 0 || c.ioAt.IsZero() {
+		t.Errorf("all details: %+v, io read %v", info, !c.ioAt.IsZero())
+	}
+
+	// The sort key is reported without being asked for.
+	c = self()
+	info = collectTopProcesses([]*cachedProcess{c}, config.ProcessesConfig{SortBy: "fds"})[0]
+	if info.FDs == 0 || info.Threads != 0 || !c.ioAt.IsZero() {
+		t.Errorf("sorted by fds: %+v, io read %v", info, !c.ioAt.IsZero())
+	}
+}
@@ -0,0 +1,196 @@
+package collector
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+)
+
+type processWatch struct {
+	config.ProcessWatch
+	cmdline *regexp.Regexp
+}
+
+type processWatchlist struct {
+	watches []processWatch
+}
+
+var processWatches *processWatchlist
+
+func newProcessWatchlist(watches []config.ProcessWatch) *processWatchlist {
+	if len(watches) == 0 {
+		return nil
+	}
+	l := &processWatchlist{}
+	for _, w := range watches {
+		pw := processWatch{ProcessWatch: w}
+		if w.Cmdline != "" {
+			re, err := regexp.Compile(w.Cmdline)
+			if err != nil {
+				log.Printf("Process watch %s: %v, skipping", w.Name, err)
+				continue
+			}
+			pw.cmdline = re
+		}
+		l.watches = append(l.watches, pw)
+	}
+	return l
+}
+
+// processFacts reads the attributes the watch rules match on lazily, as
+// most processes are ruled out by their name alone.
+type processFacts struct {
+	c *cachedProcess
+
+	exe, cmdline, user          string
+	gotExe, gotCmdline, gotUser bool
+}
+
+func (f *processFacts) getExe() string {
+	if !f.gotExe {
+		f.exe, _ = f.c.proc.Exe()
+		f.gotExe = true
+	}
+	return f.exe
+}
+
+func (f *processFacts) getCmdline() string {
+	if !f.gotCmdline {
+		f.cmdline, _ = f.c.proc.Cmdline()
+		f.gotCmdline = true
+	}
+	return f.cmdline
+}
+
+func (f *processFacts) getUser() string {
+	if !f.gotUser {
+		f.user, _ = f.c.proc.Username()
+		f.gotUser = true
+	}
+	return f.user
+}
+
+func (w *processWatch) matches(f *processFacts, pidfilePID int32) bool {
+	if w.Pidfile != "" && f.c.proc.Pid != pidfilePID {
+		return false
+	}
+	if w.Process != "" && f.c.name() != w.Process {
+		return false
+	}
+	if w.User != "" && f.getUser() != w.User {
+		return false
+	}
+	if w.Exe != "" {
+		exe := f.getExe()
+		if ok, _ := filepath.Match(w.Exe, exe); !ok && exe != w.Exe {
+			return false
+		}
+	}
+	if w.cmdline != nil && !w.cmdline.MatchString(f.getCmdline()) {
+		return false
+	}
+	return true
+}
+
+// collect reports every watched group, including the ones with no process
+// running.
+func (l *processWatchlist) collect(procs []*cachedProcess) []models.ProcessGroup {
+	if l == nil {
+		return nil
+	}
+	groups := make([]models.ProcessGroup, len(l.watches))
+	pidfilePIDs := make([]int32, len(l.watches))
+	for i, w := range l.watches {
+		groups[i] = models.ProcessGroup{Name: w.Name, MinCount: w.MinCount}
+		if w.Pidfile != "" {
+			pidfilePIDs[i] = readPidfile(hostPath(w.Pidfile))
+		}
+	}
+
+	for _, c := range procs {
+		facts := &processFacts{c: c}
+		for i := range l.watches {
+			if l.watches[i].matches(facts, pidfilePIDs[i]) {
+				addToGroup(&groups[i], c)
+			}
+		}
+	}
+
+	for i := range groups {
+		groups[i].State = "running"
+		if groups[i].Count < groups[i].MinCount {
+			groups[i].State = "not_running"
+		}
+	}
+	return groups
+}
+
+func addToGroup(g *models.ProcessGroup, c *cachedProcess) {
+	c.updateIO(processes.at)
+	c.updateFDs(processes.at)
+
+	g.Count++
+	g.PIDs = append(g.PIDs, int(c.proc.Pid))
+	g.CPU += c.cpu
+	g.Memory += processes.memoryPercent(c)
+	g.RSS += c.stat.rss
+	g.Threads += int(c.stat.threads)
+	g.FDs += c.fds
+	g.ReadBytes += c.readBytes
+	g.WriteBytes += c.writeBytes
+}
+
+// hostPath is where a path of the host is found: under HOST_ROOT when set,
+// as hostProc honors HOST_PROC, else under /host when the agent runs in a
+// container with the host's root mounted there.
+func hostPath(path string) string {
+	if root := os.Getenv("HOST_ROOT"); root != "" {
+		return filepath.Join(root, path)
+	}
+	if p := filepath.Join("/host", path); fileExists(p) {
+		return p
+	}
+	return path
+}
+
+func readPidfile(path string) int32 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return -1
+	}
+	pid, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+	if err != nil {
+		return -1
+	}
+	return int32(pid)
+}
+
+// processGroupEvents raises a critical event for every watched group that
+// has fewer processes than expected.
+func processGroupEvents(groups []models.ProcessGroup, now time.Time) []models.LogEvent {
+	var result []models.LogEvent
+	for _, g := range groups {
+		if g.State != "not_running" {
+			continue
+		}
+		result = append(result, models.LogEvent{
+			Rule:      "process-not-running",
+			Severity:  "critical",
+			Count:     1,
+			FirstSeen: now.UnixMilli(),
+			LastSeen:  now.UnixMilli(),
+			Source:    "processes",
+			Fields:    map[string]string{"group": g.Name},
+			Sample:    fmt.Sprintf("%s: %d of %d expected processes running", g.Name, g.Count, g.MinCount),
+		})
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/uptime-id/agent/config"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+func TestProcessWatchMatches(t *testing.T) {
+	c := &cachedProcess{proc: &process.Process{Pid: 42}, stat: procStat{name: "nginx"}}
+	facts := &processFacts{
+		c:   c,
+		exe: "/usr/sbin/nginx", cmdline: "nginx: worker process", user: "www-data",
+		gotExe: true, gotCmdline: true, gotUser: true,
+	}
+	tests := []struct {
+		name       string
+		watch      config.ProcessWatch
+		pidfilePID int32
+		want       bool
+	}{
+		{"process", config.ProcessWatch{Process: "nginx"}, 0, true},
+		{"other process", config.ProcessWatch{Process: "apache2"}, 0, false},
+		{"exe glob", config.ProcessWatch{Exe: "/usr/*/nginx"}, 0, true},
+		{"exe path", config.ProcessWatch{Exe: "/usr/sbin/nginx"}, 0, true},
+		{"other exe", config.ProcessWatch{Exe: "/opt/*"}, 0, false},
+		{"cmdline", config.ProcessWatch{Cmdline: "worker"}, 0, true},
+		{"other cmdline", config.ProcessWatch{Cmdline: "^master"}, 0, false},
+		{"user", config.ProcessWatch{Process: "nginx", User: "www-data"}, 0, true},
+		{"all must match", config.ProcessWatch{Process: "nginx", User: "root"}, 0, false},
+		{"pidfile", config.ProcessWatch{Pidfile: "/run/nginx.pid"}, 42, true},
+		{"other pid", config.ProcessWatch{Pidfile: "/run/nginx.pid"}, 7, false},
+		{"unreadable pidfile", config.ProcessWatch{Pidfile: "/run/nginx.pid"}, -1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := processWatch{ProcessWatch: tt.watch}
+			if tt.watch.Cmdline != "" {
+				w.cmdline = regexp.MustCompile(tt.watch.Cmdline)
+			}
+			if got := w.matches(facts, tt.pidfilePID); got != tt.want {
+				t.Errorf("matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessWatchlistCollect(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HOST_ROOT", root)
+	os.MkdirAll(filepath.Join(root, "run"), 0o755)
+	if err := os.WriteFile(filepath.Join(root, "run", "app.pid"), []byte("1000002\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	l := newProcessWatchlist([]config.ProcessWatch{
+		{Name: "web", Process: "nginx", MinCount: 2},
+		{Name: "cache", Process: "redis-server", MinCount: 2},
+		{Name: "db", Process: "postgres", MinCount: 1},
+		{Name: "app", Pidfile: "/run/app.pid", MinCount: 1},
+		{Name: "gone", Pidfile: "/run/gone.pid", MinCount: 1},
+	})
+	proc := func(pid int32, name string) *cachedProcess {
+		return &cachedProcess{proc: &process.Process{Pid: pid}, stat: procStat{name: name, threads: 2, rss: 1024}, cpu: 1.5}
+	}
+	groups := l.collect([]*cachedProcess{proc(1000001, "nginx"), proc(1000002, "nginx"), proc(1000003, "redis-server")})
+
+	want := []struct {
+		count int
+		state string
+	}{{2, "running"}, {1, "not_running"}, {0, "not_running"}, {1, "running"}, {0, "not_running"}}
+	for i, g := range groups {
+		if g.Count != want[i].count || g.State != want[i].state {
+			t.Errorf("%s: %d processes, %s", g.Name, g.Count, g.State)
+		}
+	}
+	if web := groups[0]; web.CPU != 3 || web.RSS != 2048 || web.Threads != 4 || len(web.PIDs) != 2 {
+		t.Errorf("web = %+v", web)
+	}
+	if app := groups[3]; app.PIDs[0] != 1000002 {
+		t.Errorf("app = %+v", app)
+	}
+
+	events := processGroupEvents(groups, processes.at)
+	if len(events) != 3 || events[0].Fields["group"] != "cache" || events[0].Sample != "cache: 1 of 2 expected processes running" {
+		t.Errorf("events = %+v", events)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package collector
+
+import "os/exec"
+
+// setProcessGroup leaves the default: cancelling cmd kills only the process
+// itself, and WaitDelay bounds how long its children can hold the output.
+func setProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,119 @@
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// Linux reports CPU times in clock ticks; USER_HZ is 100 on every
+// architecture the agent is built for.
+const clockTicks = 100
+
+var (
+	pageSize = uint64(os.Getpagesize())
+
+	procStates = map[byte]string{
+		'R': process.Running,
+		'S': process.Sleep,
+		'D': process.Blocked,
+		'T': process.Stop,
+		't': process.Stop,
+		'I': process.Idle,
+		'Z': process.Zombie,
+		'W': process.Wait,
+	}
+)
+
+// hostProc honors HOST_PROC like gopsutil, for agents running in a
+// container with the host's /proc mounted elsewhere.
+func hostProc(elem ...string) string {
+	root := os.Getenv("HOST_PROC")
+	if root == "" {
+		root = "/proc"
+	}
+	return filepath.Join(append([]string{root}, elem...)...)
+}
+
+// readProcStat gets everything the process table needs from a single read
+// of /proc/[pid]/stat.
+func readProcStat(p *process.Process) (procStat, error) {
+	data, err := os.ReadFile(hostProc(strconv.Itoa(int(p.Pid)), "stat"))
+	if err != nil {
+		return procStat{}, err
+	}
+
+	// The command name is in parentheses and may itself contain spaces and
+	// parentheses, so split after the last ')'.
+	lparen, rparen := bytes.IndexByte(data, '('), bytes.LastIndexByte(data, ')')
+	if lparen < 0 || rparen < lparen {
+		return procStat{}, fmt.Errorf("malformed stat for pid %d", p.Pid)
+	}
+	fields := bytes.Fields(data[rparen+1:])
+	if len(fields) < 22 {
+		return procStat{}, fmt.Errorf("short stat for pid %d", p.Pid)
+	}
+	num := func(i int) uint64 {
+		n, _ := strconv.ParseUint(string(fields[i]), 10, 64)
+		return n
+	}
+	signed := func(i int) int32 {
+		n, _ := strconv.ParseInt(string(fields[i]), 10, 32)
+		return int32(n)
+	}
+
+	var state string
+	if len(fields[0]) > 0 {
+		state = procStates[fields[0][0]]
+	}
+	return procStat{
+		name:    string(data[lparen+1 : rparen]),
+		state:   state,
+		ppid:    int32(num(1)),
+		cpuTime: float64(num(11)+num(12)) / clockTicks,
+		prio:    signed(15),
+		hasPrio: true,
+		nice:    signed(16),
+		threads: int32(num(17)),
+		start:   num(19),
+		vms:     num(20),
+		rss:     num(21) * pageSize,
+	}, nil
+}
+
+// readProcCgroup returns the cgroup path of a process: the unified (v2)
+// hierarchy, or the systemd one on v1 and hybrid hosts.
+func readProcCgroup(pid int32) string {
+	data, err := os.ReadFile(hostProc(strconv.Itoa(int(pid)), "cgroup"))
+	if err != nil {
+		return ""
+	}
+	var unified, systemd, cpu string
+	for _, line := range strings.Split(string(data), "\n") {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		switch {
+		case parts[0] == "0" && parts[1] == "":
+			unified = parts[2]
+		case parts[1] == "name=systemd":
+			systemd = parts[2]
+		case cpu == "" && strings.Contains(parts[1], "cpu"):
+			cpu = parts[2]
+		}
+	}
+	// Hybrid hosts mount an empty unified hierarchy next to the v1 ones.
+	for _, path := range []string{unified, systemd, cpu} {
+		if path != "" && path != "/" {
+			return path
+		}
+	}
+	return unified
+}
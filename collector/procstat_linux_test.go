@@ -0,0 +1,113 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// writeProcStat writes a /proc/[pid]/stat line under root: utime and stime
+// in clock ticks, rss in pages.
+func writeProcStat(t *testing.T, root string, pid int, comm string, utime, stime, start uint64) {
+	t.Helper()
+	dir := filepath.Join(root, fmt.Sprint(pid))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	line := fmt.Sprintf("%d (%s) S 1 %d %d 0 -1 4194560 100 0 0 0 %d %d 0 0 20 -5 3 0 %d 12345678 25 18446744073709551615\n",
+		pid, comm, pid, pid, utime, stime, start)
+	if err := os.WriteFile(filepath.Join(dir, "stat"), []byte(line), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadProcStat(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HOST_PROC", root)
+
+	// The command name may hold spaces and parentheses, even what looks
+	// like the following fields.
+	for i, comm := range []string{"nginx", "Web Content", "weird) (name", "a) S 1 2 3", ")", ""} {
+		t.Run(comm, func(t *testing.T) {
+			pid := 100 + i
+			writeProcStat(t, root, pid, comm, 250, 50, 9999)
+			stat, err := readProcStat(&process.Process{Pid: int32(pid)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := procStat{
+				name: comm, state: process.Sleep, ppid: 1, cpuTime: 3, prio: 20, hasPrio: true, nice: -5,
+				threads: 3, start: 9999, vms: 12345678, rss: 25 * pageSize,
+			}
+			if stat != want {
+				t.Errorf("stat = %+v\nwant   %+v", stat, want)
+			}
+		})
+	}
+
+	for pid, content := range map[int]string{
+		7: "7 nginx S 1 2 3\n",   // no parentheses
+		8: "8 (nginx) S 1 2 3\n", // too few fields
+	} {
+		os.MkdirAll(filepath.Join(root, fmt.Sprint(pid)), 0o755)
+		os.WriteFile(filepath.Join(root, fmt.Sprint(pid), "stat"), []byte(content), 0o644)
+	}
+	for _, pid := range []int32{7, 8, 9} { // 9 doesn't exist
+		if _, err := readProcStat(&process.Process{Pid: pid}); err == nil {
+			t.Errorf("pid %d: no error", pid)
+		}
+	}
+}
+
+func TestProcessTableCPU(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HOST_PROC", root)
+	table := &processTable{byPID: map[int32]*cachedProcess{}}
+	cpu := func(procs []*cachedProcess) map[int32]float64 {
+		m := map[int32]float64{}
+		for _, c := range procs {
+			m[c.proc.Pid] = math.Round(c.cpu*100) / 100
+		}
+		return m
+	}
+
+	start := time.Unix(1700000000, 0)
+	writeProcStat(t, root, 10, "busy", 1000, 0, 500)
+	writeProcStat(t, root, 11, "idle", 10, 10, 500)
+	writeProcStat(t, root, 12, "reused", 100, 0, 500)
+	first := cpu(table.refresh(start))
+	if first[10] != 0 || first[11] != 0 || len(first) != 3 {
+		t.Errorf("first refresh = %v, want no CPU on first sight", first)
+	}
+
+	// 10s later: 150 ticks of user and system time is 1.5s, 15%. PID 12
+	// now belongs to a process started later, which is new again.
+	writeProcStat(t, root, 10, "busy", 1100, 50, 500)
+	writeProcStat(t, root, 11, "idle", 10, 10, 500)
+	writeProcStat(t, root, 12, "reused", 5000, 0, 900)
+	writeProcStat(t, root, 13, "new", 100, 0, 950)
+	second := cpu(table.refresh(start.Add(10 * time.Second)))
+	if second[10] != 15 || second[11] != 0 || second[12] != 0 || second[13] != 0 {
+		t.Errorf("second refresh = %v", second)
+	}
+
+	// Exited processes are forgotten; counters going backwards don't give
+	// negative usage.
+	os.RemoveAll(filepath.Join(root, "11"))
+	os.RemoveAll(filepath.Join(root, "12"))
+	os.RemoveAll(filepath.Join(root, "13"))
+	writeProcStat(t, root, 10, "busy", 0, 0, 500)
+	third := cpu(table.refresh(start.Add(20 * time.Second)))
+	if len(third) != 1 || third[10] != 0 || len(table.byPID) != 1 {
+		t.Errorf("third refresh = %v, %d cached", third, len(table.byPID))
+	}
+	writeProcStat(t, root, 10, "busy", 400, 0, 500)
+	if fourth := cpu(table.refresh(start.Add(25 * time.Second))); fourth[10] != 80 {
+		t.Errorf("fourth refresh = %v", fourth)
+	}
+}
@@ -0,0 +1,46 @@
+//go:build !linux
+
+package collector
+
+import (
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// readProcStat gathers the process table fields through gopsutil where
+// there is no /proc to read in one pass.
+func readProcStat(p *process.Process) (procStat, error) {
+	name, err := p.Name()
+	if err != nil {
+		return procStat{}, err
+	}
+	created, err := p.CreateTime()
+	if err != nil {
+		return procStat{}, err
+	}
+
+	s := procStat{name: name, start: uint64(created)}
+	if states, err := p.Status(); err == nil && len(states) > 0 {
+		s.state = states[0]
+	}
+	if ppid, err := p.Ppid(); err == nil {
+		s.ppid = ppid
+	}
+	if times, err := p.Times(); err == nil {
+		s.cpuTime = times.User + times.System
+	}
+	if n, err := p.NumThreads(); err == nil {
+		s.threads = n
+	}
+	if nice, err := p.Nice(); err == nil {
+		s.nice = nice
+	}
+	if mi, err := p.MemoryInfo(); err == nil {
+		s.rss, s.vms = mi.RSS, mi.VMS
+	}
+	return s, nil
+}
+
+// readProcCgroup is Linux only.
+func readProcCgroup(pid int32) string {
+	return ""
+}
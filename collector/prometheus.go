@@ -0,0 +1,575 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+)
+
+const (
+	defaultScrapeInterval = 30 * time.Second
+	defaultScrapeTimeout  = 10 * time.Second
+	maxScrapeSize         = 16 << 20
+	maxScrapeSeries       = 10000 // per target
+)
+
+type relabelRule struct {
+	sourceLabels []string
+	separator    string
+	re           *regexp.Regexp
+	targetLabel  string
+	replacement  string
+	action       string
+}
+
+type scrapeTarget struct {
+	job      string
+	url      string
+	interval time.Duration
+	headers  map[string]string
+	labels   map[string]string
+	include  []*regexp.Regexp
+	exclude  []*regexp.Regexp
+	relabel  []relabelRule
+	client   *http.Client
+}
+
+type promCounter struct {
+	value float64
+	at    time.Time
+}
+
+// promScraper pulls Prometheus text exposition endpoints, each on its own
+// schedule, and converts the samples to custom metrics, one per histogram or
+// summary family. Collections report the latest scrape of every target.
+type promScraper struct {
+	timeout time.Duration
+	targets []*scrapeTarget
+
+	mu       sync.Mutex
+	counters map[string]promCounter // previous counter values, for rates
+	down     map[string]bool
+	results  map[*scrapeTarget][]models.CustomMetric
+}
+
+var prometheus *promScraper
+
+func startPromScraper(c config.PrometheusConfig) *promScraper {
+	p := newPromScraper(c)
+	if p == nil {
+		return nil
+	}
+	for _, t := range p.targets {
+		log.Printf("Prometheus scrape scheduled: %s every %v", t.job, t.interval)
+		go p.loop(t)
+	}
+	return p
+}
+
+func newPromScraper(c config.PrometheusConfig) *promScraper {
+	if len(c.Targets) == 0 {
+		return nil
+	}
+	p := &promScraper{
+		timeout:  c.Timeout.Or(defaultScrapeTimeout),
+		counters: map[string]promCounter{},
+		down:     map[string]bool{},
+		results:  map[*scrapeTarget][]models.CustomMetric{},
+	}
+	interval := c.Interval.Or(defaultScrapeInterval)
+	include := compileScrapeFilters("include", c.Include)
+	exclude := compileScrapeFilters("exclude", c.Exclude)
+
+	for _, t := range c.Targets {
+		job := t.Name
+		if job == "" {
+			if u, err := url.Parse(t.URL); err == nil {
+				job = u.Host
+			}
+		}
+		target := &scrapeTarget{
+			job:      job,
+			url:      t.URL,
+			interval: t.Interval.Or(interval),
+			headers:  t.Headers,
+			labels:   t.Labels,
+			include:  append(append([]*regexp.Regexp(nil), include...), compileScrapeFilters("include", t.Include)...),
+			exclude:  append(append([]*regexp.Regexp(nil), exclude...), compileScrapeFilters("exclude", t.Exclude)...),
+			client: &http.Client{Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify},
+			}},
+		}
+		for _, r := range t.Relabel {
+			rule, err := newRelabelRule(r)
+			if err != nil {
+				log.Printf("Prometheus %s: relabel: %v, skipping", job, err)
+				continue
+			}
+			target.relabel = append(target.relabel, rule)
+		}
+		p.targets = append(p.targets, target)
+	}
+	return p
+}
+
+func compileScrapeFilters(kind string, patterns []string) []*regexp.Regexp {
+	var res []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Printf("Prometheus %s %q: %v, skipping", kind, pattern, err)
+			continue
+		}
+		res = append(res, re)
+	}
+	return res
+}
+
+func newRelabelRule(r config.RelabelRule) (relabelRule, error) {
+	pattern := r.Regex
+	if pattern == "" {
+		pattern = "(.*)"
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return relabelRule{}, err
+	}
+	rule := relabelRule{
+		sourceLabels: r.SourceLabels,
+		separator:    r.Separator,
+		re:           re,
+		targetLabel:  r.TargetLabel,
+		replacement:  r.Replacement,
+		action:       r.Action,
+	}
+	if rule.separator == "" {
+		rule.separator = ";"
+	}
+	if rule.replacement == "" {
+		rule.replacement = "$1"
+	}
+	if rule.action == "" {
+		rule.action = "replace"
+	}
+	return rule, nil
+}
+
+func (p *promScraper) loop(t *scrapeTarget) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		metrics := p.scrapeTarget(t)
+		p.mu.Lock()
+		p.results[t] = metrics
+		p.mu.Unlock()
+		<-ticker.C
+	}
+}
+
+// latest returns the last scrape of every target that has been scraped, in
+// config order. Each target also reports an "up" gauge, as Prometheus does,
+// so a failing exporter is visible.
+func (p *promScraper) latest() []models.CustomMetric {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var all []models.CustomMetric
+	for _, t := range p.targets {
+		all = append(all, p.results[t]...)
+	}
+	return all
+}
+
+func (p *promScraper) scrapeTarget(t *scrapeTarget) []models.CustomMetric {
+	now := time.Now()
+	up := models.CustomMetric{
+		Name:      "up",
+		Type:      "gauge",
+		Labels:    map[string]string{"job": t.job, "instance": scrapeInstance(t.url)},
+		Source:    "prometheus",
+		Timestamp: now.UnixMilli(),
+	}
+
+	samples, types, err := t.fetch(p.timeout)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		if !p.down[t.url] {
+			log.Printf("Prometheus %s: %v", t.job, err)
+		}
+		p.down[t.url] = true
+		return []models.CustomMetric{up}
+	}
+	p.down[t.url] = false
+	up.Value = 1
+
+	metrics := []models.CustomMetric{up}
+	for _, m := range promFamilies(samples, types) {
+		if !t.keep(&m) || !customMetricFinite(m) {
+			continue
+		}
+		if len(metrics) > maxScrapeSeries {
+			log.Printf("Prometheus %s: more than %d series, truncating", t.job, maxScrapeSeries)
+			break
+		}
+		m.Source = "prometheus"
+		m.Timestamp = now.UnixMilli()
+		if m.Type == "counter" {
+			key := t.url + "\x00" + customMetricKey(m)
+			if prev, ok := p.counters[key]; ok && m.Value >= prev.value {
+				if elapsed := now.Sub(prev.at).Seconds(); elapsed > 0 {
+					m.Rate = (m.Value - prev.value) / elapsed
+				}
+			}
+			p.counters[key] = promCounter{value: m.Value, at: now}
+		}
+		metrics = append(metrics, m)
+	}
+
+	// Forget counters of series that went away.
+	prefix := t.url + "\x00"
+	for key, c := range p.counters {
+		if !c.at.Equal(now) && strings.HasPrefix(key, prefix) {
+			delete(p.counters, key)
+		}
+	}
+	return metrics
+}
+
+func scrapeInstance(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Host
+	}
+	return rawURL
+}
+
+func (t *scrapeTarget) fetch(timeout time.Duration) ([]promSample, map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "text/plain;version=0.0.4;q=1,*/*;q=0.1")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return parsePromText(io.LimitReader(resp.Body, maxScrapeSize))
+}
+
+// keep applies the name filters, the target labels and the relabel rules,
+// and reports whether the metric survives.
+func (t *scrapeTarget) keep(m *models.CustomMetric) bool {
+	if len(t.include) > 0 && !matchesAny(t.include, m.Name) {
+		return false
+	}
+	if matchesAny(t.exclude, m.Name) {
+		return false
+	}
+
+	labels := make(map[string]string, len(m.Labels)+len(t.labels)+3)
+	for k, v := range m.Labels {
+		labels[k] = v
+	}
+	for k, v := range t.labels {
+		labels[k] = v
+	}
+	if _, ok := labels["job"]; !ok {
+		labels["job"] = t.job
+	}
+	if _, ok := labels["instance"]; !ok {
+		labels["instance"] = scrapeInstance(t.url)
+	}
+	labels["__name__"] = m.Name
+	for _, r := range t.relabel {
+		if !r.apply(labels) {
+			return false
+		}
+	}
+
+	m.Name = labels["__name__"]
+	for k := range labels {
+		if strings.HasPrefix(k, "__") {
+			delete(labels, k)
+		}
+	}
+	m.Labels = labels
+	return m.Name != ""
+}
+
+func matchesAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r relabelRule) apply(labels map[string]string) bool {
+	values := make([]string, len(r.sourceLabels))
+	for i, name := range r.sourceLabels {
+		values[i] = labels[name]
+	}
+	value := strings.Join(values, r.separator)
+
+	switch r.action {
+	case "keep":
+		return r.re.MatchString(value)
+	case "drop":
+		return !r.re.MatchString(value)
+	case "labeldrop", "labelkeep":
+		for name := range labels {
+			if name == "__name__" {
+				continue
+			}
+			if r.re.MatchString(name) == (r.action == "labeldrop") {
+				delete(labels, name)
+			}
+		}
+	case "replace":
+		match := r.re.FindStringSubmatchIndex(value)
+		if match == nil {
+			return true
+		}
+		result := string(r.re.ExpandString(nil, r.replacement, value, match))
+		if result == "" {
+			delete(labels, r.targetLabel)
+		} else {
+			labels[r.targetLabel] = result
+		}
+	}
+	return true
+}
+
+type promSample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// parsePromText reads the Prometheus text exposition format and returns the
+// samples with the declared type of each metric family.
+func parsePromText(r io.Reader) ([]promSample, map[string]string, error) {
+	types := map[string]string{}
+	var samples []promSample
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if line[0] == '#' {
+			// "# TYPE name type"; HELP and other comments are skipped.
+			if f := strings.Fields(line); len(f) >= 4 && f[1] == "TYPE" {
+				types[f[2]] = f[3]
+			}
+			continue
+		}
+
+		s, err := parsePromSample(line)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %q: %w", line, err)
+		}
+		if !math.IsNaN(s.value) {
+			samples = append(samples, s)
+		}
+	}
+	return samples, types, sc.Err()
+}
+
+func parsePromSample(line string) (promSample, error) {
+	var s promSample
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return s, fmt.Errorf("missing value")
+	}
+	s.name, line = line[:end], line[end:]
+
+	if line[0] == '{' {
+		labels, rest, err := parsePromLabels(line[1:])
+		if err != nil {
+			return s, err
+		}
+		s.labels, line = labels, rest
+	}
+
+	// The optional timestamp is ignored; samples are stamped at scrape time.
+	f := strings.Fields(line)
+	if len(f) == 0 {
+		return s, fmt.Errorf("missing value")
+	}
+	v, err := strconv.ParseFloat(f[0], 64)
+	if err != nil {
+		return s, fmt.Errorf("invalid value %q", f[0])
+	}
+	s.value = v
+	return s, nil
+}
+
+// parsePromLabels parses `name="value",...}` and returns what follows the
+// closing brace.
+func parsePromLabels(s string) (map[string]string, string, error) {
+	labels := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return nil, "", fmt.Errorf("unterminated labels")
+		}
+		if s[0] == '}' {
+			return labels, s[1:], nil
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || eq+1 >= len(s) || s[eq+1] != '"' {
+			return nil, "", fmt.Errorf("invalid label")
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = s[eq+2:]
+
+		var value strings.Builder
+		closed := false
+		for i := 0; i < len(s); i++ {
+			c := s[i]
+			if c == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			if c == '"' {
+				s, closed = s[i+1:], true
+				break
+			}
+			value.WriteByte(c)
+		}
+		if !closed {
+			return nil, "", fmt.Errorf("unterminated label value")
+		}
+		labels[name] = value.String()
+	}
+}
+
+// promFamilies folds the _bucket/_sum/_count samples of histograms and the
+// quantile/_sum/_count samples of summaries into one metric per label set.
+// Counters and gauges map one to one; untyped samples become gauges.
+func promFamilies(samples []promSample, types map[string]string) []models.CustomMetric {
+	var result []models.CustomMetric
+	grouped := map[string]int{} // family and labels -> index in result
+
+	for _, s := range samples {
+		family, suffix := promFamily(s.name, types)
+		switch types[family] {
+		case "histogram", "gaugehistogram", "summary":
+		default:
+			metricType := "gauge"
+			if types[family] == "counter" {
+				metricType = "counter"
+			}
+			result = append(result, models.CustomMetric{Name: s.name, Type: metricType, Value: s.value, Labels: s.labels})
+			continue
+		}
+
+		labels := make(map[string]string, len(s.labels))
+		for k, v := range s.labels {
+			if k != "le" && k != "quantile" {
+				labels[k] = v
+			}
+		}
+		m := models.CustomMetric{Name: family, Type: "histogram", Labels: labels}
+		if types[family] == "summary" {
+			m.Type = "summary"
+		}
+		key := customMetricKey(m)
+		i, ok := grouped[key]
+		if !ok {
+			i = len(result)
+			grouped[key] = i
+			result = append(result, m)
+		}
+		dst := &result[i]
+
+		switch suffix {
+		case "_sum":
+			dst.Sum = s.value
+		case "_count":
+			dst.Count = uint64(s.value)
+		case "_bucket":
+			le, err := strconv.ParseFloat(s.labels["le"], 64)
+			if err == nil && !math.IsInf(le, 1) {
+				dst.Buckets = append(dst.Buckets, models.HistogramBucket{UpperBound: le, Count: uint64(s.value)})
+			}
+		default:
+			if q, ok := s.labels["quantile"]; ok {
+				if dst.Quantiles == nil {
+					dst.Quantiles = map[string]float64{}
+				}
+				dst.Quantiles[q] = s.value
+			}
+		}
+	}
+
+	for i := range result {
+		m := &result[i]
+		if m.Type == "histogram" || m.Type == "summary" {
+			sort.Slice(m.Buckets, func(a, b int) bool { return m.Buckets[a].UpperBound < m.Buckets[b].UpperBound })
+			if m.Count > 0 {
+				m.Value = m.Sum / float64(m.Count)
+			}
+		}
+	}
+	return result
+}
+
+// promFamily returns the metric family a sample belongs to and the suffix
+// that distinguishes histogram and summary series.
+func promFamily(name string, types map[string]string) (string, string) {
+	if _, ok := types[name]; ok {
+		return name, ""
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count", "_total"} {
+		base, ok := strings.CutSuffix(name, suffix)
+		if !ok {
+			continue
+		}
+		switch types[base] {
+		case "histogram", "gaugehistogram", "summary":
+			return base, suffix
+		case "counter":
+			// OpenMetrics declares counters without their _total suffix.
+			return base, suffix
+		}
+	}
+	return name, ""
+}
@@ -0,0 +1,284 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+)
+
+const promExposition = `# HELP http_requests_total Requests.
+# TYPE http_requests_total counter
+http_requests_total{method="get",path="/a\"b\\c\nd"} 1027 1395066363000
+http_requests_total{method="post"} 3
+# TYPE temp gauge
+temp 21.5
+temp_missing NaN
+untyped_metric{a="1",} 7
+# TYPE lat histogram
+lat_bucket{le="0.5"} 2
+lat_bucket{le="0.1"} 1
+lat_bucket{le="+Inf"} 4
+lat_sum 3.2
+lat_count 4
+# TYPE rpc summary
+rpc{quantile="0.5"} 0.01
+rpc{quantile="0.99"} 0.2
+rpc_sum 1.5
+rpc_count 30
+# TYPE om_requests counter
+om_requests_total 9
+`
+
+func promByKey(metrics []models.CustomMetric) map[string]models.CustomMetric {
+	byKey := map[string]models.CustomMetric{}
+	for _, m := range metrics {
+		byKey[m.Name+fmt.Sprint(m.Labels)] = m
+	}
+	return byKey
+}
+
+func TestParsePromText(t *testing.T) {
+	samples, types, err := parsePromText(strings.NewReader(promExposition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 14 {
+		t.Errorf("%d samples, want NaN skipped", len(samples))
+	}
+	if types["http_requests_total"] != "counter" || types["lat"] != "histogram" || types["rpc"] != "summary" {
+		t.Errorf("types = %v", types)
+	}
+	if s := samples[0]; s.name != "http_requests_total" || s.value != 1027 || s.labels["path"] != "/a\"b\\c\nd" {
+		t.Errorf("escaped sample = %+v", s)
+	}
+
+	for _, bad := range []string{
+		`metric{a="1" 2`,
+		`metric{a=1} 2`,
+		`metric{a="1} 2`,
+		`metric`,
+		`metric abc`,
+		`{a="1"} 2`,
+	} {
+		if _, _, err := parsePromText(strings.NewReader(bad)); err == nil {
+			t.Errorf("parsePromText(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestPromFamilies(t *testing.T) {
+	samples, types, err := parsePromText(strings.NewReader(promExposition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := promByKey(promFamilies(samples, types))
+	if len(got) != 7 {
+		t.Errorf("%d metrics: %v", len(got), got)
+	}
+
+	if m := got["http_requests_total"+fmt.Sprint(map[string]string{"method": "post"})]; m.Type != "counter" || m.Value != 3 {
+		t.Errorf("counter = %+v", m)
+	}
+	if m := got["temp"+fmt.Sprint(map[string]string(nil))]; m.Type != "gauge" || m.Value != 21.5 {
+		t.Errorf("gauge = %+v", m)
+	}
+	if m := got["untyped_metric"+fmt.Sprint(map[string]string{"a": "1"})]; m.Type != "gauge" {
+		t.Errorf("untyped = %+v", m)
+	}
+	lat := got["lat"+fmt.Sprint(map[string]string{})]
+	wantBuckets := []models.HistogramBucket{{UpperBound: 0.1, Count: 1}, {UpperBound: 0.5, Count: 2}}
+	if lat.Type != "histogram" || lat.Count != 4 || lat.Sum != 3.2 || lat.Value != 0.8 || fmt.Sprint(lat.Buckets) != fmt.Sprint(wantBuckets) {
+		t.Errorf("histogram = %+v", lat)
+	}
+	rpc := got["rpc"+fmt.Sprint(map[string]string{})]
+	if rpc.Type != "summary" || rpc.Count != 30 || rpc.Quantiles["0.99"] != 0.2 || rpc.Quantiles["0.5"] != 0.01 {
+		t.Errorf("summary = %+v", rpc)
+	}
+	if m := got["om_requests_total"+fmt.Sprint(map[string]string(nil))]; m.Type != "counter" || m.Value != 9 {
+		t.Errorf("OpenMetrics counter = %+v", m)
+	}
+}
+
+func TestRelabel(t *testing.T) {
+	rule := func(r config.RelabelRule) relabelRule {
+		t.Helper()
+		rr, err := newRelabelRule(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rr
+	}
+	tests := []struct {
+		name   string
+		rules  []relabelRule
+		in     models.CustomMetric
+		keep   bool
+		wantM  string
+		labels map[string]string
+	}{
+		{
+			name:   "target labels and defaults",
+			in:     models.CustomMetric{Name: "m", Labels: map[string]string{"a": "1"}},
+			keep:   true,
+			wantM:  "m",
+			labels: map[string]string{"a": "1", "env": "prod", "job": "node", "instance": "host:9100"},
+		},
+		{
+			name:  "drop by name",
+			rules: []relabelRule{rule(config.RelabelRule{SourceLabels: []string{"__name__"}, Regex: "go_.*", Action: "drop"})},
+			in:    models.CustomMetric{Name: "go_goroutines"},
+		},
+		{
+			name:  "keep matches the whole value",
+			rules: []relabelRule{rule(config.RelabelRule{SourceLabels: []string{"__name__"}, Regex: "node", Action: "keep"})},
+			in:    models.CustomMetric{Name: "node_load1"},
+		},
+		{
+			name: "replace with groups and separator",
+			rules: []relabelRule{rule(config.RelabelRule{SourceLabels: []string{"a", "b"}, Regex: "(.*);(.*)",
+				TargetLabel: "ab", Replacement: "$2-$1"})},
+			in:     models.CustomMetric{Name: "m", Labels: map[string]string{"a": "x", "b": "y"}},
+			keep:   true,
+			wantM:  "m",
+			labels: map[string]string{"a": "x", "b": "y", "ab": "y-x", "env": "prod", "job": "node", "instance": "host:9100"},
+		},
+		{
+			name:   "rename the metric",
+			rules:  []relabelRule{rule(config.RelabelRule{SourceLabels: []string{"__name__"}, Regex: "old_(.*)", TargetLabel: "__name__", Replacement: "new_$1"})},
+			in:     models.CustomMetric{Name: "old_x"},
+			keep:   true,
+			wantM:  "new_x",
+			labels: map[string]string{"env": "prod", "job": "node", "instance": "host:9100"},
+		},
+		{
+			name:   "labeldrop",
+			rules:  []relabelRule{rule(config.RelabelRule{Regex: "env|instance", Action: "labeldrop"})},
+			in:     models.CustomMetric{Name: "m"},
+			keep:   true,
+			wantM:  "m",
+			labels: map[string]string{"job": "node"},
+		},
+		{
+			name:   "labelkeep",
+			rules:  []relabelRule{rule(config.RelabelRule{Regex: "job", Action: "labelkeep"})},
+			in:     models.CustomMetric{Name: "m", Labels: map[string]string{"a": "1"}},
+			keep:   true,
+			wantM:  "m",
+			labels: map[string]string{"job": "node"},
+		},
+		{
+			name:   "empty replacement removes the label",
+			rules:  []relabelRule{rule(config.RelabelRule{SourceLabels: []string{"a"}, TargetLabel: "env", Replacement: "$9"})},
+			in:     models.CustomMetric{Name: "m", Labels: map[string]string{"a": "1"}},
+			keep:   true,
+			wantM:  "m",
+			labels: map[string]string{"a": "1", "job": "node", "instance": "host:9100"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := &scrapeTarget{job: "node", url: "http://host:9100/metrics", labels: map[string]string{"env": "prod"}, relabel: tt.rules}
+			m := tt.in
+			if got := target.keep(&m); got != tt.keep {
+				t.Fatalf("keep = %v", got)
+			}
+			if !tt.keep {
+				return
+			}
+			if m.Name != tt.wantM || fmt.Sprint(m.Labels) != fmt.Sprint(tt.labels) {
+				t.Errorf("got %s %v, want %s %v", m.Name, m.Labels, tt.wantM, tt.labels)
+			}
+		})
+	}
+
+	if _, err := newRelabelRule(config.RelabelRule{Regex: "("}); err == nil {
+		t.Error("invalid regex accepted")
+	}
+}
+
+func TestPromScraper(t *testing.T) {
+	var hits atomic.Int64
+	var fail atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "t" || fail.Load() {
+			http.Error(w, "no", http.StatusForbidden)
+			return
+		}
+		n := hits.Add(1)
+		fmt.Fprintf(w, "# TYPE jobs_total counter\njobs_total %d\n# TYPE inf gauge\ninf +Inf\n# TYPE skip_me gauge\nskip_me 1\n", n*10)
+	}))
+	defer srv.Close()
+
+	p := newPromScraper(config.PrometheusConfig{
+		Exclude: []string{"^skip_"},
+		Targets: []config.PrometheusTarget{{Name: "app", URL: srv.URL, Headers: map[string]string{"X-Token": "t"}}},
+	})
+	target := p.targets[0]
+	if target.interval != defaultScrapeInterval {
+		t.Errorf("interval = %v", target.interval)
+	}
+	if got := p.latest(); len(got) != 0 {
+		t.Errorf("latest before any scrape = %+v", got)
+	}
+
+	first := promByKey(p.scrapeTarget(target))
+	time.Sleep(20 * time.Millisecond)
+	second := promByKey(p.scrapeTarget(target))
+	labels := fmt.Sprint(map[string]string{"job": "app", "instance": strings.TrimPrefix(srv.URL, "http://")})
+	if up := first["up"+labels]; up.Value != 1 {
+		t.Errorf("up = %+v", up)
+	}
+	if len(second) != 2 {
+		t.Errorf("scrape = %+v, want up and jobs_total only", second)
+	}
+	jobs := second["jobs_total"+labels]
+	if jobs.Value != 20 || jobs.Rate <= 0 || first["jobs_total"+labels].Rate != 0 {
+		t.Errorf("counter = %+v", jobs)
+	}
+
+	fail.Store(true)
+	down := p.scrapeTarget(target)
+	if len(down) != 1 || down[0].Name != "up" || down[0].Value != 0 {
+		t.Errorf("failed scrape = %+v", down)
+	}
+}
+
+func TestPromScraperLoop(t *testing.T) {
+	var hits atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hits %d\n", hits.Add(1))
+	}))
+	defer srv.Close()
+
+	p := startPromScraper(config.PrometheusConfig{
+		Interval: config.Duration(time.Hour),
+		Targets: []config.PrometheusTarget{
+			{Name: "fast", URL: srv.URL, Interval: config.Duration(20 * time.Millisecond)},
+			{Name: "slow", URL: srv.URL},
+		},
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for hits.Load() < 5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if hits.Load() < 5 {
+		t.Fatalf("%d scrapes in 5s", hits.Load())
+	}
+
+	var jobs []string
+	for _, m := range p.latest() {
+		if m.Name == "up" {
+			jobs = append(jobs, m.Labels["job"])
+		}
+	}
+	if fmt.Sprint(jobs) != "[fast slow]" {
+		t.Errorf("jobs = %v", jobs)
+	}
+}
@@ -0,0 +1,183 @@
+package collector
+
+import (
+	"log"
+	"maps"
+	"regexp"
+	"strings"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+)
+
+const redactedText = "[REDACTED]"
+
+type redactionRule struct {
+	name    string
+	re      *regexp.Regexp
+	replace string
+	valid   func(match string) bool // optional check to cut false positives
+}
+
+// Built-in rules, applied in order. Rules that keep a prefix (key names,
+// URL schemes) use $1 in the replacement so the context stays readable.
+var builtinRedactionRules = []redactionRule{
+	{name: "private-key", re: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), replace: redactedText},
+	{name: "url-credentials", re: regexp.MustCompile(`\b([a-zA-Z][a-zA-Z0-9+.-]*://[^:/\s@]+:)[^@\s]+@`), replace: "${1}" + redactedText + "@"},
+	{name: "bearer-token", re: regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9._~+/=-]+`), replace: "${1}" + redactedText},
+	{name: "basic-auth", re: regexp.MustCompile(`(?i)\b(authorization:\s*basic\s+)[A-Za-z0-9+/=]+`), replace: "${1}" + redactedText},
+	{name: "jwt", re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`), replace: redactedText},
+	{name: "aws-access-key", re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), replace: redactedText},
+	{name: "secret-assignment", re: regexp.MustCompile(`(?i)\b((?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key|secret[_-]?key|client[_-]?secret|aws_secret_access_key)["']?\s*[=:]\s*)("[^"]*"|'[^']*'|[^\s,;&"']+)`), replace: "${1}" + redactedText},
+	{name: "secret-flag", re: regexp.MustCompile(`(?i)(--(?:password|passwd|secret|token|api-key)\s+)(\S+)`), replace: "${1}" + redactedText},
+	{name: "credit-card", re: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), replace: redactedText, valid: luhnValid},
+	{name: "email", re: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`), replace: redactedText},
+}
+
+// redactor scrubs secrets and personal data from everything that leaves
+// the host: log records, process command lines, labels, attributes and
+// error messages.
+type redactor struct {
+	rules []redactionRule
+}
+
+var redaction *redactor
+
+func newRedactor(c config.RedactionConfig) *redactor {
+	r := &redactor{}
+	if !c.DisableBuiltin {
+		r.rules = append(r.rules, builtinRedactionRules...)
+	}
+	for i, rule := range c.Rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			log.Printf("Redaction rule #%d (%s): %v, skipping", i+1, rule.Name, err)
+			continue
+		}
+		replace := rule.Replacement
+		if replace == "" {
+			replace = redactedText
+		}
+		r.rules = append(r.rules, redactionRule{name: rule.Name, re: re, replace: replace})
+	}
+	return r
+}
+
+func (r *redactor) redact(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, rule := range r.rules {
+		if rule.valid == nil {
+			s = rule.re.ReplaceAllString(s, rule.replace)
+			continue
+		}
+		s = rule.re.ReplaceAllStringFunc(s, func(m string) string {
+			if !rule.valid(m) {
+				return m
+			}
+			return rule.re.ReplaceAllString(m, rule.replace)
+		})
+	}
+	return s
+}
+
+// apply redacts the free-text parts of a collected metric. Process command
+// lines are redacted at collection, before they are truncated.
+func (r *redactor) apply(m *models.Metric) {
+	if r == nil || len(r.rules) == 0 {
+		return
+	}
+	for i := range m.Logs.Records {
+		rec := &m.Logs.Records[i]
+		rec.Message = r.redact(rec.Message)
+		rec.Fields = r.redactMap(rec.Fields)
+	}
+	for i := range m.Events {
+		ev := &m.Events[i]
+		ev.Sample = r.redact(ev.Sample)
+		ev.Fields = r.redactMap(ev.Fields)
+	}
+	if m.Security != nil {
+		for i := range m.Security.Sudo {
+			m.Security.Sudo[i].Command = r.redact(m.Security.Sudo[i].Command)
+			m.Security.Sudo[i].Denied = r.redact(m.Security.Sudo[i].Denied)
+		}
+	}
+	for i := range m.Containers {
+		if k := m.Containers[i].Kubernetes; k != nil {
+			k.Labels = r.redactMap(k.Labels)
+		}
+	}
+	for i := range m.CustomMetrics {
+		m.CustomMetrics[i].Labels = r.redactMap(m.CustomMetrics[i].Labels)
+	}
+	for i := range m.Spans {
+		span := &m.Spans[i]
+		span.Name = r.redact(span.Name)
+		span.StatusMessage = r.redact(span.StatusMessage)
+		span.Attributes = r.redactMap(span.Attributes)
+	}
+	for i := range m.Checks {
+		m.Checks[i].Message = r.redact(m.Checks[i].Message)
+		m.Checks[i].Output = r.redact(m.Checks[i].Output)
+	}
+	for i := range m.Probes {
+		m.Probes[i].Target = r.redact(m.Probes[i].Target)
+		m.Probes[i].Error = r.redact(m.Probes[i].Error)
+	}
+	for i := range m.Certificates {
+		m.Certificates[i].Error = r.redact(m.Certificates[i].Error)
+		m.Certificates[i].ChainError = r.redact(m.Certificates[i].ChainError)
+	}
+	for i := range m.Textfiles {
+		m.Textfiles[i].Error = r.redact(m.Textfiles[i].Error)
+	}
+}
+
+// redactMap redacts the values of a map, keeping the keys. Label maps can be
+// shared with receiver state and caches, so a copy is returned when a value
+// changes and the original is left alone.
+func (r *redactor) redactMap(m map[string]string) map[string]string {
+	var out map[string]string
+	for k, v := range m {
+		if rv := r.redact(v); rv != v {
+			if out == nil {
+				out = maps.Clone(m)
+			}
+			out[k] = rv
+		}
+	}
+	if out == nil {
+		return m
+	}
+	return out
+}
+
+// luhnValid keeps order numbers, timestamps and other long digit runs from
+// being taken for card numbers.
+func luhnValid(s string) bool {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
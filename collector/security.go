@@ -0,0 +1,161 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/uptime-id/agent/models"
+)
+
+// securityApps are the programs whose log lines feed the security stream
+// and the authentication tracker. Since OpenSSH 9.8 the per-connection
+// messages come from sshd-session.
+var securityApps = map[string]bool{"sshd": true, "sshd-session": true, "sudo": true, "su": true}
+
+var (
+	sshAccepted = regexp.MustCompile(`Accepted (\S+) for (\S+) from (\S+) port \d+`)
+	sshFailed   = regexp.MustCompile(`Failed (\S+) for (invalid user )?(\S+) from (\S+) port \d+`)
+	pamFailure  = regexp.MustCompile(`pam_unix\(([^:)]+):auth\): authentication failure;.*?(?:rhost=(\S*))?\s+user=(\S+)`)
+	sudoLine    = regexp.MustCompile(`^\s*(\S+) : (?:(.*?) ; )?TTY=(\S+) ; PWD=.*? ; USER=(\S+) ;(?: .*?;)* COMMAND=(.*)$`)
+)
+
+var utmpPaths = []string{"/host/run/utmp", "/host/var/run/utmp", "/run/utmp", "/var/run/utmp"}
+
+// collectSecurity derives login, failure and sudo counts from the
+// interval's security log records and lists the open utmp sessions.
+func collectSecurity(records []models.LogRecord) *models.SecurityInfo {
+	info := &models.SecurityInfo{}
+	logins := map[string]*models.AuthLogin{}
+	failures := map[string]*models.AuthFailure{}
+	sudo := map[string]*models.SudoCommand{}
+
+	for _, rec := range records {
+		if rec.Source != "security" {
+			continue
+		}
+		// sudo also logs PAM failures, which fall through to the default case.
+		var m []string
+		if recordApp(rec) == "sudo" {
+			m = sudoLine.FindStringSubmatch(rec.Message)
+		}
+
+		switch {
+		case m != nil:
+			key := strings.Join(m[1:], "\x00")
+			s := sudo[key]
+			if s == nil {
+				s = &models.SudoCommand{User: m[1], Denied: m[2], TTY: m[3], RunAs: m[4], Command: m[5]}
+				sudo[key] = s
+			}
+			s.Count++
+			s.LastSeen = max(s.LastSeen, rec.Timestamp)
+
+		case strings.HasPrefix(rec.Message, "Accepted "):
+			m := sshAccepted.FindStringSubmatch(rec.Message)
+			if m == nil {
+				continue
+			}
+			key := m[2] + "\x00" + m[3] + "\x00" + m[1]
+			l := logins[key]
+			if l == nil {
+				l = &models.AuthLogin{User: m[2], SourceIP: m[3], Method: m[1], Service: "sshd"}
+				logins[key] = l
+			}
+			l.Count++
+			l.LastSeen = max(l.LastSeen, rec.Timestamp)
+
+		default:
+			var user, ip, service string
+			invalid := false
+			if m := sshFailed.FindStringSubmatch(rec.Message); m != nil {
+				user, ip, service, invalid = m[3], m[4], "sshd", m[2] != ""
+			} else if m := pamFailure.FindStringSubmatch(rec.Message); m != nil && m[1] != "sshd" {
+				// sshd logs its own "Failed ..." line for the same attempt.
+				user, ip, service = m[3], m[2], m[1]
+			} else {
+				continue
+			}
+			key := ip + "\x00" + user + "\x00" + service
+			f := failures[key]
+			if f == nil {
+				f = &models.AuthFailure{User: user, SourceIP: ip, Service: service, InvalidUser: invalid}
+				failures[key] = f
+			}
+			f.Count++
+			f.LastSeen = max(f.LastSeen, rec.Timestamp)
+		}
+	}
+
+	for _, s := range sudo {
+		info.Sudo = append(info.Sudo, *s)
+	}
+	for _, l := range logins {
+		info.Logins = append(info.Logins, *l)
+	}
+	for _, f := range failures {
+		info.Failures = append(info.Failures, *f)
+	}
+	sort.Slice(info.Logins, func(i, j int) bool { return info.Logins[i].LastSeen > info.Logins[j].LastSeen })
+	sort.Slice(info.Failures, func(i, j int) bool { return info.Failures[i].Count > info.Failures[j].Count })
+	sort.Slice(info.Sudo, func(i, j int) bool { return info.Sudo[i].LastSeen > info.Sudo[j].LastSeen })
+
+	info.Sessions = readUtmpSessions()
+
+	if len(info.Logins) == 0 && len(info.Failures) == 0 && len(info.Sudo) == 0 && len(info.Sessions) == 0 {
+		return nil
+	}
+	return info
+}
+
+// recordApp is the program that wrote a log record: the journal's
+// SYSLOG_IDENTIFIER or the tag parsed from a syslog line.
+func recordApp(rec models.LogRecord) string {
+	if app := rec.Fields["identifier"]; app != "" {
+		return app
+	}
+	return rec.Fields["appName"]
+}
+
+const (
+	utmpRecordSize  = 384
+	utmpUserProcess = 7
+)
+
+// readUtmpSessions lists USER_PROCESS entries of the glibc utmp file
+// (struct utmp on 64-bit Linux, 384 bytes per record).
+func readUtmpSessions() []models.UserSession {
+	var data []byte
+	for _, path := range utmpPaths {
+		if b, err := os.ReadFile(path); err == nil {
+			data = b
+			break
+		}
+	}
+
+	var sessions []models.UserSession
+	for off := 0; off+utmpRecordSize <= len(data); off += utmpRecordSize {
+		rec := data[off : off+utmpRecordSize]
+		if int16(binary.LittleEndian.Uint16(rec[0:])) != utmpUserProcess {
+			continue
+		}
+		sessions = append(sessions, models.UserSession{
+			PID:       int(int32(binary.LittleEndian.Uint32(rec[4:]))),
+			TTY:       cString(rec[8:40]),
+			User:      cString(rec[44:76]),
+			Host:      cString(rec[76:332]),
+			LoginTime: int64(binary.LittleEndian.Uint32(rec[340:]))*1000 + int64(binary.LittleEndian.Uint32(rec[344:]))/1000,
+		})
+	}
+	return sessions
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
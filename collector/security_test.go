@@ -0,0 +1,80 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/uptime-id/agent/models"
+)
+
+func securityRecord(app, msg string, ts int64) models.LogRecord {
+	return models.LogRecord{Source: "security", Timestamp: ts, Message: msg, Fields: map[string]string{"identifier": app}}
+}
+
+func TestCollectSecurity(t *testing.T) {
+	records := []models.LogRecord{
+		securityRecord("sshd", "Accepted publickey for alice from 10.0.0.5 port 50122 ssh2: ED25519 SHA256:abc", 1),
+		securityRecord("sshd-session", "Accepted publickey for alice from 10.0.0.5 port 50200 ssh2", 2),
+		securityRecord("sshd-session", "Failed password for invalid user admin from 203.0.113.9 port 4242 ssh2", 3),
+		securityRecord("sshd", "Failed password for root from 203.0.113.9 port 4243 ssh2", 4),
+		securityRecord("sshd", "pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 tty=ssh ruser= rhost=203.0.113.9  user=root", 4),
+		securityRecord("sudo", "    bob : TTY=pts/0 ; PWD=/home/bob ; USER=root ; COMMAND=/usr/bin/apt update", 5),
+		securityRecord("sudo", "    bob : TTY=pts/0 ; PWD=/home/bob ; USER=root ; COMMAND=/usr/bin/apt update", 6),
+		securityRecord("sudo", "    eve : 3 incorrect password attempts ; TTY=pts/1 ; PWD=/tmp ; USER=root ; COMMAND=/bin/sh", 7),
+		securityRecord("sudo", "pam_unix(sudo:auth): authentication failure; logname=eve uid=1001 euid=0 tty=/dev/pts/1 ruser=eve rhost=  user=eve", 7),
+		securityRecord("su", "pam_unix(su:auth): authentication failure; logname=eve uid=1001 euid=0 tty=pts/1 ruser=eve rhost=  user=root", 8),
+		securityRecord("sudo", "pam_unix(sudo:session): session opened for user root(uid=0) by bob(uid=1000)", 9),
+		{Source: "system", Message: "Accepted publickey for mallory from 10.9.9.9 port 1 ssh2"},
+	}
+	info := collectSecurity(records)
+	if info == nil {
+		t.Fatal("no security info")
+	}
+
+	if len(info.Logins) != 1 || info.Logins[0] != (models.AuthLogin{User: "alice", SourceIP: "10.0.0.5", Method: "publickey", Service: "sshd", Count: 2, LastSeen: 2}) {
+		t.Errorf("logins = %+v", info.Logins)
+	}
+
+	failures := map[string]models.AuthFailure{}
+	for _, f := range info.Failures {
+		failures[f.Service+" "+f.User] = f
+	}
+	want := map[string]models.AuthFailure{
+		"sshd admin": {User: "admin", SourceIP: "203.0.113.9", Service: "sshd", InvalidUser: true, Count: 1, LastSeen: 3},
+		"sshd root":  {User: "root", SourceIP: "203.0.113.9", Service: "sshd", Count: 1, LastSeen: 4},
+		"sudo eve":   {User: "eve", Service: "sudo", Count: 1, LastSeen: 7},
+		"su root":    {User: "root", Service: "su", Count: 1, LastSeen: 8},
+	}
+	if len(failures) != len(want) {
+		t.Errorf("failures = %+v", info.Failures)
+	}
+	for key, w := range want {
+		if failures[key] != w {
+			t.Errorf("failure %q = %+v, want %+v", key, failures[key], w)
+		}
+	}
+
+	sudo := map[string]models.SudoCommand{}
+	for _, s := range info.Sudo {
+		sudo[s.User] = s
+	}
+	if s := sudo["bob"]; s.Count != 2 || s.RunAs != "root" || s.Command != "/usr/bin/apt update" || s.TTY != "pts/0" || s.LastSeen != 6 {
+		t.Errorf("bob's sudo = %+v", s)
+	}
+	if s := sudo["eve"]; s.Denied != "3 incorrect password attempts" || s.Command != "/bin/sh" {
+		t.Errorf("eve's sudo = %+v", s)
+	}
+	if len(info.Sudo) != 2 {
+		t.Errorf("sudo = %+v", info.Sudo)
+	}
+}
+
+func TestJournalStreamSecurityApps(t *testing.T) {
+	for _, app := range []string{"sshd", "sshd-session", "sudo", "su"} {
+		if got := journalStream(map[string]string{"SYSLOG_IDENTIFIER": app}); got != "security" {
+			t.Errorf("%s: stream %q", app, got)
+		}
+	}
+	if got := journalStream(map[string]string{"SYSLOG_IDENTIFIER": "cron"}); got != "" {
+		t.Errorf("cron: stream %q", got)
+	}
+}
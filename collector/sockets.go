@@ -0,0 +1,135 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/uptime-id/agent/models"
+)
+
+// socketOwner is the process holding a listening socket, found once per
+// socket inode.
+type socketOwner struct {
+	pid         int32
+	name        string
+	containerID string
+}
+
+// socketInventory keeps the listeners of the previous collection, to report
+// the ones that appeared or went away, and the owners of listening sockets,
+// as finding them means going through the descriptors of every process.
+type socketInventory struct {
+	listeners map[string]models.ListeningSocket // nil until the first collection
+	owners    map[uint64]socketOwner
+}
+
+var sockets = &socketInventory{owners: map[uint64]socketOwner{}}
+
+// collect lists the listening sockets, one per address even when several
+// processes share it (SO_REUSEPORT), and raises an event for every listener
+// that opened or closed since the previous collection.
+func (s *socketInventory) collect(now time.Time) (*models.SocketInfo, []models.LogEvent) {
+	found, states, err := s.read()
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("Failed to read sockets: %v", err)
+		return nil, nil
+	}
+	listeners, events := s.update(found, now)
+	return &models.SocketInfo{Listeners: listeners, TCPStates: states}, events
+}
+
+// update folds the sockets found into one listener per address and diffs
+// them against the previous collection. Unix sockets are listed but raise no
+// events: per-session ones come and go with every login and desktop app.
+func (s *socketInventory) update(found []models.ListeningSocket, now time.Time) ([]models.ListeningSocket, []models.LogEvent) {
+	current := make(map[string]models.ListeningSocket, len(found))
+	for _, l := range found {
+		if l.Protocol == "unix" && l.Path == "" {
+			continue // unnamed, nothing to tell it apart by
+		}
+		key := listenerKey(l)
+		if prev, ok := current[key]; ok && (l.PID == 0 || (prev.PID != 0 && prev.PID < l.PID)) {
+			continue // keep the lowest PID, usually the parent of the workers
+		}
+		current[key] = l
+	}
+	listeners := make([]models.ListeningSocket, 0, len(current))
+	for _, l := range current {
+		listeners = append(listeners, l)
+	}
+	sort.Slice(listeners, func(i, j int) bool {
+		a, b := listeners[i], listeners[j]
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		return a.Address+a.Path < b.Address+b.Path
+	})
+
+	var events []models.LogEvent
+	if s.listeners != nil {
+		for _, l := range listeners {
+			if _, ok := s.listeners[listenerKey(l)]; !ok && l.Protocol != "unix" {
+				events = append(events, listenerEvent("listener-opened", l, now))
+			}
+		}
+		var closed []string
+		for key, l := range s.listeners {
+			if _, ok := current[key]; !ok && l.Protocol != "unix" {
+				closed = append(closed, key)
+			}
+		}
+		sort.Strings(closed)
+		for _, key := range closed {
+			events = append(events, listenerEvent("listener-closed", s.listeners[key], now))
+		}
+	}
+	s.listeners = current
+	return listeners, events
+}
+
+func listenerKey(l models.ListeningSocket) string {
+	return l.Protocol + " " + listenerAddress(l)
+}
+
+func listenerAddress(l models.ListeningSocket) string {
+	if l.Protocol == "unix" {
+		return l.Path
+	}
+	return net.JoinHostPort(l.Address, strconv.Itoa(l.Port))
+}
+
+func listenerEvent(rule string, l models.ListeningSocket, now time.Time) models.LogEvent {
+	fields := map[string]string{"protocol": l.Protocol, "address": listenerAddress(l)}
+	sample := fmt.Sprintf("%s %s no longer listening", l.Protocol, listenerAddress(l))
+	if rule == "listener-opened" {
+		sample = fmt.Sprintf("%s %s listening", l.Protocol, listenerAddress(l))
+	}
+	if l.Process != "" {
+		fields["process"] = l.Process
+		sample += fmt.Sprintf(" (%s, pid %d)", l.Process, l.PID)
+	}
+	if l.ContainerID != "" {
+		fields["container"] = l.ContainerID
+	}
+	return models.LogEvent{
+		Rule:      rule,
+		Severity:  "warning",
+		Count:     1,
+		FirstSeen: now.UnixMilli(),
+		LastSeen:  now.UnixMilli(),
+		Source:    "network",
+		Fields:    fields,
+		Sample:    sample,
+	}
+}
@@ -0,0 +1,220 @@
+package collector
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/uptime-id/agent/models"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// tcpStates names the states in include/net/tcp_states.h.
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+	"0C": "NEW_SYN_RECV",
+}
+
+const (
+	tcpListen       = "0A"
+	udpUnconnected  = "07"
+	unixAcceptConn  = 0x10000 // __SO_ACCEPTCON
+	unixUnconnected = "01"
+)
+
+// openNetFile opens a /proc/net file of the host's network namespace, the
+// one of PID 1, falling back to the agent's own.
+func openNetFile(name string) (*os.File, error) {
+	if f, err := os.Open(hostProc("1", "net", name)); err == nil {
+		return f, nil
+	}
+	return os.Open(hostProc("net", name))
+}
+
+// read parses /proc/net/{tcp,tcp6,udp,udp6,unix}, counting TCP sockets by
+// state on the way, and looks up the owners of the listening sockets.
+func (s *socketInventory) read() ([]models.ListeningSocket, map[string]int, error) {
+	var listeners []models.ListeningSocket
+	var inodes []uint64
+	states := map[string]int{}
+
+	for _, proto := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		err := scanNetFile(proto, func(fields []string) {
+			// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+			if len(fields) < 10 {
+				return
+			}
+			state := fields[3]
+			if proto == "tcp" || proto == "tcp6" {
+				if name, ok := tcpStates[state]; ok {
+					states[name]++
+				}
+				if state != tcpListen {
+					return
+				}
+			} else if state != udpUnconnected || !strings.HasSuffix(fields[2], ":0000") {
+				return
+			}
+			addr, port, ok := parseHexAddr(fields[1])
+			if !ok {
+				return
+			}
+			inode, _ := strconv.ParseUint(fields[9], 10, 64)
+			listeners = append(listeners, models.ListeningSocket{Protocol: proto, Address: addr, Port: port})
+			inodes = append(inodes, inode)
+		})
+		if err != nil && proto == "tcp" {
+			return nil, nil, err
+		}
+	}
+
+	scanNetFile("unix", func(fields []string) {
+		if l, inode, ok := parseUnixListener(fields); ok {
+			listeners = append(listeners, l)
+			inodes = append(inodes, inode)
+		}
+	})
+
+	s.resolveOwners(inodes)
+	for i := range listeners {
+		if o := s.owners[inodes[i]]; o.pid != 0 {
+			listeners[i].PID = int(o.pid)
+			listeners[i].Process = o.name
+			listeners[i].ContainerID = o.containerID
+		}
+	}
+	return listeners, states, nil
+}
+
+// scanNetFile calls fn with the fields of every line but the header.
+func scanNetFile(name string, fn func(fields []string)) error {
+	f, err := openNetFile(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Scan() // header
+	for sc.Scan() {
+		fn(strings.Fields(sc.Text()))
+	}
+	return sc.Err()
+}
+
+// parseUnixListener reads a /proc/net/unix line, "Num RefCount Protocol
+// Flags Type St Inode Path", of a listening socket. Unnamed sockets end
+// before the path and are left out.
+func parseUnixListener(fields []string) (models.ListeningSocket, uint64, bool) {
+	if len(fields) < 8 {
+		return models.ListeningSocket{}, 0, false
+	}
+	flags, _ := strconv.ParseUint(fields[3], 16, 32)
+	if flags&unixAcceptConn == 0 || fields[5] != unixUnconnected {
+		return models.ListeningSocket{}, 0, false
+	}
+	inode, _ := strconv.ParseUint(fields[6], 10, 64)
+	return models.ListeningSocket{Protocol: "unix", Path: strings.Join(fields[7:], " ")}, inode, true
+}
+
+// parseHexAddr decodes "0100007F:0050": the address is printed as 32-bit
+// words in host byte order, the port in hex.
+func parseHexAddr(s string) (string, int, bool) {
+	hexIP, hexPort, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", 0, false
+	}
+	raw, err := hex.DecodeString(hexIP)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return "", 0, false
+	}
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		binary.NativeEndian.PutUint32(ip[i:], binary.BigEndian.Uint32(raw[i:]))
+	}
+	port, err := strconv.ParseUint(hexPort, 16, 16)
+	if err != nil {
+		return "", 0, false
+	}
+	return ip.String(), int(port), true
+}
+
+// resolveOwners finds the processes holding socket inodes not seen before
+// by reading the descriptors of every process, and forgets the inodes that
+// are gone. Inodes without a visible owner are remembered too, so the scan
+// only runs again when a new listener shows up.
+func (s *socketInventory) resolveOwners(inodes []uint64) {
+	wanted := map[uint64]bool{}
+	current := make(map[uint64]bool, len(inodes))
+	for _, inode := range inodes {
+		current[inode] = true
+		if _, ok := s.owners[inode]; !ok && inode != 0 {
+			wanted[inode] = true
+		}
+	}
+	for inode := range s.owners {
+		if !current[inode] {
+			delete(s.owners, inode)
+		}
+	}
+	if len(wanted) == 0 {
+		return
+	}
+
+	pids, _ := process.Pids()
+	for _, pid := range pids {
+		if len(wanted) == 0 {
+			break
+		}
+		fdDir := hostProc(strconv.Itoa(int(pid)), "fd")
+		entries, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			link, err := os.Readlink(fdDir + "/" + e.Name())
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode, _ := strconv.ParseUint(strings.TrimSuffix(link[len("socket:["):], "]"), 10, 64)
+			if !wanted[inode] {
+				continue
+			}
+			s.owners[inode] = newSocketOwner(pid)
+			delete(wanted, inode)
+		}
+	}
+	for inode := range wanted {
+		s.owners[inode] = socketOwner{}
+	}
+}
+
+func newSocketOwner(pid int32) socketOwner {
+	o := socketOwner{pid: pid}
+	c := processes.byPID[pid]
+	if c == nil {
+		p := &process.Process{Pid: pid}
+		if stat, err := readProcStat(p); err == nil {
+			c = &cachedProcess{proc: p, stat: stat}
+		}
+	}
+	if c != nil {
+		o.name = c.name()
+	}
+	o.containerID, _ = parseCgroupPath(readProcCgroup(pid))
+	return o
+}
@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/uptime-id/agent/models"
+)
+
+func TestParseHexAddr(t *testing.T) {
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		t.Skip("samples are from a little-endian host")
+	}
+	tests := []struct {
+		in   string
+		addr string
+		port int
+		ok   bool
+	}{
+		{"0100007F:0050", "127.0.0.1", 80, true},
+		{"00000000:1F90", "0.0.0.0", 8080, true},
+		{"00000000000000000000000000000000:0016", "::", 22, true},
+		{"00000000000000000000000001000000:0277", "::1", 631, true},
+		{"0000000000000000FFFF00000100007F:0035", "127.0.0.1", 53, true},
+		{"0100007F", "", 0, false},
+		{"0100007:0050", "", 0, false},
+		{"0100007F:ZZ", "", 0, false},
+		{"0100007F:10000", "", 0, false},
+	}
+	for _, tt := range tests {
+		addr, port, ok := parseHexAddr(tt.in)
+		if addr != tt.addr || port != tt.port || ok != tt.ok {
+			t.Errorf("parseHexAddr(%q) = %q, %d, %v", tt.in, addr, port, ok)
+		}
+	}
+}
+
+func TestParseUnixListener(t *testing.T) {
+	tests := []struct {
+		line  string
+		want  models.ListeningSocket
+		inode uint64
+		ok    bool
+	}{
+		{"0000000000000000: 00000002 00000000 00010000 0001 01 18753 /run/systemd/notify", models.ListeningSocket{Protocol: "unix", Path: "/run/systemd/notify"}, 18753, true},
+		{"0000000000000000: 00000002 00000000 00010000 0001 01 2211 @/tmp/.X11-unix/X0", models.ListeningSocket{Protocol: "unix", Path: "@/tmp/.X11-unix/X0"}, 2211, true},
+		{"0000000000000000: 00000002 00000000 00010000 0001 01 31 /tmp/with space.sock", models.ListeningSocket{Protocol: "unix", Path: "/tmp/with space.sock"}, 31, true},
+		{"0000000000000000: 00000002 00000000 00010000 0001 01 20611", models.ListeningSocket{}, 0, false}, // unnamed
+		{"0000000000000000: 00000003 00000000 00000000 0001 03 21468 /run/systemd/journal/stdout", models.ListeningSocket{}, 0, false},
+		{"0000000000000000: 00000002 00000000 00000000 0002 01 19036 /run/systemd/journal/dev-log", models.ListeningSocket{}, 0, false},
+	}
+	for _, tt := range tests {
+		got, inode, ok := parseUnixListener(strings.Fields(tt.line))
+		if got != tt.want || inode != tt.inode || ok != tt.ok {
+			t.Errorf("parseUnixListener(%q) = %+v, %d, %v", tt.line, got, inode, ok)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package collector
+
+import (
+	"errors"
+
+	"github.com/uptime-id/agent/models"
+)
+
+// read is Linux only.
+func (s *socketInventory) read() ([]models.ListeningSocket, map[string]int, error) {
+	return nil, nil, errors.ErrUnsupported
+}
@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/uptime-id/agent/models"
+)
+
+func TestSocketInventoryUpdate(t *testing.T) {
+	s := &socketInventory{owners: map[uint64]socketOwner{}}
+	now := time.Unix(1700000000, 0)
+	nginx := models.ListeningSocket{Protocol: "tcp", Address: "0.0.0.0", Port: 80, PID: 10, Process: "nginx"}
+	worker := models.ListeningSocket{Protocol: "tcp", Address: "0.0.0.0", Port: 80, PID: 11, Process: "nginx"}
+	dns := models.ListeningSocket{Protocol: "udp6", Address: "::", Port: 53}
+	dbus := models.ListeningSocket{Protocol: "unix", Path: "/run/dbus/system_bus_socket", PID: 1}
+	unnamed := models.ListeningSocket{Protocol: "unix"}
+
+	listeners, events := s.update([]models.ListeningSocket{worker, dns, nginx, dbus, unnamed, unnamed}, now)
+	if fmt.Sprint(listeners) != fmt.Sprint([]models.ListeningSocket{nginx, dns, dbus}) {
+		t.Errorf("listeners = %+v", listeners)
+	}
+	if len(events) != 0 {
+		t.Errorf("first collection raised %+v", events)
+	}
+
+	ssh := models.ListeningSocket{Protocol: "tcp6", Address: "::1", Port: 22, PID: 5, Process: "sshd", ContainerID: "abc"}
+	session := models.ListeningSocket{Protocol: "unix", Path: "@/tmp/.X11-unix/X0"}
+	_, events = s.update([]models.ListeningSocket{nginx, ssh, session}, now)
+	if len(events) != 2 {
+		t.Fatalf("events = %+v", events)
+	}
+	opened, closed := events[0], events[1]
+	if opened.Rule != "listener-opened" || opened.Sample != "tcp6 [::1]:22 listening (sshd, pid 5)" ||
+		opened.Fields["container"] != "abc" || opened.Fields["address"] != "[::1]:22" {
+		t.Errorf("opened = %+v", opened)
+	}
+	if closed.Rule != "listener-closed" || closed.Sample != "udp6 [::]:53 no longer listening" || closed.LastSeen != now.UnixMilli() {
+		t.Errorf("closed = %+v", closed)
+	}
+}
@@ -0,0 +1,72 @@
+package collector
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// stateStore persists small pieces of collector state (journal cursors, file
+// offsets) as JSON files so restarts resume where they left off. Without a
+// writable directory state is only kept in memory.
+type stateStore struct {
+	dir      string
+	warnOnce sync.Once
+}
+
+func newStateStore(dir string) *stateStore {
+	return &stateStore{dir: dir}
+}
+
+func (s *stateStore) load(name string, v any) bool {
+	if s.dir == "" {
+		return false
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, name+".json"))
+	if err != nil {
+		return false
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		log.Printf("Ignoring corrupt state %s: %v", name, err)
+		return false
+	}
+	return true
+}
+
+func (s *stateStore) save(name string, v any) {
+	if s.dir == "" {
+		return
+	}
+	if err := s.write(name, v); err != nil {
+		s.warnOnce.Do(func() {
+			log.Printf("State dir %s not writable, positions won't survive restarts: %v", s.dir, err)
+		})
+	}
+}
+
+func (s *stateStore) write(name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, name+".json"))
+}
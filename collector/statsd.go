@@ -0,0 +1,354 @@
+package collector
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+)
+
+const (
+	maxStatsDPacketSize   = 64 * 1024
+	maxStatsDSeries       = 10000
+	maxStatsDSamples      = 10000   // per timer and interval, sampled beyond; count and sum stay exact
+	maxStatsDTotalSamples = 200000  // across timers, per interval
+	maxStatsDSetBytes     = 4 << 20 // set members across sets, per interval
+	maxStatsDGaugeIdle    = 10      // intervals a gauge is kept without updates
+)
+
+// statsdSeries accumulates one metric name and tag set over an interval.
+type statsdSeries struct {
+	metric  models.CustomMetric
+	updated bool
+	idle    int // intervals since a gauge was last updated
+
+	// counters and gauges
+	value float64
+
+	// timers, histograms and distributions
+	samples  []float64 // a uniform sample of the seen values
+	seen     int
+	count    float64
+	sum      float64
+	min, max float64
+
+	// sets
+	set map[string]struct{}
+}
+
+// statsdServer aggregates StatsD/DogStatsD samples between collections.
+type statsdServer struct {
+	percentiles []float64
+	listeners   []net.PacketConn
+
+	mu        sync.Mutex
+	series    map[string]*statsdSeries
+	lastFlush time.Time
+	rejected  int
+	samples   int // kept across all series this interval
+	setBytes  int
+	setFull   int // set members not kept
+}
+
+var statsdReceiver *statsdServer
+
+func startStatsDServer(c config.StatsDConfig) (*statsdServer, error) {
+	if c.UDP == "" && c.Socket == "" {
+		return nil, nil
+	}
+	s := &statsdServer{
+		percentiles: c.Percentiles,
+		series:      map[string]*statsdSeries{},
+		lastFlush:   time.Now(),
+	}
+	if err := s.listen(c); err != nil {
+		for _, l := range s.listeners {
+			l.Close()
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *statsdServer) listen(c config.StatsDConfig) error {
+	if c.UDP != "" {
+		pc, err := net.ListenPacket("udp", c.UDP)
+		if err != nil {
+			return fmt.Errorf("udp %s: %w", c.UDP, err)
+		}
+		s.listeners = append(s.listeners, pc)
+		log.Printf("StatsD: listening on udp %s", pc.LocalAddr())
+		go s.serve(pc)
+	}
+	if c.Socket != "" {
+		// A socket left behind by a previous run would make the bind fail.
+		if fi, err := os.Lstat(c.Socket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(c.Socket)
+		}
+		pc, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: c.Socket, Net: "unixgram"})
+		if err != nil {
+			return fmt.Errorf("socket %s: %w", c.Socket, err)
+		}
+		s.listeners = append(s.listeners, pc)
+		// Applications usually run as other users.
+		if err := os.Chmod(c.Socket, 0o666); err != nil {
+			log.Printf("StatsD: chmod %s: %v", c.Socket, err)
+		}
+		log.Printf("StatsD: listening on unixgram %s", c.Socket)
+		go s.serve(pc)
+	}
+	return nil
+}
+
+func (s *statsdServer) serve(pc net.PacketConn) {
+	buf := make([]byte, maxStatsDPacketSize)
+	for {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		s.mu.Lock()
+		for _, line := range bytes.Split(buf[:n], []byte{'\n'}) {
+			s.handleLine(string(bytes.TrimSpace(line)))
+		}
+		s.mu.Unlock()
+	}
+}
+
+// handleLine parses "name:value[:value...]|type[|@rate][|#tag:v,...]" and
+// folds it into its series. DogStatsD events and service checks are ignored.
+func (s *statsdServer) handleLine(line string) {
+	if line == "" || strings.HasPrefix(line, "_e{") || strings.HasPrefix(line, "_sc|") {
+		return
+	}
+	parts := strings.Split(line, "|")
+	if len(parts) < 2 {
+		return
+	}
+	name, values, ok := strings.Cut(parts[0], ":")
+	if !ok || name == "" {
+		return
+	}
+
+	typ := parts[1]
+	rate := 1.0
+	var tags []string
+	for _, p := range parts[2:] {
+		switch {
+		case strings.HasPrefix(p, "@"):
+			if r, err := strconv.ParseFloat(p[1:], 64); err == nil && r > 0 && r <= 1 {
+				rate = r
+			}
+		case strings.HasPrefix(p, "#"):
+			tags = strings.Split(p[1:], ",")
+		}
+	}
+
+	var metricType, unit string
+	switch typ {
+	case "c":
+		metricType = "counter"
+	case "g":
+		metricType = "gauge"
+	case "ms":
+		metricType, unit = "summary", "ms"
+	case "h", "d":
+		metricType = "summary"
+	case "s":
+		metricType = "set"
+	default:
+		return
+	}
+
+	// DogStatsD packs several values of one metric as "name:1:2:3|h". The
+	// series is only created once a value parses.
+	var series *statsdSeries
+	for _, raw := range strings.Split(values, ":") {
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if metricType != "set" && (err != nil || math.IsNaN(v) || math.IsInf(v, 0)) {
+			continue
+		}
+		if series == nil {
+			if series = s.lookup(name, metricType, unit, tags); series == nil {
+				return
+			}
+		}
+		series.updated = true
+
+		switch metricType {
+		case "set":
+			if series.set == nil {
+				series.set = map[string]struct{}{}
+			}
+			if _, ok := series.set[raw]; !ok {
+				if s.setBytes+len(raw) > maxStatsDSetBytes {
+					s.setFull++
+					continue
+				}
+				s.setBytes += len(raw)
+				series.set[raw] = struct{}{}
+			}
+		case "counter":
+			series.value += v / rate
+		case "gauge":
+			// A signed gauge value adjusts the previous one.
+			if raw[0] == '+' || raw[0] == '-' {
+				series.value += v
+			} else {
+				series.value = v
+			}
+		case "summary":
+			if series.count == 0 || v < series.min {
+				series.min = v
+			}
+			if series.count == 0 || v > series.max {
+				series.max = v
+			}
+			series.count += 1 / rate
+			series.sum += v / rate
+			s.sample(series, v)
+		}
+	}
+}
+
+// sample keeps v in the series' reservoir: every value is kept while the
+// series and the interval have room, then it replaces a kept one with the
+// probability that leaves the kept values a uniform sample of all seen.
+func (s *statsdServer) sample(series *statsdSeries, v float64) {
+	series.seen++
+	if len(series.samples) < maxStatsDSamples && s.samples < maxStatsDTotalSamples {
+		series.samples = append(series.samples, v)
+		s.samples++
+		return
+	}
+	if i := rand.IntN(series.seen); i < len(series.samples) {
+		series.samples[i] = v
+	}
+}
+
+func (s *statsdServer) lookup(name, metricType, unit string, tags []string) *statsdSeries {
+	var labels map[string]string
+	for _, tag := range tags {
+		if tag == "" {
+			continue
+		}
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		k, v, _ := strings.Cut(tag, ":")
+		labels[k] = v
+	}
+	m := models.CustomMetric{Name: name, Type: metricType, Unit: unit, Labels: labels, Source: "statsd"}
+	key := customMetricKey(m)
+	if series, ok := s.series[key]; ok {
+		return series
+	}
+	if len(s.series) >= maxStatsDSeries {
+		s.rejected++
+		return nil
+	}
+	series := &statsdSeries{metric: m}
+	s.series[key] = series
+	return series
+}
+
+// drain returns the interval's aggregates and resets them. Gauges keep their
+// value so later deltas apply to it, but are only reported when updated and
+// forgotten after maxStatsDGaugeIdle intervals without updates.
+func (s *statsdServer) drain(now time.Time) []models.CustomMetric {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	interval := now.Sub(s.lastFlush).Seconds()
+	s.lastFlush = now
+	if s.rejected > 0 {
+		log.Printf("StatsD: series limit reached, dropped %d samples", s.rejected)
+		s.rejected = 0
+	}
+	if s.setFull > 0 {
+		log.Printf("StatsD: set size limit reached, %d members not counted", s.setFull)
+		s.setFull = 0
+	}
+	// Only gauges outlive the drain, and they keep no samples or members.
+	s.samples, s.setBytes = 0, 0
+
+	var result []models.CustomMetric
+	for key, series := range s.series {
+		if !series.updated {
+			if series.idle++; series.metric.Type != "gauge" || series.idle >= maxStatsDGaugeIdle {
+				delete(s.series, key)
+			}
+			continue
+		}
+		m := series.metric
+		m.Timestamp = now.UnixMilli()
+		switch m.Type {
+		case "counter":
+			m.Value = series.value
+			if interval > 0 {
+				m.Rate = series.value / interval
+			}
+		case "gauge":
+			m.Value = series.value
+		case "summary":
+			if series.count == 0 {
+				delete(s.series, key)
+				continue
+			}
+			m.Count = uint64(math.Round(series.count))
+			m.Sum = series.sum
+			m.Value = series.sum / series.count
+			m.Quantiles = s.quantiles(series)
+		case "set":
+			m.Value = float64(len(series.set))
+		}
+		if customMetricFinite(m) {
+			result = append(result, m)
+		}
+
+		if m.Type == "gauge" {
+			series.updated, series.idle = false, 0
+		} else {
+			delete(s.series, key)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// quantiles uses the nearest-rank method over the kept samples; 0 and 1
+// carry the exact minimum and maximum.
+func (s *statsdServer) quantiles(series *statsdSeries) map[string]float64 {
+	sort.Float64s(series.samples)
+	q := map[string]float64{"0": series.min, "1": series.max}
+	n := len(series.samples)
+	for _, p := range s.percentiles {
+		if n == 0 {
+			break
+		}
+		rank := int(math.Ceil(p/100*float64(n))) - 1
+		q[strconv.FormatFloat(p/100, 'g', -1, 64)] = series.samples[max(rank, 0)]
+	}
+	return q
+}
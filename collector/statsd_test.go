@@ -0,0 +1,190 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/uptime-id/agent/models"
+)
+
+func newTestStatsDServer(start time.Time) *statsdServer {
+	return &statsdServer{percentiles: []float64{50, 90}, series: map[string]*statsdSeries{}, lastFlush: start}
+}
+
+func statsdByName(metrics []models.CustomMetric) map[string]models.CustomMetric {
+	byName := map[string]models.CustomMetric{}
+	for _, m := range metrics {
+		byName[m.Name] = m
+	}
+	return byName
+}
+
+func TestStatsDLines(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	s := newTestStatsDServer(start)
+	for _, line := range []string{
+		"hits:1|c",
+		"hits:2|c|@0.5",
+		"hits:x|c",
+		"temp:20|g",
+		"temp:+2.5|g",
+		"temp:-1|g",
+		"lat:10:20:30|ms|#route:/a,env:prod",
+		"lat:40|ms|#env:prod,route:/a",
+		"size:100|h|@0.5",
+		"users:alice|s",
+		"users:bob|s",
+		"users:alice|s",
+		"bad",
+		"noval|c",
+		":1|c",
+		"odd:1|zz",
+		"_e{5,4}:title|text",
+		"_sc|check|0",
+	} {
+		s.handleLine(line)
+	}
+
+	got := statsdByName(s.drain(start.Add(10 * time.Second)))
+	if len(got) != 5 {
+		t.Fatalf("drained %d series: %+v", len(got), got)
+	}
+	if m := got["hits"]; m.Type != "counter" || m.Value != 5 || m.Rate != 0.5 {
+		t.Errorf("hits = %+v", m)
+	}
+	if m := got["temp"]; m.Type != "gauge" || m.Value != 21.5 {
+		t.Errorf("temp = %+v", m)
+	}
+	lat := got["lat"]
+	if lat.Type != "summary" || lat.Unit != "ms" || lat.Count != 4 || lat.Sum != 100 || lat.Value != 25 ||
+		lat.Labels["route"] != "/a" || lat.Labels["env"] != "prod" {
+		t.Errorf("lat = %+v", lat)
+	}
+	wantQ := map[string]float64{"0": 10, "0.5": 20, "0.9": 40, "1": 40}
+	if fmt.Sprint(lat.Quantiles) != fmt.Sprint(wantQ) {
+		t.Errorf("lat quantiles = %v, want %v", lat.Quantiles, wantQ)
+	}
+	if m := got["size"]; m.Count != 2 || m.Sum != 200 || m.Value != 100 {
+		t.Errorf("size = %+v", m)
+	}
+	if m := got["users"]; m.Type != "set" || m.Value != 2 {
+		t.Errorf("users = %+v", m)
+	}
+}
+
+func TestStatsDInvalidSamples(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	s := newTestStatsDServer(start)
+	for _, line := range []string{"lat:NaN|ms", "lat:nope:Inf|ms", "g:NaN|g", "c:|c", "set:|s"} {
+		s.handleLine(line)
+	}
+	if len(s.series) != 0 {
+		t.Errorf("invalid samples created %d series", len(s.series))
+	}
+	s.handleLine("lat:NaN:5|ms")
+	metrics := s.drain(start.Add(time.Second))
+	if len(metrics) != 1 || metrics[0].Count != 1 || metrics[0].Value != 5 {
+		t.Errorf("metrics = %+v", metrics)
+	}
+	if _, err := json.Marshal(metrics); err != nil {
+		t.Errorf("metrics don't encode: %v", err)
+	}
+}
+
+func TestStatsDGaugeExpiry(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := newTestStatsDServer(now)
+	s.handleLine("queue:7|g")
+	s.handleLine("hits:1|c")
+
+	tick := func() []models.CustomMetric {
+		now = now.Add(10 * time.Second)
+		return s.drain(now)
+	}
+	if got := tick(); len(got) != 2 {
+		t.Fatalf("first drain = %+v", got)
+	}
+	// Not reported without updates, but deltas still apply to the kept value.
+	if got := tick(); len(got) != 0 {
+		t.Errorf("idle drain = %+v", got)
+	}
+	s.handleLine("queue:+1|g")
+	if got := tick(); len(got) != 1 || got[0].Value != 8 {
+		t.Errorf("after delta = %+v", got)
+	}
+
+	for range maxStatsDGaugeIdle {
+		tick()
+	}
+	if len(s.series) != 0 {
+		t.Errorf("%d series left after %d idle intervals", len(s.series), maxStatsDGaugeIdle)
+	}
+	s.handleLine("queue:+1|g")
+	if got := tick(); len(got) != 1 || got[0].Value != 1 {
+		t.Errorf("expired gauge = %+v, want a fresh one", got)
+	}
+}
+
+func TestStatsDSeriesLimit(t *testing.T) {
+	s := newTestStatsDServer(time.Now())
+	for i := range maxStatsDSeries + 5 {
+		s.handleLine(fmt.Sprintf("m%d:1|g", i))
+	}
+	if len(s.series) != maxStatsDSeries || s.rejected != 5 {
+		t.Errorf("%d series, %d rejected", len(s.series), s.rejected)
+	}
+}
+
+func TestStatsDSampleBudget(t *testing.T) {
+	s := newTestStatsDServer(time.Now())
+	// More values than a timer keeps: the kept ones are a uniform sample,
+	// so the median still lands near the middle.
+	for i := range 5 * maxStatsDSamples {
+		s.handleLine(fmt.Sprintf("req:%d|ms", i))
+	}
+	series := s.series[customMetricKey(models.CustomMetric{Name: "req", Type: "summary", Unit: "ms", Source: "statsd"})]
+	if len(series.samples) != maxStatsDSamples || series.seen != 5*maxStatsDSamples {
+		t.Fatalf("%d samples kept of %d", len(series.samples), series.seen)
+	}
+	// Across timers the samples share one budget.
+	for i := range maxStatsDTotalSamples / maxStatsDSamples {
+		for v := range maxStatsDSamples {
+			s.handleLine(fmt.Sprintf("t%d:%d|h", i, v))
+		}
+	}
+	if s.samples != maxStatsDTotalSamples {
+		t.Errorf("%d samples kept in total", s.samples)
+	}
+
+	m := statsdByName(s.drain(time.Now()))
+	if req := m["req"]; req.Count != 5*maxStatsDSamples || req.Quantiles["0"] != 0 || req.Quantiles["1"] != 5*maxStatsDSamples-1 ||
+		req.Quantiles["0.5"] < 2.2*maxStatsDSamples || req.Quantiles["0.5"] > 2.8*maxStatsDSamples {
+		t.Errorf("req = %+v", req)
+	}
+	last := fmt.Sprintf("t%d", maxStatsDTotalSamples/maxStatsDSamples-1)
+	if q := m[last].Quantiles; m[last].Count != maxStatsDSamples || len(q) != 2 {
+		t.Errorf("%s over budget = %+v", last, m[last])
+	}
+	if s.samples != 0 {
+		t.Errorf("%d samples counted after the drain", s.samples)
+	}
+}
+
+func TestStatsDSetBudget(t *testing.T) {
+	s := newTestStatsDServer(time.Now())
+	for i := range maxStatsDSetBytes/1024 + 10 {
+		s.handleLine(fmt.Sprintf("users:%01024d|s", i)) // 1KB members
+	}
+	s.handleLine(fmt.Sprintf("users:%01024d|s", 1)) // already counted
+	if s.setFull != 10 {
+		t.Errorf("%d members over the limit", s.setFull)
+	}
+	if m := statsdByName(s.drain(time.Now())); m["users"].Value != maxStatsDSetBytes/1024 {
+		t.Errorf("users = %v", m["users"].Value)
+	}
+	if s.setBytes != 0 || s.setFull != 0 {
+		t.Errorf("set budget not reset: %d bytes, %d over", s.setBytes, s.setFull)
+	}
+}
@@ -0,0 +1,321 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+)
+
+const (
+	maxSyslogMessageSize = 64 * 1024
+	maxSyslogConns       = 256
+	syslogIdleTimeout    = 10 * time.Minute
+)
+
+// syslogServer receives syslog from network devices and buffers the parsed
+// records until the next collection, up to maxBuffered bytes of them.
+// Drained records are held as inflight until their delivery is committed,
+// and go back to the front of the buffer if it fails.
+type syslogServer struct {
+	source      string
+	parser      *logParser
+	conns       chan struct{}
+	listeners   []io.Closer
+	maxBuffered int64
+
+	mu              sync.Mutex
+	records         []models.LogRecord
+	buffered        int64 // bytes, as counted by LogRecord.Size
+	dropped         int
+	inflight        []models.LogRecord
+	inflightDropped int
+}
+
+var (
+	syslogReceiver *syslogServer
+	syslogPRI      = regexp.MustCompile(`^<(\d{1,3})>`)
+)
+
+// startSyslogServer listens on the configured addresses, buffering up to
+// maxBuffered bytes of records between collections.
+func startSyslogServer(c config.SyslogConfig, maxBuffered int) (*syslogServer, error) {
+	if c.UDP == "" && c.TCP == "" && c.TLS == "" {
+		return nil, nil
+	}
+	s := &syslogServer{
+		source:      c.Source,
+		parser:      &logParser{format: "syslog"},
+		conns:       make(chan struct{}, maxSyslogConns),
+		maxBuffered: int64(maxBuffered),
+	}
+	if err := s.listen(c); err != nil {
+		for _, l := range s.listeners {
+			l.Close()
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *syslogServer) listen(c config.SyslogConfig) error {
+	if c.UDP != "" {
+		pc, err := net.ListenPacket("udp", c.UDP)
+		if err != nil {
+			return fmt.Errorf("udp %s: %w", c.UDP, err)
+		}
+		s.listeners = append(s.listeners, pc)
+		log.Printf("Syslog: listening on udp %s", pc.LocalAddr())
+		go s.serveUDP(pc)
+	}
+	if c.TCP != "" {
+		ln, err := net.Listen("tcp", c.TCP)
+		if err != nil {
+			return fmt.Errorf("tcp %s: %w", c.TCP, err)
+		}
+		s.listeners = append(s.listeners, ln)
+		log.Printf("Syslog: listening on tcp %s", ln.Addr())
+		go s.serveStream(ln)
+	}
+	if c.TLS != "" {
+		tlsConfig, err := syslogTLSConfig(c)
+		if err != nil {
+			return err
+		}
+		ln, err := tls.Listen("tcp", c.TLS, tlsConfig)
+		if err != nil {
+			return fmt.Errorf("tls %s: %w", c.TLS, err)
+		}
+		s.listeners = append(s.listeners, ln)
+		log.Printf("Syslog: listening on tls %s", ln.Addr())
+		go s.serveStream(ln)
+	}
+	return nil
+}
+
+func syslogTLSConfig(c config.SyslogConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("tls certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("client CA %s: no certificates found", c.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+func (s *syslogServer) serveUDP(pc net.PacketConn) {
+	buf := make([]byte, maxSyslogMessageSize)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		// Some senders pack several newline separated messages per datagram.
+		for _, msg := range bytes.Split(buf[:n], []byte{'\n'}) {
+			s.receive(msg, addr)
+		}
+	}
+}
+
+func (s *syslogServer) serveStream(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		select {
+		case s.conns <- struct{}{}:
+			go func() {
+				defer func() { <-s.conns }()
+				s.handleConn(conn)
+			}()
+		default:
+			log.Printf("Syslog: too many connections, rejecting %s", conn.RemoteAddr())
+			conn.Close()
+		}
+	}
+}
+
+// handleConn reads RFC 6587 framed messages: octet counting ("<len> <msg>")
+// when a frame starts with a digit, newline terminated otherwise.
+func (s *syslogServer) handleConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReaderSize(conn, maxSyslogMessageSize)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(syslogIdleTimeout))
+		msg, err := readSyslogFrame(r)
+		if len(msg) > 0 {
+			s.receive(msg, conn.RemoteAddr())
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				var ne net.Error
+				if !errors.As(err, &ne) || !ne.Timeout() {
+					log.Printf("Syslog %s: %v", conn.RemoteAddr(), err)
+				}
+			}
+			return
+		}
+	}
+}
+
+func readSyslogFrame(r *bufio.Reader) ([]byte, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] >= '1' && first[0] <= '9' {
+		prefix, err := r.ReadString(' ')
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(prefix, " "))
+		if err != nil || n <= 0 || n > maxSyslogMessageSize {
+			return nil, fmt.Errorf("invalid octet count %q", prefix)
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}
+
+	line, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		// Oversized message: keep the first part and skip to the newline.
+		msg := append([]byte(nil), line...)
+		for errors.Is(err, bufio.ErrBufferFull) {
+			_, err = r.ReadSlice('\n')
+		}
+		return msg, err
+	}
+	return append([]byte(nil), line...), err
+}
+
+func (s *syslogServer) receive(msg []byte, from net.Addr) {
+	text := strings.TrimRight(strings.ToValidUTF8(string(msg), "\uFFFD"), "\r\n\x00")
+	if text == "" {
+		return
+	}
+
+	sender := from.String()
+	if host, _, err := net.SplitHostPort(sender); err == nil {
+		sender = host
+	}
+	rec := models.LogRecord{
+		Timestamp: time.Now().UnixMilli(),
+		Source:    s.source,
+		Input:     "syslog",
+		Message:   text,
+	}
+	s.parser.apply(&rec)
+	if rec.ParseError {
+		// Devices with nonstandard headers still send a usable priority.
+		if m := syslogPRI.FindStringSubmatch(rec.Message); m != nil {
+			fields := map[string]string{}
+			syslogPriority(m[1], fields)
+			rec.Severity, rec.Fields = fields["severity"], map[string]string{"facility": fields["facility"]}
+			rec.Message = strings.TrimLeft(rec.Message[len(m[0]):], " :")
+		}
+	}
+	if rec.Fields == nil {
+		rec.Fields = map[string]string{}
+	}
+	rec.Fields["sender"] = sender
+	if rec.Host == "" {
+		rec.Host = sender
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buffer(rec)
+}
+
+// buffer queues rec unless the buffer is full, counting it as dropped then.
+// Called with mu held.
+func (s *syslogServer) buffer(rec models.LogRecord) {
+	size := int64(rec.Size())
+	if s.buffered+size > s.maxBuffered {
+		s.dropped++
+		return
+	}
+	s.records = append(s.records, rec)
+	s.buffered += size
+}
+
+// drain returns the records received since the last call and how many were
+// dropped because the buffer was full. They stay inflight until commit or
+// rewind.
+func (s *syslogServer) drain() ([]models.LogRecord, int) {
+	if s == nil {
+		return nil, 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records, dropped := s.records, s.dropped
+	s.inflight = append(s.inflight, records...)
+	s.inflightDropped += dropped
+	s.records, s.buffered, s.dropped = nil, 0, 0
+	return records, dropped
+}
+
+// commit forgets the drained records once they have been delivered.
+func (s *syslogServer) commit() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inflight, s.inflightDropped = nil, 0
+}
+
+// rewind puts the drained records back in front of those received since,
+// so they are sent again. What no longer fits in the buffer is dropped,
+// newest first.
+func (s *syslogServer) rewind() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := append(s.inflight, s.records...)
+	s.dropped += s.inflightDropped
+	s.inflight, s.inflightDropped = nil, 0
+	s.records, s.buffered = nil, 0
+	for _, rec := range records {
+		s.buffer(rec)
+	}
+}
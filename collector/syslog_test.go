@@ -0,0 +1,167 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+)
+
+func TestReadSyslogFrame(t *testing.T) {
+	long := strings.Repeat("x", maxSyslogMessageSize+100)
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+		err   string // error after the frames, "" for io.EOF
+	}{
+		{"newline", "<13>a\n<13>b\r\n", []string{"<13>a\n", "<13>b\r\n"}, ""},
+		{"octet counting", "6 <13>a\n4 <1>b", []string{"<13>a\n", "<1>b"}, ""},
+		{"octet counting with newlines inside", "9 <13>a\nb\nc", []string{"<13>a\nb\nc"}, ""},
+		{"mixed", "5 <1>ab<13>c\n", []string{"<1>ab", "<13>c\n"}, ""},
+		{"unterminated", "<13>tail", []string{"<13>tail"}, ""},
+		{"oversized line", long + "\n<13>next\n", []string{long[:maxSyslogMessageSize], "<13>next\n"}, ""},
+		{"bad octet count", "12x <13>a", nil, "invalid octet count"},
+		{"octet count too large", "99999999 x", nil, "invalid octet count"},
+		{"short frame", "10 <13>a", nil, "unexpected EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReaderSize(strings.NewReader(tt.input), maxSyslogMessageSize)
+			var got []string
+			var err error
+			for err == nil {
+				var msg []byte
+				msg, err = readSyslogFrame(r)
+				if len(msg) > 0 {
+					got = append(got, string(msg))
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("frames = %q, want %q", got, tt.want)
+			}
+			if tt.err == "" && err != io.EOF || tt.err != "" && !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSyslogReceive(t *testing.T) {
+	s := &syslogServer{source: "network", parser: &logParser{format: "syslog"}, maxBuffered: 1 << 20}
+	from := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 7), Port: 514}
+	s.receive([]byte("<34>1 2024-03-05T14:07:09Z router sshd - - - denied\n"), from)
+	s.receive([]byte("<187>%LINK-3-UPDOWN: Interface Gi0/1, changed state to down\x00"), from)
+	s.receive([]byte("plain text"), from)
+	s.receive([]byte("\r\n"), from)
+
+	records, dropped := s.drain()
+	if len(records) != 3 || dropped != 0 {
+		t.Fatalf("drained %d records, %d dropped", len(records), dropped)
+	}
+	want := []models.LogRecord{
+		{Message: "denied", Severity: "critical", Host: "router"},
+		{Message: "%LINK-3-UPDOWN: Interface Gi0/1, changed state to down", Severity: "error", Host: "192.0.2.7", ParseError: true},
+		{Message: "plain text", Host: "192.0.2.7", ParseError: true},
+	}
+	for i, rec := range records {
+		w := want[i]
+		if rec.Message != w.Message || rec.Severity != w.Severity || rec.Host != w.Host || rec.ParseError != w.ParseError ||
+			rec.Source != "network" || rec.Input != "syslog" || rec.Fields["sender"] != "192.0.2.7" {
+			t.Errorf("record %d = %+v", i, rec)
+		}
+	}
+	if records[1].Fields["facility"] != "23" {
+		t.Errorf("facility = %q", records[1].Fields["facility"])
+	}
+
+	if records, _ := s.drain(); len(records) != 0 {
+		t.Errorf("second drain returned %d records", len(records))
+	}
+}
+
+func TestSyslogBuffer(t *testing.T) {
+	s := &syslogServer{source: "network", parser: &logParser{format: "syslog"}, maxBuffered: 1 << 20}
+	from := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 7), Port: 514}
+	messages := func(records []models.LogRecord) string {
+		var m []string
+		for _, r := range records {
+			m = append(m, r.Message)
+		}
+		return strings.Join(m, ",")
+	}
+	s.receive([]byte("x"), from)
+	records, _ := s.drain()
+	s.commit()
+	size := int64(records[0].Size())
+
+	// The buffer is limited by size, not count.
+	s.maxBuffered = 3 * size
+	for _, msg := range []string{"a", "b", "c", "d", "e"} {
+		s.receive([]byte(msg), from)
+	}
+	if records, dropped := s.drain(); messages(records) != "a,b,c" || dropped != 2 {
+		t.Errorf("full buffer: %q, %d dropped", messages(records), dropped)
+	}
+
+	// The send failed: the drained records come back first, and what no
+	// longer fits is dropped.
+	s.receive([]byte("f"), from)
+	s.receive([]byte("g"), from)
+	s.rewind()
+	if records, dropped := s.drain(); messages(records) != "a,b,c" || dropped != 4 {
+		t.Errorf("after rewind: %q, %d dropped", messages(records), dropped)
+	}
+	s.commit()
+	s.rewind()
+	if records, dropped := s.drain(); len(records) != 0 || dropped != 0 {
+		t.Errorf("after commit: %q, %d dropped", messages(records), dropped)
+	}
+}
+
+func TestSyslogServer(t *testing.T) {
+	s, err := startSyslogServer(config.SyslogConfig{UDP: "127.0.0.1:0", TCP: "127.0.0.1:0", Source: "network"}, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, l := range s.listeners {
+			l.Close()
+		}
+	}()
+	udpAddr := s.listeners[0].(net.PacketConn).LocalAddr().String()
+	tcpAddr := s.listeners[1].(net.Listener).Addr().String()
+
+	udp, err := net.Dial("udp", udpAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	fmt.Fprint(udp, "<13>Mar  5 14:07:09 host app: one\n<13>Mar  5 14:07:10 host app: two")
+
+	tcp, err := net.Dial("tcp", tcpAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprint(tcp, "<13>Mar  5 14:07:11 host app: three\n26 <13>Mar  5 14:07:12 h a: 4")
+	tcp.Close()
+
+	var messages []string
+	for deadline := time.Now().Add(5 * time.Second); len(messages) < 4 && time.Now().Before(deadline); {
+		records, _ := s.drain()
+		for _, rec := range records {
+			messages = append(messages, rec.Message)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := strings.Join(messages, ","); len(messages) != 4 ||
+		!strings.Contains(got, "one,two") || !strings.Contains(got, "three") || !strings.Contains(got, "4") {
+		t.Errorf("received %q", got)
+	}
+}
@@ -0,0 +1,463 @@
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	tailStateName       = "tail"
+	tailBackfillLines   = 50
+	tailFingerprintSize = 1024
+	maxTailBytesPerTick = 512 * 1024
+	maxTailLineSize     = 64 * 1024
+	maxTailCatchupBytes = 4 * 1024 * 1024
+	tailForgetAfter     = 24 * time.Hour
+)
+
+// Rotated siblings of a log file: app.log.1, app.log.2.gz, app.log-20240101.
+var (
+	rotatedSuffix = regexp.MustCompile(`^[.-]\d+(\.gz)?$`)
+	rotatedName   = regexp.MustCompile(`(\.gz|[.-]\d+)$`)
+)
+
+type tailSource struct {
+	Source    string
+	Pattern   string
+	Parser    *logParser
+	Multiline *multilineRule
+}
+
+type tailLine struct {
+	Source string
+	Path   string
+	Text   string
+	Parser *logParser
+
+	Multiline *multilineRule
+}
+
+// tailPosition identifies a file by device/inode and a fingerprint of its
+// first bytes, so renames and copytruncate rotation can be told apart from
+// appends.
+type tailPosition struct {
+	Dev             uint64 `json:"dev"`
+	Inode           uint64 `json:"inode"`
+	Offset          int64  `json:"offset"`
+	Fingerprint     string `json:"fingerprint"`
+	FingerprintSize int    `json:"fingerprintSize"`
+	LastSeen        int64  `json:"lastSeen"` // unix s
+}
+
+// fileTailer reads ahead of what has been delivered: positions is where
+// the next poll starts, committed what was last acknowledged and persisted.
+type fileTailer struct {
+	sources   []tailSource
+	state     *stateStore
+	positions map[string]*tailPosition
+	committed map[string]tailPosition
+	firstPoll bool
+	next      int // file to read first, rotated so all get a share of the budget
+}
+
+func newFileTailer(sources []tailSource, state *stateStore) *fileTailer {
+	t := &fileTailer{
+		sources:   sources,
+		state:     state,
+		positions: map[string]*tailPosition{},
+		committed: map[string]tailPosition{},
+		firstPoll: true,
+	}
+	state.load(tailStateName, &t.positions)
+	for path, pos := range t.positions {
+		t.committed[path] = *pos
+	}
+	return t
+}
+
+type tailFile struct {
+	src  tailSource
+	path string
+}
+
+// poll returns the complete lines appended to the tailed files since the
+// previous poll, including the unread remainder of files rotated away. At
+// most about budget bytes are read, shared between the files.
+func (t *fileTailer) poll(budget int64) []tailLine {
+	var lines []tailLine
+	now := time.Now()
+	seen := map[string]bool{}
+
+	var files []tailFile
+	for _, src := range t.sources {
+		matches, err := filepath.Glob(src.Pattern)
+		if err != nil {
+			continue
+		}
+		for _, path := range matches {
+			// Rotated copies only matter for globs; a configured path is
+			// tailed whatever its name ends with.
+			if seen[path] || (path != src.Pattern && isRotatedFile(path)) {
+				continue
+			}
+			seen[path] = true
+			files = append(files, tailFile{src: src, path: path})
+		}
+	}
+
+	if len(files) > 0 {
+		share := min(max(budget/int64(len(files)), maxTailLineSize), maxTailBytesPerTick)
+		start := t.next % len(files)
+		for i := range files {
+			if budget <= 0 {
+				// Out of budget: start with this file next time.
+				t.next = (start + i) % len(files)
+				break
+			}
+			f := files[(start+i)%len(files)]
+			read, n := t.pollFile(f.src, f.path, now, share)
+			lines = append(lines, read...)
+			budget -= n
+		}
+	}
+
+	// Keep positions of vanished files for a while: mid-rotation the path
+	// may briefly not exist.
+	for path, pos := range t.positions {
+		if !seen[path] && now.Sub(time.Unix(pos.LastSeen, 0)) > tailForgetAfter {
+			delete(t.positions, path)
+		}
+	}
+
+	t.firstPoll = false
+	return lines
+}
+
+// commit persists the positions of everything read so far, once it has
+// been delivered.
+func (t *fileTailer) commit() {
+	clear(t.committed)
+	for path, pos := range t.positions {
+		t.committed[path] = *pos
+	}
+	if len(t.sources) > 0 {
+		t.state.save(tailStateName, t.positions)
+	}
+}
+
+// rewind goes back to the committed positions, so lines whose delivery
+// failed are read again.
+func (t *fileTailer) rewind() {
+	clear(t.positions)
+	for path, pos := range t.committed {
+		t.positions[path] = &pos
+	}
+}
+
+// pollFile reads up to limit new bytes of path, rotated remainders
+// included, returning the lines and the number of bytes read.
+func (t *fileTailer) pollFile(src tailSource, path string, now time.Time, limit int64) ([]tailLine, int64) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return nil, 0
+	}
+	dev, ino := fileIdentity(fi)
+
+	var lines []tailLine
+	var read int64
+	pos := t.positions[path]
+	switch {
+	case pos == nil:
+		pos = &tailPosition{Dev: dev, Inode: ino}
+		// Without saved state only the recent tail is shipped on startup;
+		// files showing up later are read from the start.
+		if t.firstPoll {
+			pos.Offset = backfillOffset(f, fi.Size(), tailBackfillLines)
+		}
+		t.positions[path] = pos
+		// Where reading starts is not a delivery: keep it across a rewind.
+		t.committed[path] = *pos
+	case pos.Dev != dev || pos.Inode != ino || fi.Size() < pos.Offset || !fingerprintMatches(f, pos):
+		// pos stays on the rotated file until it has been read to the end,
+		// so a large remainder is caught up over several polls.
+		texts, n, done := catchUpRotated(path, pos, limit)
+		read += n
+		for _, text := range texts {
+			lines = append(lines, tailLine{Source: src.Source, Path: path, Text: text, Parser: src.Parser, Multiline: src.Multiline})
+		}
+		pos.LastSeen = now.Unix()
+		if !done {
+			return lines, read
+		}
+		*pos = tailPosition{Dev: dev, Inode: ino}
+	}
+	pos.LastSeen = now.Unix()
+
+	if pos.FingerprintSize < tailFingerprintSize && fi.Size() > int64(pos.FingerprintSize) {
+		pos.Fingerprint, pos.FingerprintSize = fingerprint(io.NewSectionReader(f, 0, fi.Size()))
+	}
+	if read >= limit {
+		return lines, read
+	}
+
+	texts, consumed := readNewLines(f, pos.Offset, fi.Size(), limit-read)
+	pos.Offset += consumed
+	for _, text := range texts {
+		lines = append(lines, tailLine{Source: src.Source, Path: path, Text: text, Parser: src.Parser, Multiline: src.Multiline})
+	}
+	return lines, read + consumed
+}
+
+// readNewLines reads complete lines between offset and size, up to limit
+// bytes (at least maxTailLineSize). A line longer than maxTailLineSize is
+// cut rather than waited for.
+func readNewLines(f *os.File, offset, size, limit int64) ([]string, int64) {
+	n := min(size-offset, max(limit, maxTailLineSize))
+	if n <= 0 {
+		return nil, 0
+	}
+	buf := make([]byte, n)
+	if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return nil, 0
+	}
+
+	end := bytes.LastIndexByte(buf, '\n') + 1
+	if end == 0 {
+		if len(buf) < maxTailLineSize {
+			return nil, 0
+		}
+		end = len(buf)
+	}
+	return splitLines(buf[:end]), int64(end)
+}
+
+func splitLines(buf []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func backfillOffset(f *os.File, size int64, n int) int64 {
+	const blockSize int64 = 50 * 1024
+	start := max(size-blockSize, 0)
+	buf := make([]byte, size-start)
+	if _, err := f.ReadAt(buf, start); err != nil && err != io.EOF {
+		return size
+	}
+
+	// Only complete lines count; skip a trailing partial line.
+	end := bytes.LastIndexByte(buf, '\n')
+	if end < 0 {
+		return start
+	}
+	for i := end - 1; i >= 0; i-- {
+		if buf[i] == '\n' {
+			n--
+			if n == 0 {
+				return start + int64(i) + 1
+			}
+		}
+	}
+	return start
+}
+
+func fingerprint(r io.Reader) (string, int) {
+	buf := make([]byte, tailFingerprintSize)
+	n, _ := io.ReadFull(r, buf)
+	sum := sha256.Sum256(buf[:n])
+	return hex.EncodeToString(sum[:]), n
+}
+
+func fingerprintMatches(f *os.File, pos *tailPosition) bool {
+	if pos.FingerprintSize == 0 {
+		return true
+	}
+	fp, n := fingerprint(io.NewSectionReader(f, 0, int64(pos.FingerprintSize)))
+	return n == pos.FingerprintSize && fp == pos.Fingerprint
+}
+
+// isRotatedFile keeps globs like /var/log/app/* from tailing rotated copies
+// as if they were live files.
+func isRotatedFile(path string) bool {
+	return rotatedName.MatchString(filepath.Base(path))
+}
+
+type rotatedFile struct {
+	path  string
+	mtime time.Time
+}
+
+// catchUpRotated reads up to limit bytes of what is left of the file pos
+// describes after it was rotated away (renamed, compressed, or copied and
+// truncated), then of any siblings rotated after it that were never read.
+// pos follows the reading from file to file; done reports that all of them
+// have been read, and the live file is next.
+func catchUpRotated(path string, pos *tailPosition, limit int64) (lines []string, n int64, done bool) {
+	var candidates []rotatedFile
+	for _, pattern := range []string{path + ".*", path + "-*"} {
+		matches, _ := filepath.Glob(pattern)
+		for _, m := range matches {
+			if !rotatedSuffix.MatchString(strings.TrimPrefix(m, path)) {
+				continue
+			}
+			if fi, err := os.Stat(m); err == nil && fi.Mode().IsRegular() {
+				candidates = append(candidates, rotatedFile{path: m, mtime: fi.ModTime()})
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].mtime.Before(candidates[j].mtime) })
+
+	found := -1
+	for i, c := range candidates {
+		if rotatedMatches(c.path, pos) {
+			found = i
+			break
+		}
+	}
+	if found < 0 {
+		if pos.Offset > 0 {
+			log.Printf("Tail %s: rotated file not found, unread lines may be lost", path)
+		}
+		return nil, 0, true
+	}
+
+	for i, c := range candidates[found:] {
+		if i > 0 {
+			next, ok := rotatedPosition(c.path)
+			if !ok {
+				continue
+			}
+			*pos = next
+		}
+		texts, consumed, eof := readRotated(c.path, pos.Offset, limit-n)
+		lines = append(lines, texts...)
+		n += consumed
+		pos.Offset += consumed
+		if !eof {
+			return lines, n, false
+		}
+	}
+	return lines, n, true
+}
+
+// rotatedPosition identifies a rotated sibling to be read from the start,
+// the way rotatedMatches recognizes it. Empty files have nothing to read.
+func rotatedPosition(path string) (tailPosition, bool) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return tailPosition{}, false
+	}
+	r, err := openRotated(path)
+	if err != nil {
+		return tailPosition{}, false
+	}
+	defer r.Close()
+
+	dev, ino := fileIdentity(fi)
+	pos := tailPosition{Dev: dev, Inode: ino, LastSeen: time.Now().Unix()}
+	pos.Fingerprint, pos.FingerprintSize = fingerprint(r)
+	return pos, pos.FingerprintSize > 0
+}
+
+func openRotated(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, f}, nil
+}
+
+func rotatedMatches(path string, pos *tailPosition) bool {
+	if !strings.HasSuffix(path, ".gz") && pos.Inode != 0 {
+		if fi, err := os.Stat(path); err == nil {
+			if dev, ino := fileIdentity(fi); dev == pos.Dev && ino == pos.Inode {
+				return true
+			}
+		}
+	}
+	if pos.FingerprintSize == 0 {
+		return false
+	}
+
+	r, err := openRotated(path)
+	if err != nil {
+		return false
+	}
+	defer r.Close()
+	fp, n := fingerprint(io.LimitReader(r, int64(pos.FingerprintSize)))
+	return n == pos.FingerprintSize && fp == pos.Fingerprint
+}
+
+// readRotated reads complete lines of a rotated file from offset, up to
+// limit bytes, reporting whether the end was reached. Rotated files don't
+// grow, so a last line without a newline is taken as is. Compressed files
+// are only caught up within their first maxTailCatchupBytes, as reaching
+// an offset means decompressing everything before it.
+func readRotated(path string, offset, limit int64) ([]string, int64, bool) {
+	r, err := openRotated(path)
+	if err != nil {
+		return nil, 0, true
+	}
+	defer r.Close()
+
+	if f, ok := r.(*os.File); ok {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return nil, 0, true
+		}
+	} else {
+		if offset >= maxTailCatchupBytes {
+			log.Printf("Tail %s: catch-up limited to %d bytes", path, maxTailCatchupBytes)
+			return nil, 0, true
+		}
+		if _, err := io.CopyN(io.Discard, r, offset); err != nil {
+			return nil, 0, true
+		}
+	}
+
+	limit = max(limit, 0)
+	buf, _ := io.ReadAll(io.LimitReader(r, limit+1))
+	if int64(len(buf)) <= limit {
+		return splitLines(buf), int64(len(buf)), true
+	}
+	buf = buf[:limit]
+	end := bytes.LastIndexByte(buf, '\n') + 1
+	if end == 0 {
+		if len(buf) < maxTailLineSize {
+			return nil, 0, false // wait for a poll with more budget
+		}
+		end = len(buf)
+	}
+	return splitLines(buf[:end]), int64(end), false
+}
@@ -0,0 +1,247 @@
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func appendFile(t *testing.T, path, text string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(text); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tailTexts(lines []tailLine) string {
+	var texts []string
+	for _, l := range lines {
+		texts = append(texts, l.Text)
+	}
+	return strings.Join(texts, ",")
+}
+
+func TestTailerCommitAndRewind(t *testing.T) {
+	dir, stateDir := t.TempDir(), t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "old\n")
+
+	newTailer := func() *fileTailer {
+		return newFileTailer([]tailSource{{Source: "app", Pattern: path}}, newStateStore(stateDir))
+	}
+	tl := newTailer()
+	if got := tailTexts(tl.poll(1 << 20)); got != "old" {
+		t.Fatalf("backfill = %q", got)
+	}
+	tl.commit()
+
+	appendFile(t, path, "a\nb\npartial")
+	if got := tailTexts(tl.poll(1 << 20)); got != "a,b" {
+		t.Fatalf("poll = %q", got)
+	}
+	// Delivery failed: the same lines are read again.
+	tl.rewind()
+	if got := tailTexts(tl.poll(1 << 20)); got != "a,b" {
+		t.Fatalf("poll after rewind = %q", got)
+	}
+
+	// A restart without a commit resumes from the last committed offset.
+	tl = newTailer()
+	if got := tailTexts(tl.poll(1 << 20)); got != "a,b" {
+		t.Fatalf("poll after restart = %q", got)
+	}
+	tl.commit()
+	appendFile(t, path, "\nc\n")
+	if got := tailTexts(newTailer().poll(1 << 20)); got != "partial,c" {
+		t.Fatalf("poll after committed restart = %q", got)
+	}
+}
+
+func TestTailerBudget(t *testing.T) {
+	dir := t.TempDir()
+	line := strings.Repeat("x", 1023) + "\n"
+	for _, name := range []string{"a.log", "b.log", "c.log"} {
+		appendFile(t, filepath.Join(dir, name), "") // seen empty on the first poll
+	}
+	tl := newFileTailer([]tailSource{{Source: "app", Pattern: filepath.Join(dir, "*.log")}}, newStateStore(""))
+	tl.poll(1 << 20)
+	for _, name := range []string{"a.log", "b.log", "c.log"} {
+		appendFile(t, filepath.Join(dir, name), strings.Repeat(line, 200)) // 200KB each
+	}
+
+	// Each file gets at least maxTailLineSize, and reading stops once the
+	// budget is spent; the file left out is read first next time.
+	first := tl.poll(100 * 1024)
+	if len(first) != 2*maxTailLineSize/1024 {
+		t.Fatalf("first poll read %d lines", len(first))
+	}
+	second := tl.poll(100 * 1024)
+	if second[0].Path != filepath.Join(dir, "c.log") {
+		t.Errorf("second poll starts with %s", second[0].Path)
+	}
+
+	total := len(first) + len(second)
+	for i := 0; i < 20; i++ {
+		total += len(tl.poll(100 * 1024))
+	}
+	if total != 600 {
+		t.Errorf("read %d lines in total, want 600", total)
+	}
+}
+
+func TestTailerConfiguredPathWithDigits(t *testing.T) {
+	dir := t.TempDir()
+	explicit := filepath.Join(dir, "app-2024")
+	appendFile(t, explicit, "")
+	appendFile(t, filepath.Join(dir, "other.log.1"), "")
+
+	tl := newFileTailer([]tailSource{
+		{Source: "explicit", Pattern: explicit},
+		{Source: "glob", Pattern: filepath.Join(dir, "other.log*")},
+	}, newStateStore(""))
+	tl.poll(1 << 20)
+	appendFile(t, explicit, "kept\n")
+	appendFile(t, filepath.Join(dir, "other.log.1"), "rotated\n")
+
+	if got := tailTexts(tl.poll(1 << 20)); got != "kept" {
+		t.Errorf("poll = %q", got)
+	}
+}
+
+func TestTailerRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "")
+	tl := newFileTailer([]tailSource{{Source: "app", Pattern: path}}, newStateStore(""))
+	tl.poll(1 << 20)
+
+	appendFile(t, path, "1\n2\n")
+	tl.poll(1 << 20)
+	appendFile(t, path, "3\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "4\n")
+
+	if got := tailTexts(tl.poll(1 << 20)); got != "3,4" {
+		t.Errorf("poll after rotation = %q", got)
+	}
+}
+
+func TestTailerRotationBudget(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "")
+	tl := newFileTailer([]tailSource{{Source: "app", Pattern: path}}, newStateStore(""))
+	tl.poll(1 << 20)
+
+	// 200KB left unread in app.log.1, then 100KB in a compressed sibling
+	// rotated after it, then the live file.
+	line := func(prefix string, i int) string {
+		return fmt.Sprintf("%s%04d%s\n", prefix, i, strings.Repeat("x", 1018))
+	}
+	var rotated strings.Builder
+	for i := range 200 {
+		rotated.WriteString(line("r", i))
+	}
+	appendFile(t, path, rotated.String())
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	for i := range 100 {
+		gz.Write([]byte(line("z", i)))
+	}
+	gz.Close()
+	if err := os.WriteFile(path+".2.gz", compressed.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(path+".1", old, old)
+	appendFile(t, path, "live\n")
+
+	// Each poll stays within the budget, and a later one picks up the rest
+	// in order.
+	var got []string
+	for i := 0; i < 10; i++ {
+		lines := tl.poll(100 * 1024)
+		if len(lines)*1024 > 100*1024 {
+			t.Errorf("poll %d read %d lines", i, len(lines))
+		}
+		for _, l := range lines {
+			got = append(got, l.Text[:min(len(l.Text), 5)])
+		}
+	}
+	if len(got) != 301 || got[0] != "r0000" || got[199] != "r0199" || got[200] != "z0000" || got[299] != "z0099" || got[300] != "live" {
+		t.Fatalf("read %d lines: %v ... %v", len(got), got[:min(len(got), 3)], got[max(len(got)-3, 0):])
+	}
+}
+
+func TestReadRotated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log.1")
+	if err := os.WriteFile(path, []byte("a\nb\nlast"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		offset, limit int64
+		want          string
+		consumed      int64
+		eof           bool
+	}{
+		{0, 1 << 20, "a,b,last", 8, true},
+		{0, 5, "a,b", 4, false},
+		{2, 1 << 20, "b,last", 6, true},
+		{0, 1, "", 0, false}, // a line waits for more budget
+		{8, 1 << 20, "", 0, true},
+	}
+	for _, tt := range tests {
+		texts, consumed, eof := readRotated(path, tt.offset, tt.limit)
+		if strings.Join(texts, ",") != tt.want || consumed != tt.consumed || eof != tt.eof {
+			t.Errorf("readRotated(%d, %d) = %q, %d, %v", tt.offset, tt.limit, texts, consumed, eof)
+		}
+	}
+}
+
+func TestReadNewLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f")
+	long := strings.Repeat("y", maxTailLineSize+10)
+	tests := []struct {
+		content  string
+		limit    int64
+		want     string
+		consumed int64
+	}{
+		{"a\nb\n", 1 << 20, "a,b", 4},
+		{"a\r\n\nb", 1 << 20, "a", 4},
+		{"no newline", 1 << 20, "", 0},
+		{long, 1 << 20, long, int64(len(long))},
+		{long + "\n", 10, long[:maxTailLineSize], maxTailLineSize},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			texts, consumed := readNewLines(f, 0, int64(len(tt.content)), tt.limit)
+			if strings.Join(texts, ",") != tt.want || consumed != tt.consumed {
+				t.Errorf("got %d lines, consumed %d", len(texts), consumed)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+)
+
+const (
+	defaultTextfileStaleAfter = 1 * time.Hour
+	maxTextfileSize           = 4 << 20
+	maxTextfiles              = 1000
+)
+
+type textfileEntry struct {
+	modTime time.Time
+	size    int64
+	metrics []models.CustomMetric
+	err     string
+}
+
+// textfileCollector picks up metrics that cron jobs and scripts drop into a
+// directory, like node_exporter's textfile collector. Files are reparsed
+// only when their mtime or size changes.
+type textfileCollector struct {
+	dir        string
+	staleAfter time.Duration
+	files      map[string]*textfileEntry
+}
+
+var textfiles *textfileCollector
+
+func newTextfileCollector(c config.TextfileConfig) *textfileCollector {
+	if c.Directory == "" {
+		return nil
+	}
+	return &textfileCollector{
+		dir:        c.Directory,
+		staleAfter: c.StaleAfter.Or(defaultTextfileStaleAfter),
+		files:      map[string]*textfileEntry{},
+	}
+}
+
+func (t *textfileCollector) collect(now time.Time) ([]models.CustomMetric, []models.TextfileInfo) {
+	if t == nil {
+		return nil, nil
+	}
+	var paths []string
+	for _, pattern := range []string{"*.prom", "*.json"} {
+		matches, _ := filepath.Glob(filepath.Join(t.dir, pattern))
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+	if len(paths) > maxTextfiles {
+		log.Printf("Textfile: %d files in %s, reading the first %d", len(paths), t.dir, maxTextfiles)
+		paths = paths[:maxTextfiles]
+	}
+
+	var metrics []models.CustomMetric
+	var infos []models.TextfileInfo
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		seen[path] = true
+
+		entry := t.files[path]
+		if entry == nil || !entry.modTime.Equal(fi.ModTime()) || entry.size != fi.Size() {
+			if fresh, ok := readTextfile(path, fi); ok {
+				entry = fresh
+				t.files[path] = entry
+			}
+		}
+		if entry == nil {
+			continue // changed while being read; try again next time
+		}
+
+		metrics = append(metrics, entry.metrics...)
+		infos = append(infos, models.TextfileInfo{
+			Path:    path,
+			ModTime: entry.modTime.UnixMilli(),
+			Metrics: len(entry.metrics),
+			Stale:   now.Sub(entry.modTime) > t.staleAfter,
+			Error:   entry.err,
+		})
+	}
+	for path := range t.files {
+		if !seen[path] {
+			delete(t.files, path)
+		}
+	}
+	return metrics, infos
+}
+
+// readTextfile parses a whole file or nothing of it. It returns false when
+// the file changed while it was read, which means a writer that doesn't
+// rename into place is still at it.
+func readTextfile(path string, fi os.FileInfo) (*textfileEntry, bool) {
+	entry := &textfileEntry{modTime: fi.ModTime(), size: fi.Size()}
+	data, err := readFileLimited(path, maxTextfileSize)
+	if err != nil {
+		entry.err = err.Error()
+		return entry, true
+	}
+	if after, err := os.Stat(path); err != nil || !after.ModTime().Equal(fi.ModTime()) || after.Size() != fi.Size() {
+		return nil, false
+	}
+
+	var metrics []models.CustomMetric
+	if strings.HasSuffix(path, ".json") {
+		metrics, err = parseTextfileJSON(data)
+	} else {
+		var samples []promSample
+		var types map[string]string
+		if samples, types, err = parsePromText(bytes.NewReader(data)); err == nil {
+			metrics = promFamilies(samples, types)
+		}
+	}
+	if err != nil {
+		entry.err = err.Error()
+		return entry, true
+	}
+
+	// Infinite samples parse fine but can't be sent as JSON; keep the rest of
+	// the file and say what was left out.
+	ts := fi.ModTime().UnixMilli()
+	kept := metrics[:0]
+	for _, m := range metrics {
+		if !customMetricFinite(m) {
+			continue
+		}
+		m.Source = "textfile"
+		m.Timestamp = ts
+		kept = append(kept, m)
+	}
+	if dropped := len(metrics) - len(kept); dropped > 0 {
+		entry.err = fmt.Sprintf("%d metrics with NaN or infinite values dropped", dropped)
+	}
+	entry.metrics = kept
+	return entry, true
+}
+
+func readFileLimited(path string, limit int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("larger than %d bytes", limit)
+	}
+	return data, nil
+}
+
+// parseTextfileJSON accepts a list of metrics, or an object holding it in
+// "metrics", with the custom metric fields: name, value, type (gauge by
+// default), unit and labels.
+func parseTextfileJSON(data []byte) ([]models.CustomMetric, error) {
+	var metrics []models.CustomMetric
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		var doc struct {
+			Metrics []models.CustomMetric `json:"metrics"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		metrics = doc.Metrics
+	} else if err := json.Unmarshal(data, &metrics); err != nil {
+		return nil, err
+	}
+
+	for i := range metrics {
+		if metrics[i].Name == "" {
+			return nil, errors.New("metric without a name")
+		}
+		if metrics[i].Type == "" {
+			metrics[i].Type = "gauge"
+		}
+	}
+	return metrics, nil
+}
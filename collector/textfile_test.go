@@ -0,0 +1,103 @@
+package collector
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uptime-id/agent/config"
+	"github.com/uptime-id/agent/models"
+)
+
+func TestParseTextfileJSON(t *testing.T) {
+	tests := []struct {
+		name, in string
+		want     int
+		err      bool
+	}{
+		{"list", `[{"name":"a","value":1},{"name":"b","value":2,"type":"counter"}]`, 2, false},
+		{"object", ` {"metrics":[{"name":"a","value":1,"labels":{"x":"y"}}]}`, 1, false},
+		{"empty", `[]`, 0, false},
+		{"no name", `[{"value":1}]`, 0, true},
+		{"overflow", `[{"name":"a","value":1e999}]`, 0, true},
+		{"not JSON", `a 1`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTextfileJSON([]byte(tt.in))
+			if (err != nil) != tt.err || len(got) != tt.want {
+				t.Fatalf("got %+v, %v", got, err)
+			}
+			for _, m := range got {
+				if m.Type == "" {
+					t.Errorf("%s has no type", m.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestTextfileCollector(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string, mtime time.Time) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now().Truncate(time.Second)
+	write("backup.prom", "# TYPE backup_ok gauge\nbackup_ok 1\nbackup_age +Inf\nbackup_min -Inf\nbackup_nan NaN\n", now)
+	write("jobs.json", `[{"name":"jobs_queued","value":4,"labels":{"queue":"mail"}}]`, now.Add(-2*time.Hour))
+	write("broken.prom", "broken{ 1\n", now)
+	write("notes.txt", "ignored 1\n", now)
+
+	c := newTextfileCollector(config.TextfileConfig{Directory: dir})
+	metrics, infos := c.collect(now)
+	if _, err := json.Marshal(metrics); err != nil {
+		t.Fatalf("metrics don't encode: %v", err)
+	}
+	if len(metrics) != 2 {
+		t.Errorf("metrics = %+v", metrics)
+	}
+	for _, m := range metrics {
+		if m.Source != "textfile" || m.Timestamp == 0 {
+			t.Errorf("metric = %+v", m)
+		}
+	}
+
+	byPath := map[string]models.TextfileInfo{}
+	for _, info := range infos {
+		byPath[filepath.Base(info.Path)] = info
+	}
+	if len(byPath) != 3 {
+		t.Errorf("infos = %+v", infos)
+	}
+	if info := byPath["backup.prom"]; info.Metrics != 1 || info.Stale || !strings.Contains(info.Error, "2 metrics") {
+		t.Errorf("backup.prom = %+v", info)
+	}
+	if info := byPath["jobs.json"]; info.Metrics != 1 || !info.Stale || info.Error != "" {
+		t.Errorf("jobs.json = %+v", info)
+	}
+	if info := byPath["broken.prom"]; info.Metrics != 0 || info.Error == "" {
+		t.Errorf("broken.prom = %+v", info)
+	}
+
+	// An unchanged file is served from the cache, a rewritten one reparsed.
+	c.files[filepath.Join(dir, "jobs.json")].metrics = nil
+	write("backup.prom", "backup_ok 0\n", now.Add(time.Second))
+	os.Remove(filepath.Join(dir, "broken.prom"))
+	metrics, infos = c.collect(now)
+	if len(metrics) != 1 || metrics[0].Name != "backup_ok" || metrics[0].Value != 0 || len(infos) != 2 || infos[0].Error != "" {
+		t.Errorf("second collect = %+v, %+v", metrics, infos)
+	}
+	if len(c.files) != 2 {
+		t.Errorf("%d cached files after a removal", len(c.files))
+	}
+}
@@ -1,17 +1,20 @@
 package collector
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"net"
 	"net/http"
-	"os"
 	"os/exec"
 	"strings"
 	"time"
 )
 
-const cmdTimeout = 10 * time.Second
+const (
+	cmdTimeout       = 10 * time.Second
+	maxCmdOutputSize = 1 << 20 // per stream
+)
 
 func runPowerShell(cmd string) string {
 	ctx, cancel := context.WithTimeout(context.Background(), cmdTimeout)
@@ -23,8 +26,42 @@ func runPowerShell(cmd string) string {
 func runCmdWithErr(name string, args ...string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), cmdTimeout)
 	defer cancel()
-	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
-	return string(out), err
+	stdout, stderr, err := runCmdContext(ctx, nil, name, args...)
+	return stdout + stderr, err
+}
+
+// runCmdContext runs a command until ctx is done and returns its stdout and
+// stderr, each cut at maxCmdOutputSize. A nil env inherits the agent's
+// environment.
+func runCmdContext(ctx context.Context, env []string, name string, args ...string) (string, string, error) {
+	stdout := &limitedBuffer{n: maxCmdOutputSize}
+	stderr := &limitedBuffer{n: maxCmdOutputSize}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = env
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	setProcessGroup(cmd)
+	// Children that escape the process group keep its output pipes open.
+	cmd.WaitDelay = time.Second
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+// limitedBuffer keeps the first n bytes written to it and discards the rest.
+// Writes never fail, so a chatty command isn't killed by a broken pipe.
+type limitedBuffer struct {
+	buf bytes.Buffer
+	n   int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.n - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
 }
 
 func getPublicIP() string {
@@ -49,46 +86,3 @@ func getPublicIP() string {
 
 	return ipStr
 }
-
-func readLastLines(path string, n int) string {
-	file, err := os.Open(path)
-	if err != nil {
-		return ""
-	}
-	defer file.Close()
-
-	stat, err := file.Stat()
-	if err != nil {
-		return ""
-	}
-	filesize := stat.Size()
-
-	const blockSize int64 = 50 * 1024
-
-	startPos := filesize - blockSize
-	if startPos < 0 {
-		startPos = 0
-	}
-
-	if _, err := file.Seek(startPos, 0); err != nil {
-		return ""
-	}
-
-	bufLen := filesize - startPos
-	buf := make([]byte, bufLen)
-	if _, err := io.ReadFull(file, buf); err != nil {
-		return ""
-	}
-
-	lines := strings.Split(string(buf), "\n")
-
-	if len(lines) > 0 && lines[len(lines)-1] == "" {
-		lines = lines[:len(lines)-1]
-	}
-
-	if len(lines) > n {
-		lines = lines[len(lines)-n:]
-	}
-
-	return strings.Join(lines, "\n")
-}
@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimitedBuffer(t *testing.T) {
+	b := &limitedBuffer{n: 5}
+	for _, s := range []string{"abc", "def", "ghi"} {
+		if n, err := b.Write([]byte(s)); n != len(s) || err != nil {
+			t.Errorf("Write(%q) = %d, %v", s, n, err)
+		}
+	}
+	if b.String() != "abcde" {
+		t.Errorf("buffer = %q", b.String())
+	}
+}
+
+func TestRunCmdContextLimit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	stdout, stderr, err := runCmdContext(context.Background(), nil, "sh", "-c",
+		"head -c 3000000 /dev/zero | tr '\\0' x; echo err >&2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stdout) != maxCmdOutputSize || strings.Trim(stdout, "x") != "" {
+		t.Errorf("stdout: %d bytes", len(stdout))
+	}
+	if stderr != "err\n" {
+		t.Errorf("stderr = %q", stderr)
+	}
+}
+
+func TestRunCmdContextKillsChildren(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs sh and /proc")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	stdout, _, err := runCmdContext(ctx, nil, "sh", "-c", "sleep 30 & echo $!; wait")
+	if err == nil || time.Since(start) > 900*time.Millisecond {
+		t.Fatalf("returned %v after %v", err, time.Since(start))
+	}
+
+	// The background sleep is killed with the shell: gone, or a zombie
+	// waiting for its new parent to reap it.
+	pid := strings.TrimSpace(stdout)
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		stat, err := os.ReadFile("/proc/" + pid + "/stat")
+		if err != nil || strings.Contains(string(stat), ") Z ") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("child %s still running: %s", pid, stat)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"log"
 	"os"
 	"strconv"
 	"time"
@@ -14,6 +15,32 @@ type Config struct {
 	SendInterval time.Duration
 	MaxLogSize   int
 	HTTPTimeout  time.Duration
+	StateDir     string
+
+	// Kubernetes node mode (agent running as a DaemonSet)
+	KubernetesMode      bool
+	NodeName            string
+	KubeletURL          string
+	KubeletTokenFile    string
+	KubeletCAFile       string
+	KubeletInsecure     bool
+	KubeletStatsSummary bool
+
+	// Structured settings from CONFIG_FILE
+	ConfigFile   string
+	Probes       []ProbeConfig
+	Certificates CertificatesConfig
+	LogFiles     []LogFileConfig
+	Journal      JournalConfig
+	Redaction    RedactionConfig
+	Events       EventsConfig
+	Syslog       SyslogConfig
+	OTLP         OTLPConfig
+	StatsD       StatsDConfig
+	Prometheus   PrometheusConfig
+	Checks       ChecksConfig
+	Textfile     TextfileConfig
+	Processes    ProcessesConfig
 }
 
 func Load() *Config {
@@ -27,6 +54,14 @@ func Load() *Config {
 		}
 		return def
 	}
+	parseBool := func(key string, def bool) bool {
+		if v := os.Getenv(key); v != "" {
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b
+			}
+		}
+		return def
+	}
 
 	cfg := &Config{
 		APIKey:       getEnv("API_KEY", ""),
@@ -34,6 +69,25 @@ func Load() *Config {
 		SendInterval: time.Duration(parseInt("SEND_INTERVAL_SECONDS", 5)) * time.Second,
 		MaxLogSize:   parseInt("MAX_LOG_SIZE_BYTES", 400_000),
 		HTTPTimeout:  time.Duration(parseInt("HTTP_TIMEOUT_SECONDS", 10)) * time.Second,
+		StateDir:     getEnv("STATE_DIR", "/var/lib/uptimeid-agent"),
+
+		KubernetesMode:      parseBool("KUBERNETES_MODE", false),
+		NodeName:            getEnv("NODE_NAME", ""),
+		KubeletURL:          getEnv("KUBELET_URL", ""),
+		KubeletTokenFile:    getEnv("KUBELET_TOKEN_FILE", "/var/run/secrets/kubernetes.io/serviceaccount/token"),
+		KubeletCAFile:       getEnv("KUBELET_CA_FILE", "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"),
+		KubeletInsecure:     parseBool("KUBELET_INSECURE_SKIP_VERIFY", false),
+		KubeletStatsSummary: parseBool("KUBELET_STATS_SUMMARY", false),
+
+		ConfigFile: getEnv("CONFIG_FILE", defaultConfigFile),
+	}
+
+	if err := loadFile(cfg, cfg.ConfigFile, os.Getenv("CONFIG_FILE") != ""); err != nil {
+		log.Fatalf("Config file error: %v", err)
+	}
+
+	if cfg.KubernetesMode && cfg.KubeletURL == "" && cfg.NodeName != "" {
+		cfg.KubeletURL = "https://" + cfg.NodeName + ":10250"
 	}
 
 	return cfg
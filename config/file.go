@@ -0,0 +1,482 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const defaultConfigFile = "/etc/uptimeid/agent.json"
+
+// fileConfig holds the structured settings that don't fit in env vars. It is
+// read from CONFIG_FILE (JSON) and copied into Config.
+type fileConfig struct {
+	Probes       []ProbeConfig      `json:"probes"`
+	Certificates CertificatesConfig `json:"certificates"`
+	LogFiles     []LogFileConfig    `json:"logFiles"`
+	Journal      JournalConfig      `json:"journal"`
+	Redaction    RedactionConfig    `json:"redaction"`
+	Events       EventsConfig       `json:"events"`
+	Syslog       SyslogConfig       `json:"syslog"`
+	OTLP         OTLPConfig         `json:"otlp"`
+	StatsD       StatsDConfig       `json:"statsd"`
+	Prometheus   PrometheusConfig   `json:"prometheus"`
+	Checks       ChecksConfig       `json:"checks"`
+	Textfile     TextfileConfig     `json:"textfile"`
+	Processes    ProcessesConfig    `json:"processes"`
+}
+
+// Duration accepts either a Go duration string ("30s", "1m") or a number of
+// seconds.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*d = Duration(v)
+		return nil
+	}
+
+	secs, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return fmt.Errorf("invalid duration %s", b)
+	}
+	*d = Duration(secs * float64(time.Second))
+	return nil
+}
+
+func (d Duration) Or(def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return time.Duration(d)
+}
+
+type ProbeConfig struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"` // tcp, http, dns, tls, icmp
+	Target   string   `json:"target"`
+	Interval Duration `json:"interval"`
+	Timeout  Duration `json:"timeout"`
+
+	// http
+	Method         string            `json:"method,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	ExpectedStatus []int             `json:"expectedStatus,omitempty"`
+	BodyRegex      string            `json:"bodyRegex,omitempty"`
+
+	// http, tls
+	ServerName         string `json:"serverName,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+
+	// dns: Target is the name to resolve
+	Server         string `json:"server,omitempty"`
+	RecordType     string `json:"recordType,omitempty"`
+	ExpectedAnswer string `json:"expectedAnswer,omitempty"`
+
+	// icmp: Target is a host name or IP
+	Network        string   `json:"network,omitempty"` // ip4, ip6
+	Count          int      `json:"count,omitempty"`
+	PacketInterval Duration `json:"packetInterval,omitempty"`
+}
+
+type CertificatesConfig struct {
+	Interval  Duration              `json:"interval"`
+	Timeout   Duration              `json:"timeout"`
+	Endpoints []CertificateEndpoint `json:"endpoints"`
+	// Files, directories or globs containing PEM certificates
+	Paths []string `json:"paths"`
+}
+
+// CertificateEndpoint is a remote TLS endpoint; it may be written as a plain
+// "host:port" string.
+type CertificateEndpoint struct {
+	Target     string `json:"target"`
+	ServerName string `json:"serverName,omitempty"`
+}
+
+func (e *CertificateEndpoint) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		e.Target = s
+		return nil
+	}
+	type plain CertificateEndpoint
+	return json.Unmarshal(b, (*plain)(e))
+}
+
+// LogFileConfig is a file or glob to tail; it may be written as a plain path.
+// Format selects a parser: json, logfmt, syslog, rfc3164, rfc5424, nginx,
+// apache, or regex with named groups in Regex.
+type LogFileConfig struct {
+	Path   string `json:"path"`
+	Source string `json:"source,omitempty"`
+	Format string `json:"format,omitempty"`
+	Regex  string `json:"regex,omitempty"`
+
+	Multiline MultilineConfig `json:"multiline"`
+}
+
+// MultilineConfig joins stack traces and other multi-line events. Preset is
+// one of java, python or go; otherwise either Start (lines not matching it
+// continue the event) or Continuation (lines matching it do) is a regex.
+type MultilineConfig struct {
+	Preset       string   `json:"preset,omitempty"`
+	Start        string   `json:"start,omitempty"`
+	Continuation string   `json:"continuation,omitempty"`
+	Timeout      Duration `json:"timeout,omitempty"`
+	MaxLines     int      `json:"maxLines,omitempty"`
+}
+
+type JournalConfig struct {
+	Multiline MultilineConfig `json:"multiline"`
+}
+
+// RedactionConfig adds custom rules to the built-in secret and PII rules
+// (AWS keys, JWTs, bearer tokens, URL credentials, card numbers, emails).
+type RedactionConfig struct {
+	DisableBuiltin bool            `json:"disableBuiltin,omitempty"`
+	Rules          []RedactionRule `json:"rules,omitempty"`
+}
+
+// RedactionRule replaces matches of Pattern with Replacement ("[REDACTED]"
+// by default); $1 style group references are expanded.
+type RedactionRule struct {
+	Name        string `json:"name,omitempty"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
+func (l *LogFileConfig) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		l.Path = s
+		return nil
+	}
+	type plain LogFileConfig
+	return json.Unmarshal(b, (*plain)(l))
+}
+
+// EventsConfig selects the built-in detection rule packs (ssh, oom, disk,
+// segfault, kernel; all of them when Packs is absent) and adds custom rules.
+type EventsConfig struct {
+	Packs []string    `json:"packs"`
+	Rules []EventRule `json:"rules,omitempty"`
+}
+
+// EventRule turns log lines matching Pattern into a counted event. Named
+// groups become event fields; GroupBy picks the fields that tell events
+// apart (all of them by default), and MinCount suppresses events seen fewer
+// times within Window (5m by default), however the matches fall across
+// collection intervals. Source limits the rule to one log source.
+type EventRule struct {
+	Name     string   `json:"name"`
+	Pattern  string   `json:"pattern"`
+	Severity string   `json:"severity,omitempty"`
+	Source   string   `json:"source,omitempty"`
+	GroupBy  []string `json:"groupBy,omitempty"`
+	MinCount int      `json:"minCount,omitempty"`
+	Window   Duration `json:"window,omitempty"`
+}
+
+// SyslogConfig enables the syslog receiver on any of the listed addresses
+// (e.g. ":514"). TLS needs CertFile and KeyFile; with ClientCAFile clients
+// must present a certificate signed by it.
+type SyslogConfig struct {
+	UDP          string `json:"udp,omitempty"`
+	TCP          string `json:"tcp,omitempty"`
+	TLS          string `json:"tls,omitempty"`
+	CertFile     string `json:"certFile,omitempty"`
+	KeyFile      string `json:"keyFile,omitempty"`
+	ClientCAFile string `json:"clientCaFile,omitempty"`
+	Source       string `json:"source,omitempty"`
+}
+
+// OTLPConfig enables the OTLP/HTTP receiver for logs and metrics on Listen
+// (normally "127.0.0.1:4318"); traces are only accepted with Traces set.
+type OTLPConfig struct {
+	Listen string `json:"listen,omitempty"`
+	Traces bool   `json:"traces,omitempty"`
+}
+
+// StatsDConfig enables the StatsD/DogStatsD server on a UDP address (e.g.
+// "127.0.0.1:8125") and/or a unix datagram socket. Timers and histograms
+// report the listed percentiles, 50/90/95/99 by default.
+type StatsDConfig struct {
+	UDP         string    `json:"udp,omitempty"`
+	Socket      string    `json:"socket,omitempty"`
+	Percentiles []float64 `json:"percentiles,omitempty"`
+}
+
+// PrometheusConfig lists exporters scraped in the background every Interval
+// (30s by default); each collection reports the latest scrape. Include and
+// Exclude are regexes on metric names; the global ones apply to every target
+// in addition to its own.
+type PrometheusConfig struct {
+	Interval Duration           `json:"interval"`
+	Timeout  Duration           `json:"timeout"`
+	Include  []string           `json:"include,omitempty"`
+	Exclude  []string           `json:"exclude,omitempty"`
+	Targets  []PrometheusTarget `json:"targets"`
+}
+
+// PrometheusTarget is one /metrics endpoint. Name becomes the job label
+// (default: the URL's host); Labels are added to every series. Interval
+// overrides the global one.
+type PrometheusTarget struct {
+	Name               string            `json:"name,omitempty"`
+	URL                string            `json:"url"`
+	Interval           Duration          `json:"interval,omitempty"`
+	Headers            map[string]string `json:"headers,omitempty"`
+	InsecureSkipVerify bool              `json:"insecureSkipVerify,omitempty"`
+	Labels             map[string]string `json:"labels,omitempty"`
+	Include            []string          `json:"include,omitempty"`
+	Exclude            []string          `json:"exclude,omitempty"`
+	Relabel            []RelabelRule     `json:"relabel,omitempty"`
+}
+
+// RelabelRule works like a Prometheus metric_relabel_configs entry: the
+// SourceLabels values joined by Separator (";") must fully match Regex
+// ("(.*)"). Action is replace (default), keep, drop, labeldrop or labelkeep.
+// The metric name is the __name__ label.
+type RelabelRule struct {
+	SourceLabels []string `json:"sourceLabels,omitempty"`
+	Separator    string   `json:"separator,omitempty"`
+	Regex        string   `json:"regex,omitempty"`
+	TargetLabel  string   `json:"targetLabel,omitempty"`
+	Replacement  string   `json:"replacement,omitempty"`
+	Action       string   `json:"action,omitempty"`
+}
+
+// ChecksConfig runs Nagios-compatible check plugins. At most Concurrency
+// (default 4) run at the same time.
+type ChecksConfig struct {
+	Concurrency int           `json:"concurrency,omitempty"`
+	Commands    []CheckConfig `json:"commands"`
+}
+
+// CheckConfig is one plugin. Command is executed directly, without a shell,
+// in an environment holding only PATH, LANG and Env. Format is nagios
+// (exit code and perfdata, the default) or json.
+type CheckConfig struct {
+	Name     string            `json:"name"`
+	Command  []string          `json:"command"`
+	Format   string            `json:"format,omitempty"`
+	Interval Duration          `json:"interval"`
+	Timeout  Duration          `json:"timeout"`
+	Env      map[string]string `json:"env,omitempty"`
+}
+
+// TextfileConfig reads *.prom (Prometheus text format) and *.json metric
+// files from Directory on every collection. Files not modified for
+// StaleAfter (default 1h) are reported as stale.
+type TextfileConfig struct {
+	Directory  string   `json:"directory,omitempty"`
+	StaleAfter Duration `json:"staleAfter"`
+}
+
+// ProcessesConfig tunes process collection: the Top (default 10) processes
+// by SortBy (cpu, rss, io or fds; default cpu) are reported, and Watch lists
+// process groups that are always reported, whatever their resource usage.
+// Details adds fields to the top processes, off by default to keep payloads
+// small: threads, fds (open descriptors), io (read and write rates), tree
+// (parent and children), limits (open files limit), ctxSwitches,
+// startTime, cgroup (with container ID and systemd unit) and priority (nice
+// and kernel priority). Sorting by io or fds reports that field as well.
+type ProcessesConfig struct {
+	Top     int            `json:"top,omitempty"`
+	SortBy  string         `json:"sortBy,omitempty"`
+	Details []string       `json:"details,omitempty"`
+	Watch   []ProcessWatch `json:"watch,omitempty"`
+}
+
+// ProcessDetails are the values accepted in ProcessesConfig.Details.
+var ProcessDetails = []string{"threads", "fds", "io", "tree", "limits", "ctxSwitches", "startTime", "cgroup", "priority"}
+
+// ProcessWatch selects the processes matching all of its criteria: the
+// process name, the executable path (a glob), a regex on the command line,
+// the owner, or the PID in a pidfile (a host path, looked up under HOST_ROOT
+// or /host in a container). The group is not running when fewer than
+// MinCount (default 1) processes match.
+type ProcessWatch struct {
+	Name     string `json:"name"`
+	Process  string `json:"process,omitempty"`
+	Exe      string `json:"exe,omitempty"`
+	Cmdline  string `json:"cmdline,omitempty"`
+	User     string `json:"user,omitempty"`
+	Pidfile  string `json:"pidfile,omitempty"`
+	MinCount int    `json:"minCount,omitempty"`
+}
+
+// defaultProbes keeps the historical latency targets when no probes are
+// configured; set "probes": [] to disable them.
+var defaultProbes = []ProbeConfig{
+	{Name: "8.8.8.8", Type: "tcp", Target: "8.8.8.8:53", Timeout: Duration(2 * time.Second)},
+	{Name: "1.1.1.1", Type: "tcp", Target: "1.1.1.1:53", Timeout: Duration(2 * time.Second)},
+}
+
+func loadFile(cfg *Config, path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !required {
+			cfg.Probes = defaultProbes
+			return nil
+		}
+		return err
+	}
+
+	var fc fileConfig
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	probeNames := map[string]bool{}
+	for i, p := range fc.Probes {
+		if p.Type == "" || p.Target == "" {
+			return fmt.Errorf("probe #%d: type and target are required", i+1)
+		}
+		if p.Name == "" {
+			fc.Probes[i].Name = p.Target
+		}
+		if probeNames[fc.Probes[i].Name] {
+			return fmt.Errorf("probe #%d: duplicate name %q, set a distinct name", i+1, fc.Probes[i].Name)
+		}
+		probeNames[fc.Probes[i].Name] = true
+		if p.BodyRegex != "" {
+			if _, err := regexp.Compile(p.BodyRegex); err != nil {
+				return fmt.Errorf("probe %s: invalid bodyRegex: %w", fc.Probes[i].Name, err)
+			}
+		}
+		if p.Type == "icmp" && p.Count > 1 && p.Timeout > 0 && p.PacketInterval > 0 &&
+			time.Duration(p.Count-1)*time.Duration(p.PacketInterval) >= time.Duration(p.Timeout) {
+			return fmt.Errorf("probe %s: %d packets %v apart don't fit in the %v timeout", fc.Probes[i].Name, p.Count, time.Duration(p.PacketInterval), time.Duration(p.Timeout))
+		}
+	}
+
+	for i, e := range fc.Certificates.Endpoints {
+		if e.Target == "" {
+			return fmt.Errorf("certificate endpoint #%d: target is required", i+1)
+		}
+	}
+
+	for i, l := range fc.LogFiles {
+		if l.Path == "" {
+			return fmt.Errorf("log file #%d: path is required", i+1)
+		}
+		if l.Source == "" {
+			fc.LogFiles[i].Source = l.Path
+		}
+	}
+
+	for i, r := range fc.Redaction.Rules {
+		if r.Pattern == "" {
+			return fmt.Errorf("redaction rule #%d: pattern is required", i+1)
+		}
+	}
+
+	for i, r := range fc.Events.Rules {
+		if r.Name == "" || r.Pattern == "" {
+			return fmt.Errorf("event rule #%d: name and pattern are required", i+1)
+		}
+	}
+
+	if fc.Syslog.TLS != "" && (fc.Syslog.CertFile == "" || fc.Syslog.KeyFile == "") {
+		return fmt.Errorf("syslog: tls requires certFile and keyFile")
+	}
+	if fc.Syslog.Source == "" {
+		fc.Syslog.Source = "syslog"
+	}
+
+	for _, p := range fc.StatsD.Percentiles {
+		if p <= 0 || p > 100 {
+			return fmt.Errorf("statsd: percentile %g out of range (0, 100]", p)
+		}
+	}
+	if fc.StatsD.Percentiles == nil {
+		fc.StatsD.Percentiles = []float64{50, 90, 95, 99}
+	}
+
+	checkNames := map[string]bool{}
+	for i, c := range fc.Checks.Commands {
+		if c.Name == "" || len(c.Command) == 0 {
+			return fmt.Errorf("check #%d: name and command are required", i+1)
+		}
+		if checkNames[c.Name] {
+			return fmt.Errorf("check #%d: duplicate name %q", i+1, c.Name)
+		}
+		checkNames[c.Name] = true
+		if c.Format != "" && c.Format != "nagios" && c.Format != "json" {
+			return fmt.Errorf("check %s: unknown format %q", c.Name, c.Format)
+		}
+	}
+
+	switch fc.Processes.SortBy {
+	case "", "cpu", "rss", "io", "fds":
+	default:
+		return fmt.Errorf("processes: unknown sortBy %q", fc.Processes.SortBy)
+	}
+	for _, d := range fc.Processes.Details {
+		if !slices.Contains(ProcessDetails, d) {
+			return fmt.Errorf("processes: unknown detail %q", d)
+		}
+	}
+	for i, w := range fc.Processes.Watch {
+		if w.Name == "" {
+			return fmt.Errorf("process watch #%d: name is required", i+1)
+		}
+		if w.Process == "" && w.Exe == "" && w.Cmdline == "" && w.User == "" && w.Pidfile == "" {
+			return fmt.Errorf("process watch %s: at least one of process, exe, cmdline, user or pidfile is required", w.Name)
+		}
+		if w.Cmdline != "" {
+			if _, err := regexp.Compile(w.Cmdline); err != nil {
+				return fmt.Errorf("process watch %s: invalid cmdline: %w", w.Name, err)
+			}
+		}
+		if w.MinCount <= 0 {
+			fc.Processes.Watch[i].MinCount = 1
+		}
+	}
+
+	for i, t := range fc.Prometheus.Targets {
+		if t.URL == "" {
+			return fmt.Errorf("prometheus target #%d: url is required", i+1)
+		}
+		for j, r := range t.Relabel {
+			switch r.Action {
+			case "", "replace":
+				if r.TargetLabel == "" {
+					return fmt.Errorf("prometheus target #%d relabel #%d: targetLabel is required", i+1, j+1)
+				}
+			case "keep", "drop", "labeldrop", "labelkeep":
+			default:
+				return fmt.Errorf("prometheus target #%d relabel #%d: unknown action %q", i+1, j+1, r.Action)
+			}
+		}
+	}
+
+	cfg.Certificates = fc.Certificates
+	cfg.LogFiles = fc.LogFiles
+	cfg.Journal = fc.Journal
+	cfg.Redaction = fc.Redaction
+	cfg.Events = fc.Events
+	cfg.Syslog = fc.Syslog
+	cfg.OTLP = fc.OTLP
+	cfg.StatsD = fc.StatsD
+	cfg.Prometheus = fc.Prometheus
+	cfg.Checks = fc.Checks
+	cfg.Textfile = fc.Textfile
+	cfg.Processes = fc.Processes
+	cfg.Probes = fc.Probes
+	if cfg.Probes == nil {
+		cfg.Probes = defaultProbes
+	}
+	return nil
+}
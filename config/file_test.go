@@ -0,0 +1,88 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadTestFile(t *testing.T, content string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "agent.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{}
+	return cfg, loadFile(cfg, path, true)
+}
+
+func TestLoadFileProbes(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{"name defaults to target", `{"probes": [{"type": "tcp", "target": "db:5432"}]}`, ""},
+		{"duplicate names", `{"probes": [{"type": "tcp", "target": "db:5432"}, {"type": "tcp", "target": "db:5432"}]}`, "duplicate name"},
+		{"duplicate explicit names", `{"probes": [{"name": "api", "type": "tcp", "target": "a:1"}, {"name": "api", "type": "http", "target": "http://b"}]}`, "duplicate name"},
+		{"invalid bodyRegex", `{"probes": [{"type": "http", "target": "http://a", "bodyRegex": "ok("}]}`, "invalid bodyRegex"},
+		{"missing target", `{"probes": [{"type": "tcp"}]}`, "type and target are required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadTestFile(t, tt.config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if cfg.Probes[0].Name != cfg.Probes[0].Target {
+					t.Errorf("name = %q, want the target", cfg.Probes[0].Name)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadFileICMPProbeFitsTimeout(t *testing.T) {
+	_, err := loadTestFile(t, `{"probes": [{"type": "icmp", "target": "10.0.0.1", "count": 10, "packetInterval": "1s", "timeout": "5s"}]}`)
+	if err == nil || !strings.Contains(err.Error(), "don't fit") {
+		t.Fatalf("error = %v", err)
+	}
+	if _, err := loadTestFile(t, `{"probes": [{"type": "icmp", "target": "10.0.0.1", "count": 4, "packetInterval": "1s", "timeout": "5s"}]}`); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadFileProcessDetails(t *testing.T) {
+	cfg, err := loadTestFile(t, `{"processes": {"details": ["threads", "fds", "io", "tree"]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Processes.Details) != 4 {
+		t.Errorf("details = %v", cfg.Processes.Details)
+	}
+	if _, err := loadTestFile(t, `{"processes": {"details": ["rates"]}}`); err == nil {
+		t.Error("unknown detail accepted")
+	}
+}
+
+func TestLoadFileProcessWatch(t *testing.T) {
+	cfg, err := loadTestFile(t, `{"processes": {"watch": [{"name": "worker", "cmdline": "celery .* worker"}]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := cfg.Processes.Watch[0]; w.MinCount != 1 {
+		t.Errorf("minCount = %d, want 1", w.MinCount)
+	}
+	if _, err := loadTestFile(t, `{"processes": {"watch": [{"name": "worker", "cmdline": "celery ("}]}}`); err == nil || !strings.Contains(err.Error(), "invalid cmdline") {
+		t.Errorf("error = %v", err)
+	}
+	if _, err := loadTestFile(t, `{"processes": {"watch": [{"name": "empty"}]}}`); err == nil {
+		t.Error("watch without criteria accepted")
+	}
+}
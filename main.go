@@ -32,6 +32,9 @@ func main() {
 	log.Printf("UptimeID Agent %s built on %s", version, date)
 	log.Printf("API URL: %s", cfg.APIURL)
 	log.Printf("Interval: %v", cfg.SendInterval)
+	if cfg.KubernetesMode {
+		log.Printf("Kubernetes mode: node=%s kubelet=%s", cfg.NodeName, cfg.KubeletURL)
+	}
 
 	if _, err := os.Stat(".env"); os.IsNotExist(err) {
 		log.Println("No .env found, using env vars")
@@ -56,21 +59,28 @@ func main() {
 	// Initialize detect capabilities here so it prints after our logs
 	collector.DetectCapabilities()
 
-	go runCollector(ctx, sender, cfg.SendInterval)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runCollector(ctx, sender, cfg)
+	}()
 
 	sig := <-stop
 	log.Printf("Received signal %v, shutting down gracefully...", sig)
 	cancel()
+	// Let a collection in progress finish before the final one.
+	<-done
 
 	log.Println("Flushing final metrics...")
 	flushCtx, flushCancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer flushCancel()
 
-	metric, err := collector.CollectMetrics()
+	metric, err := collector.CollectMetrics(cfg)
 	if err == nil {
 		if _, err := sender.SendMetrics(flushCtx, metric); err != nil {
 			log.Printf("Final flush failed: %v", err)
 		} else {
+			collector.CommitLogPositions()
 			log.Println("Final metrics flushed successfully")
 		}
 	}
@@ -78,13 +88,13 @@ func main() {
 	log.Println("Agent stopped")
 }
 
-func runCollector(ctx context.Context, sender *api.Sender, interval time.Duration) {
-	ticker := time.NewTicker(interval)
+func runCollector(ctx context.Context, sender *api.Sender, cfg *config.Config) {
+	ticker := time.NewTicker(cfg.SendInterval)
 	defer ticker.Stop()
 
-	currentInterval := interval
+	currentInterval := cfg.SendInterval
 
-	newInterval := sendMetrics(ctx, sender)
+	newInterval := sendMetrics(ctx, sender, cfg)
 	if newInterval > 0 && newInterval != currentInterval {
 		log.Printf("Interval updated: %v -> %v", currentInterval, newInterval)
 		currentInterval = newInterval
@@ -94,7 +104,7 @@ func runCollector(ctx context.Context, sender *api.Sender, interval time.Duratio
 	for {
 		select {
 		case <-ticker.C:
-			newInterval := sendMetrics(ctx, sender)
+			newInterval := sendMetrics(ctx, sender, cfg)
 			if newInterval > 0 && newInterval != currentInterval {
 				log.Printf("Interval updated: %v -> %v", currentInterval, newInterval)
 				currentInterval = newInterval
@@ -106,8 +116,8 @@ func runCollector(ctx context.Context, sender *api.Sender, interval time.Duratio
 	}
 }
 
-func sendMetrics(ctx context.Context, sender *api.Sender) time.Duration {
-	metric, err := collector.CollectMetrics()
+func sendMetrics(ctx context.Context, sender *api.Sender, cfg *config.Config) time.Duration {
+	metric, err := collector.CollectMetrics(cfg)
 	if err != nil {
 		log.Printf("Collection failed: %v", err)
 		return 0
@@ -116,7 +126,9 @@ func sendMetrics(ctx context.Context, sender *api.Sender) time.Duration {
 	newInterval, err := sender.SendMetrics(ctx, metric)
 	if err != nil {
 		log.Printf("Send failed: %v", err)
+		collector.RewindLogPositions()
 		return 0
 	}
+	collector.CommitLogPositions()
 	return newInterval
 }
@@ -0,0 +1,17 @@
+package models
+
+type CertificateInfo struct {
+	Source        string   `json:"source"` // host:port or file path
+	Type          string   `json:"type"`   // endpoint, file
+	ServerName    string   `json:"serverName,omitempty"`
+	Subject       string   `json:"subject,omitempty"`
+	SANs          []string `json:"sans,omitempty"`
+	Issuer        string   `json:"issuer,omitempty"`
+	SerialNumber  string   `json:"serialNumber,omitempty"`
+	NotBefore     int64    `json:"notBefore,omitempty"`     // unix ms
+	NotAfter      int64    `json:"notAfter,omitempty"`      // unix ms
+	DaysRemaining *float64 `json:"daysRemaining,omitempty"` // unset when the certificate couldn't be read
+	ChainError    string   `json:"chainError,omitempty"`
+	Error         string   `json:"error,omitempty"`
+	CheckedAt     int64    `json:"checkedAt"` // unix ms
+}
@@ -0,0 +1,25 @@
+package models
+
+// CheckResult is the outcome of the last run of a check plugin.
+type CheckResult struct {
+	Name      string        `json:"name"`
+	State     string        `json:"state"` // ok, warning, critical, unknown
+	ExitCode  int           `json:"exitCode"`
+	Message   string        `json:"message"`
+	Output    string        `json:"output,omitempty"` // long output, after the first line
+	Metrics   []CheckMetric `json:"metrics,omitempty"`
+	Duration  float64       `json:"duration"`  // ms
+	CheckedAt int64         `json:"checkedAt"` // unix ms
+}
+
+// CheckMetric is one perfdata value. Warn and Crit keep the Nagios range
+// syntax ("10", "10:20", "@~:5").
+type CheckMetric struct {
+	Label string   `json:"label"`
+	Value float64  `json:"value"`
+	Unit  string   `json:"unit,omitempty"`
+	Warn  string   `json:"warn,omitempty"`
+	Crit  string   `json:"crit,omitempty"`
+	Min   *float64 `json:"min,omitempty"`
+	Max   *float64 `json:"max,omitempty"`
+}
@@ -7,5 +7,69 @@ type ContainerInfo struct {
 	Status  string `json:"status"`
 	State   string `json:"state"`
 	Created int64  `json:"created"`
-	Logs    string `json:"logs,omitempty"`
+
+	Kubernetes *KubernetesInfo `json:"kubernetes,omitempty"`
+}
+
+type KubernetesInfo struct {
+	Node      string            `json:"node,omitempty"`
+	Namespace string            `json:"namespace"`
+	Pod       string            `json:"pod"`
+	PodUID    string            `json:"podUid,omitempty"`
+	Container string            `json:"container"`
+	OwnerKind string            `json:"ownerKind,omitempty"`
+	OwnerName string            `json:"ownerName,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Restarts  int32             `json:"restarts"`
+
+	// From the kubelet /stats/summary endpoint, when enabled.
+	CPUNanoCores     uint64 `json:"cpuNanoCores,omitempty"`
+	MemoryWorkingSet uint64 `json:"memoryWorkingSet,omitempty"`
+}
+
+type DockerDiskUsage struct {
+	LayersSize            int64               `json:"layersSize"`
+	ImagesCount           int                 `json:"imagesCount"`
+	ImagesSize            int64               `json:"imagesSize"`
+	ImagesReclaimable     int64               `json:"imagesReclaimable"`
+	DanglingImages        int                 `json:"danglingImages"`
+	DanglingImagesSize    int64               `json:"danglingImagesSize"`
+	ContainersCount       int                 `json:"containersCount"`
+	ContainersSize        int64               `json:"containersSize"` // writable layers
+	VolumesCount          int                 `json:"volumesCount"`
+	VolumesSize           int64               `json:"volumesSize"`
+	DanglingVolumes       int                 `json:"danglingVolumes"`
+	DanglingVolumesSize   int64               `json:"danglingVolumesSize"`
+	BuildCacheCount       int                 `json:"buildCacheCount"`
+	BuildCacheSize        int64               `json:"buildCacheSize"`
+	BuildCacheReclaimable int64               `json:"buildCacheReclaimable"`
+	Images                []DockerImageUsage  `json:"images,omitempty"`
+	Volumes               []DockerVolumeUsage `json:"volumes,omitempty"`
+	Containers            []DockerLayerUsage  `json:"containers,omitempty"`
+	CollectedAt           int64               `json:"collectedAt"` // unix ms
+}
+
+type DockerImageUsage struct {
+	ID         string   `json:"id"`
+	Tags       []string `json:"tags,omitempty"`
+	Size       int64    `json:"size"`
+	SharedSize int64    `json:"sharedSize"`
+	Containers int64    `json:"containers"`
+	Dangling   bool     `json:"dangling"`
+	Created    int64    `json:"created"`
+}
+
+type DockerVolumeUsage struct {
+	Name     string `json:"name"`
+	Driver   string `json:"driver"`
+	Size     int64  `json:"size"` // -1 when the driver doesn't report usage
+	RefCount int64  `json:"refCount"`
+	Dangling bool   `json:"dangling"`
+}
+
+type DockerLayerUsage struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	SizeRw     int64  `json:"sizeRw"`
+	SizeRootFs int64  `json:"sizeRootFs"`
 }
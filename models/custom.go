@@ -0,0 +1,49 @@
+package models
+
+// CustomMetric is an application or integration metric (OTLP, StatsD,
+// Prometheus, ...) shipped alongside the host metrics.
+type CustomMetric struct {
+	Name      string            `json:"name"`
+	Type      string            `json:"type"`  // gauge, counter, rate, histogram, summary, set
+	Value     float64           `json:"value"` // mean for distributions
+	Unit      string            `json:"unit,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Source    string            `json:"source"`
+	Timestamp int64             `json:"timestamp,omitempty"` // unix ms
+	Rate      float64           `json:"rate,omitempty"`      // per second, for counters
+
+	// Distributions (histogram, summary, timers)
+	Count     uint64             `json:"count,omitempty"`
+	Sum       float64            `json:"sum,omitempty"`
+	Buckets   []HistogramBucket  `json:"buckets,omitempty"` // cumulative, without +Inf (that is Count)
+	Quantiles map[string]float64 `json:"quantiles,omitempty"`
+}
+
+type HistogramBucket struct {
+	UpperBound float64 `json:"le"`
+	Count      uint64  `json:"count"`
+}
+
+// TextfileInfo describes one file of the textfile collector directory.
+type TextfileInfo struct {
+	Path    string `json:"path"`
+	ModTime int64  `json:"modTime"` // unix ms
+	Metrics int    `json:"metrics"`
+	Stale   bool   `json:"stale,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Span is a finished trace span received from an instrumented application.
+type Span struct {
+	TraceID       string            `json:"traceId"`
+	SpanID        string            `json:"spanId"`
+	ParentSpanID  string            `json:"parentSpanId,omitempty"`
+	Name          string            `json:"name"`
+	Kind          string            `json:"kind"`
+	Service       string            `json:"service,omitempty"`
+	StartTime     int64             `json:"startTime"` // unix µs
+	Duration      float64           `json:"duration"`  // ms
+	Status        string            `json:"status"`    // unset, ok, error
+	StatusMessage string            `json:"statusMessage,omitempty"`
+	Attributes    map[string]string `json:"attributes,omitempty"`
+}
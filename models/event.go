@@ -0,0 +1,14 @@
+package models
+
+// LogEvent aggregates the log lines that matched a detection rule during
+// one collection interval, deduplicated by the rule's group-by fields.
+type LogEvent struct {
+	Rule      string            `json:"rule"`
+	Severity  string            `json:"severity"`
+	Count     int               `json:"count"`
+	FirstSeen int64             `json:"firstSeen"` // unix ms
+	LastSeen  int64             `json:"lastSeen"`  // unix ms
+	Source    string            `json:"source,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	Sample    string            `json:"sample"` // first matching message
+}
@@ -1,6 +1,34 @@
 package models
 
+import "encoding/json"
+
 type LogsInfo struct {
-	System   string `json:"system"`
-	Security string `json:"security"`
+	Records []LogRecord `json:"records,omitempty"`
+	Dropped int         `json:"dropped,omitempty"` // records cut to stay within MAX_LOG_SIZE_BYTES
+}
+
+// LogRecord is a single log line or event, whatever it was read from.
+type LogRecord struct {
+	Timestamp int64             `json:"timestamp"` // unix ms
+	Source    string            `json:"source"`    // system, security, container, or a configured file source
+	Input     string            `json:"input"`     // journal, file, docker, eventlog
+	Severity  string            `json:"severity,omitempty"`
+	Host      string            `json:"host,omitempty"`
+	Unit      string            `json:"unit,omitempty"`
+	Container string            `json:"container,omitempty"`
+	Path      string            `json:"path,omitempty"`
+	Message   string            `json:"message"`
+	Fields    map[string]string `json:"fields,omitempty"`
+
+	ParseError bool `json:"parseError,omitempty"` // the source's format didn't match; Message is raw
+}
+
+// Size is the record's contribution to the payload: its JSON encoding,
+// keys, quoting and escaping included, plus the separating comma.
+func (r LogRecord) Size() int {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return 0
+	}
+	return len(data) + 1
 }
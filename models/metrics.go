@@ -3,58 +3,90 @@ package models
 import "time"
 
 type Metric struct {
-	Timestamp  time.Time       `json:"timestamp"`
-	Hostname   string          `json:"hostname"`
-	PublicIP   string          `json:"publicIp"`
-	OS         string          `json:"os"`
-	System     SystemInfo      `json:"system"`
-	Uptime     uint64          `json:"uptime"`
-	CPU        CPUInfo         `json:"cpu"`
-	Memory     MemoryInfo      `json:"memory"`
-	Swap       SwapInfo        `json:"swap"`
-	Disk       DiskInfo        `json:"disk"`
-	Network    NetworkInfo     `json:"network"`
-	Load       LoadInfo        `json:"load"`
-	Logs       LogsInfo        `json:"logs"`
-	Containers []ContainerInfo `json:"containers,omitempty"`
-	Latency    []LatencyInfo   `json:"latency,omitempty"`
-	Processes  []ProcessInfo   `json:"processes,omitempty"`
-	Services   []ServiceInfo   `json:"services,omitempty"`
+	Timestamp  time.Time        `json:"timestamp"`
+	Hostname   string           `json:"hostname"`
+	PublicIP   string           `json:"publicIp"`
+	OS         string           `json:"os"`
+	System     SystemInfo       `json:"system"`
+	Uptime     uint64           `json:"uptime"`
+	CPU        CPUInfo          `json:"cpu"`
+	Memory     MemoryInfo       `json:"memory"`
+	Swap       SwapInfo         `json:"swap"`
+	Disk       DiskInfo         `json:"disk"`
+	Network    NetworkInfo      `json:"network"`
+	Load       LoadInfo         `json:"load"`
+	Logs       LogsInfo         `json:"logs"`
+	Containers []ContainerInfo  `json:"containers,omitempty"`
+	Latency    []LatencyInfo    `json:"latency,omitempty"`
+	Processes  []ProcessInfo    `json:"processes,omitempty"`
+	Services   []ServiceInfo    `json:"services,omitempty"`
+	Probes     []ProbeResult    `json:"checks,omitempty"` // kept as "checks" for existing API consumers
+	DockerDisk *DockerDiskUsage `json:"dockerDisk,omitempty"`
+
+	Certificates []CertificateInfo `json:"certificates,omitempty"`
+	Events       []LogEvent        `json:"events,omitempty"`
+	Security     *SecurityInfo     `json:"security,omitempty"`
+
+	CustomMetrics []CustomMetric `json:"customMetrics,omitempty"`
+	Spans         []Span         `json:"spans,omitempty"`
+	SpansDropped  int            `json:"spansDropped,omitempty"` // refused while the span buffer was full
+	Checks        []CheckResult  `json:"pluginChecks,omitempty"`
+	Textfiles     []TextfileInfo `json:"textfiles,omitempty"`
+
+	ProcessGroups []ProcessGroup `json:"processGroups,omitempty"`
+	Sockets       *SocketInfo    `json:"sockets,omitempty"`
+	NetStack      *NetStackInfo  `json:"netStack,omitempty"`
 }
 
 type MetricPayload struct {
-	Version     string          `json:"version"`
-	PublicIP    string          `json:"publicIp"`
-	Timestamp   int64           `json:"timestamp"`
-	CPU         float64         `json:"cpu"`
-	CPUModel    string          `json:"cpuModel"`
-	CPUCores    int             `json:"cpuCores"`
-	Memory      float64         `json:"memory"`
-	MemoryUsed  float64         `json:"memoryUsed"`
-	MemoryTotal float64         `json:"memoryTotal"`
-	Swap        float64         `json:"swap"`
-	SwapUsed    float64         `json:"swapUsed"`
-	SwapTotal   float64         `json:"swapTotal"`
-	Disk        float64         `json:"disk"`
-	DiskUsed    float64         `json:"diskUsed"`
-	DiskTotal   float64         `json:"diskTotal"`
-	DiskRead    float64         `json:"diskRead"`
-	DiskWrite   float64         `json:"diskWrite"`
-	NetworkIn   float64         `json:"networkIn"`
-	NetworkOut  float64         `json:"networkOut"`
-	Load1       float64         `json:"load1"`
-	Load5       float64         `json:"load5"`
-	Load15      float64         `json:"load15"`
-	Uptime      float64         `json:"uptime"`
-	Hostname    string          `json:"hostname"`
-	OS          string          `json:"os"`
-	Kernel      string          `json:"kernel"`
-	Arch        string          `json:"arch"`
-	Logs        *LogsInfo       `json:"logs,omitempty"`
-	Containers  []ContainerInfo `json:"containers,omitempty"`
-	Latency     []LatencyInfo   `json:"latency,omitempty"`
-	Processes   []ProcessInfo   `json:"processes,omitempty"`
-	Services    []ServiceInfo   `json:"services,omitempty"`
+	Version     string           `json:"version"`
+	PublicIP    string           `json:"publicIp"`
+	Timestamp   int64            `json:"timestamp"`
+	CPU         float64          `json:"cpu"`
+	CPUModel    string           `json:"cpuModel"`
+	CPUCores    int              `json:"cpuCores"`
+	Memory      float64          `json:"memory"`
+	MemoryUsed  float64          `json:"memoryUsed"`
+	MemoryTotal float64          `json:"memoryTotal"`
+	Swap        float64          `json:"swap"`
+	SwapUsed    float64          `json:"swapUsed"`
+	SwapTotal   float64          `json:"swapTotal"`
+	Disk        float64          `json:"disk"`
+	DiskUsed    float64          `json:"diskUsed"`
+	DiskTotal   float64          `json:"diskTotal"`
+	DiskRead    float64          `json:"diskRead"`
+	DiskWrite   float64          `json:"diskWrite"`
+	NetworkIn   float64          `json:"networkIn"`
+	NetworkOut  float64          `json:"networkOut"`
+	Load1       float64          `json:"load1"`
+	Load5       float64          `json:"load5"`
+	Load15      float64          `json:"load15"`
+	Uptime      float64          `json:"uptime"`
+	Hostname    string           `json:"hostname"`
+	OS          string           `json:"os"`
+	Kernel      string           `json:"kernel"`
+	Arch        string           `json:"arch"`
+	Logs        *LogsInfo        `json:"logs,omitempty"`
+	Containers  []ContainerInfo  `json:"containers,omitempty"`
+	Latency     []LatencyInfo    `json:"latency,omitempty"`
+	Processes   []ProcessInfo    `json:"processes,omitempty"`
+	Services    []ServiceInfo    `json:"services,omitempty"`
+	Probes      []ProbeResult    `json:"checks,omitempty"`
+	DockerDisk  *DockerDiskUsage `json:"dockerDisk,omitempty"`
+
+	Certificates []CertificateInfo `json:"certificates,omitempty"`
+	Events       []LogEvent        `json:"events,omitempty"`
+	Security     *SecurityInfo     `json:"security,omitempty"`
+
+	CustomMetrics []CustomMetric `json:"customMetrics,omitempty"`
+	Spans         []Span         `json:"spans,omitempty"`
+	SpansDropped  int            `json:"spansDropped,omitempty"` // refused while the span buffer was full
+	Checks        []CheckResult  `json:"pluginChecks,omitempty"`
+	Textfiles     []TextfileInfo `json:"textfiles,omitempty"`
+
+	ProcessGroups []ProcessGroup `json:"processGroups,omitempty"`
+	Sockets       *SocketInfo    `json:"sockets,omitempty"`
+	NetStack      *NetStackInfo  `json:"netStack,omitempty"`
 }
 
 func (m *Metric) ToPayload(version string) *MetricPayload {
@@ -91,5 +123,21 @@ func (m *Metric) ToPayload(version string) *MetricPayload {
 		Latency:     m.Latency,
 		Processes:   m.Processes,
 		Services:    m.Services,
+		Probes:      m.Probes,
+		DockerDisk:  m.DockerDisk,
+
+		Certificates: m.Certificates,
+		Events:       m.Events,
+		Security:     m.Security,
+
+		CustomMetrics: m.CustomMetrics,
+		Spans:         m.Spans,
+		SpansDropped:  m.SpansDropped,
+		Checks:        m.Checks,
+		Textfiles:     m.Textfiles,
+
+		ProcessGroups: m.ProcessGroups,
+		Sockets:       m.Sockets,
+		NetStack:      m.NetStack,
 	}
 }
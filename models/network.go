@@ -10,3 +10,54 @@ type LatencyInfo struct {
 	Latency float64 `json:"latency"`
 	Success bool    `json:"success"`
 }
+
+// SocketInfo lists what is listening on the host and counts its TCP
+// connections by state (ESTABLISHED, TIME_WAIT, ...).
+type SocketInfo struct {
+	Listeners []ListeningSocket `json:"listeners"`
+	TCPStates map[string]int    `json:"tcpStates"`
+}
+
+// ListeningSocket is a TCP socket in the LISTEN state, an unconnected UDP
+// socket or a listening unix socket. The owner is unknown when the agent
+// can't see the process.
+type ListeningSocket struct {
+	Protocol    string `json:"protocol"` // tcp, tcp6, udp, udp6, unix
+	Address     string `json:"address,omitempty"`
+	Port        int    `json:"port,omitempty"`
+	Path        string `json:"path,omitempty"` // unix sockets, "@" for abstract ones
+	PID         int    `json:"pid,omitempty"`
+	Process     string `json:"process,omitempty"`
+	ContainerID string `json:"containerId,omitempty"`
+}
+
+// NetStackInfo is the health of the kernel network stack: error and drop
+// counters as per-second rates (TCP and UDP over IPv4 and IPv6), socket
+// usage and the connection tracking table.
+type NetStackInfo struct {
+	TCPRetransSegs     float64 `json:"tcpRetransSegs"`
+	TCPOutRsts         float64 `json:"tcpOutRsts"`
+	TCPInErrs          float64 `json:"tcpInErrs"`
+	TCPAttemptFails    float64 `json:"tcpAttemptFails"`
+	TCPEstabResets     float64 `json:"tcpEstabResets"`
+	TCPListenOverflows float64 `json:"tcpListenOverflows"`
+	TCPListenDrops     float64 `json:"tcpListenDrops"`
+	TCPSyncookiesSent  float64 `json:"tcpSyncookiesSent"`
+	UDPInErrors        float64 `json:"udpInErrors"`
+	UDPRcvbufErrors    float64 `json:"udpRcvbufErrors"`
+	UDPSndbufErrors    float64 `json:"udpSndbufErrors"`
+	UDPNoPorts         float64 `json:"udpNoPorts"`
+
+	TCPInUse    int    `json:"tcpInUse"`
+	TCPOrphan   int    `json:"tcpOrphan"`
+	TCPTimeWait int    `json:"tcpTimeWait"`
+	TCPAlloc    int    `json:"tcpAlloc"`
+	TCPMem      uint64 `json:"tcpMem"` // bytes
+	UDPInUse    int    `json:"udpInUse"`
+	UDPMem      uint64 `json:"udpMem"` // bytes
+
+	// Only when nf_conntrack is loaded. Drops are per second.
+	ConntrackCount uint64  `json:"conntrackCount,omitempty"`
+	ConntrackMax   uint64  `json:"conntrackMax,omitempty"`
+	ConntrackDrops float64 `json:"conntrackDrops,omitempty"`
+}
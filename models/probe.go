@@ -0,0 +1,29 @@
+package models
+
+type ProbeResult struct {
+	Name       string     `json:"name"`
+	Type       string     `json:"type"`
+	Target     string     `json:"target"`
+	Container  string     `json:"container,omitempty"`
+	Success    bool       `json:"success"`
+	Latency    float64    `json:"latency"`           // total, ms
+	DNS        float64    `json:"dns,omitempty"`     // ms
+	Connect    float64    `json:"connect,omitempty"` // ms
+	TLS        float64    `json:"tls,omitempty"`     // ms
+	TTFB       float64    `json:"ttfb,omitempty"`    // ms
+	StatusCode int        `json:"statusCode,omitempty"`
+	Answers    []string   `json:"answers,omitempty"`
+	ICMP       *ICMPStats `json:"icmp,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CheckedAt  int64      `json:"checkedAt"` // unix ms
+}
+
+type ICMPStats struct {
+	PacketsSent int     `json:"packetsSent"`
+	PacketsRecv int     `json:"packetsRecv"`
+	Loss        float64 `json:"loss"`   // %
+	RTTMin      float64 `json:"rttMin"` // ms
+	RTTAvg      float64 `json:"rttAvg"` // ms
+	RTTMax      float64 `json:"rttMax"` // ms
+	Jitter      float64 `json:"jitter"` // ms, standard deviation of RTT
+}
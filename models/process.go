@@ -11,4 +11,39 @@ type ProcessInfo struct {
 	VirtMemory uint64  `json:"virt_memory"` // New: Virtual Memory (bytes)
 	Time       string  `json:"time"`        // New: Exported as string (e.g. "0:05.12")
 	Command    string  `json:"command"`
+	Threads    int     `json:"threads,omitempty"`
+	FDs        int     `json:"fds,omitempty"`
+	ReadRate   float64 `json:"readRate,omitempty"`  // bytes/s
+	WriteRate  float64 `json:"writeRate,omitempty"` // bytes/s
+
+	// Optional details, see the processes "details" setting.
+	PPID                   int    `json:"ppid,omitempty"`
+	ParentName             string `json:"parentName,omitempty"`
+	Children               int    `json:"children,omitempty"`
+	FDLimit                uint64 `json:"fdLimit,omitempty"`
+	VoluntaryCtxSwitches   int64  `json:"voluntaryCtxSwitches,omitempty"`
+	InvoluntaryCtxSwitches int64  `json:"involuntaryCtxSwitches,omitempty"`
+	StartTime              int64  `json:"startTime,omitempty"` // unix ms
+	Cgroup                 string `json:"cgroup,omitempty"`
+	ContainerID            string `json:"containerId,omitempty"`
+	Unit                   string `json:"unit,omitempty"` // systemd unit
+	Nice                   *int   `json:"nice,omitempty"`
+	Priority               *int   `json:"priority,omitempty"`
+}
+
+// ProcessGroup aggregates the processes matched by a watchlist entry.
+// ReadBytes and WriteBytes are cumulative.
+type ProcessGroup struct {
+	Name       string  `json:"name"`
+	State      string  `json:"state"` // running, not_running
+	Count      int     `json:"count"`
+	MinCount   int     `json:"minCount"`
+	PIDs       []int   `json:"pids,omitempty"`
+	CPU        float64 `json:"cpu"`    // % CPU
+	Memory     float64 `json:"memory"` // % memory
+	RSS        uint64  `json:"rss"`    // bytes
+	Threads    int     `json:"threads"`
+	FDs        int     `json:"fds"`
+	ReadBytes  uint64  `json:"readBytes"`
+	WriteBytes uint64  `json:"writeBytes"`
 }
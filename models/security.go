@@ -0,0 +1,46 @@
+package models
+
+// SecurityInfo summarizes authentication activity seen in the interval's
+// logs plus the sessions currently open according to utmp.
+type SecurityInfo struct {
+	Logins   []AuthLogin   `json:"logins,omitempty"`
+	Failures []AuthFailure `json:"failures,omitempty"`
+	Sudo     []SudoCommand `json:"sudo,omitempty"`
+	Sessions []UserSession `json:"sessions,omitempty"`
+}
+
+type AuthLogin struct {
+	User     string `json:"user"`
+	SourceIP string `json:"sourceIp,omitempty"`
+	Method   string `json:"method"` // password, publickey, keyboard-interactive/pam, ...
+	Service  string `json:"service"`
+	Count    int    `json:"count"`
+	LastSeen int64  `json:"lastSeen"` // unix ms
+}
+
+type AuthFailure struct {
+	User        string `json:"user"`
+	SourceIP    string `json:"sourceIp,omitempty"`
+	Service     string `json:"service"`
+	InvalidUser bool   `json:"invalidUser,omitempty"`
+	Count       int    `json:"count"`
+	LastSeen    int64  `json:"lastSeen"` // unix ms
+}
+
+type SudoCommand struct {
+	User     string `json:"user"`
+	RunAs    string `json:"runAs"`
+	Command  string `json:"command"`
+	TTY      string `json:"tty,omitempty"`
+	Denied   string `json:"denied,omitempty"` // reason when sudo refused
+	Count    int    `json:"count"`
+	LastSeen int64  `json:"lastSeen"` // unix ms
+}
+
+type UserSession struct {
+	User      string `json:"user"`
+	TTY       string `json:"tty"`
+	Host      string `json:"host,omitempty"`
+	PID       int    `json:"pid"`
+	LoginTime int64  `json:"loginTime"` // unix ms
+}